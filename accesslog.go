@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat 访问日志的格式
+type AccessLogFormat int
+
+const (
+	// AccessLogText key=value 形式的文本
+	AccessLogText AccessLogFormat = iota
+	// AccessLogJSON 每行一个 JSON 对象
+	AccessLogJSON
+	// AccessLogCommon Common Log Format
+	AccessLogCommon
+	// AccessLogCombined Combined Log Format，在 Common 的基础上多了 Referer 和 User-Agent
+	AccessLogCombined
+)
+
+// AccessLogEntry 一条访问日志
+type AccessLogEntry struct {
+	Time      time.Time     `json:"time"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	Route     string        `json:"route"`
+	Proto     string        `json:"proto"`
+	Status    int           `json:"status"`
+	Bytes     int64         `json:"bytes"`
+	Latency   time.Duration `json:"-"`
+	ClientIP  string        `json:"client_ip"`
+	RequestID string        `json:"request_id,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty"`
+	Referer   string        `json:"referer,omitempty"`
+	// RequestURI 原始的请求行里面的 URI，包括查询参数
+	RequestURI string `json:"-"`
+	User       string `json:"user,omitempty"`
+}
+
+// AccessLogger 接收结构化的访问日志，可以对接任意的日志库
+type AccessLogger interface {
+	LogAccess(entry *AccessLogEntry)
+}
+
+// AccessLoggerFunc 让普通函数实现 AccessLogger
+type AccessLoggerFunc func(entry *AccessLogEntry)
+
+func (f AccessLoggerFunc) LogAccess(entry *AccessLogEntry) {
+	f(entry)
+}
+
+type accessLogConfig struct {
+	logger     AccessLogger
+	format     AccessLogFormat
+	writer     io.Writer
+	sampleRate float64
+	skipPaths  map[string]struct{}
+}
+
+type AccessLogOption func(cfg *accessLogConfig)
+
+// WithAccessLogFormat 输出格式，默认 AccessLogText，设置了 WithAccessLogger 的时候不生效
+func WithAccessLogFormat(format AccessLogFormat) AccessLogOption {
+	return func(cfg *accessLogConfig) {
+		cfg.format = format
+	}
+}
+
+// WithAccessLogWriter 输出的位置，默认标准输出，设置了 WithAccessLogger 的时候不生效
+func WithAccessLogWriter(w io.Writer) AccessLogOption {
+	return func(cfg *accessLogConfig) {
+		cfg.writer = w
+	}
+}
+
+// WithAccessLogger 使用自定义的结构化日志
+func WithAccessLogger(logger AccessLogger) AccessLogOption {
+	return func(cfg *accessLogConfig) {
+		cfg.logger = logger
+	}
+}
+
+// WithAccessLogSampling 只记录 rate 比例的请求，取值 (0, 1]，5xx 的请求总是会被记录
+func WithAccessLogSampling(rate float64) AccessLogOption {
+	return func(cfg *accessLogConfig) {
+		cfg.sampleRate = rate
+	}
+}
+
+// WithAccessLogSkipPaths 不记录的路径，可以是请求路径也可以是路由，例如健康检查 /healthz
+func WithAccessLogSkipPaths(paths ...string) AccessLogOption {
+	return func(cfg *accessLogConfig) {
+		for _, p := range paths {
+			cfg.skipPaths[p] = struct{}{}
+		}
+	}
+}
+
+// AccessLog 访问日志中间件，配合 HTTPServer.Use 使用可以记录包括 404 在内的所有请求
+func AccessLog(opts ...AccessLogOption) Middleware {
+	cfg := &accessLogConfig{
+		format:     AccessLogText,
+		writer:     os.Stdout,
+		sampleRate: 1,
+		skipPaths:  map[string]struct{}{},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.logger == nil {
+		cfg.logger = NewWriterAccessLogger(cfg.writer, cfg.format)
+	}
+
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			start := time.Now()
+			next(ctx)
+			if cfg.skip(ctx) {
+				return
+			}
+			status := ctx.responseStatus()
+			if status < 500 && cfg.sampleRate < 1 && rand.Float64() >= cfg.sampleRate {
+				return
+			}
+			r := ctx.Request
+			entry := &AccessLogEntry{
+				Time:       start,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Route:      ctx.MatchedRoute,
+				Proto:      r.Proto,
+				Status:     status,
+				Bytes:      ctx.responseSize(),
+				Latency:    time.Since(start),
+				ClientIP:   ctx.ClientIP(),
+				RequestID:  ctx.requestIDForLog(),
+				UserAgent:  r.UserAgent(),
+				Referer:    r.Referer(),
+				RequestURI: r.RequestURI,
+			}
+			// 只记录认证通过的调用方，Authorization 里面没有校验过的用户名可以被随意伪造
+			if ctx.principal != nil {
+				entry.User = ctx.principal.Subject
+			}
+			cfg.logger.LogAccess(entry)
+		}
+	}
+}
+
+func (cfg *accessLogConfig) skip(ctx *Context) bool {
+	if _, ok := cfg.skipPaths[ctx.Request.URL.Path]; ok {
+		return true
+	}
+	if ctx.MatchedRoute == "" {
+		return false
+	}
+	_, ok := cfg.skipPaths[ctx.MatchedRoute]
+	return ok
+}
+
+// requestIDForLog 优先使用 RequestID 中间件设置的 ID，其次是响应头和请求头里面的 X-Request-ID
+func (c *Context) requestIDForLog() string {
+	if c.requestID != "" {
+		return c.requestID
+	}
+	if id := c.ResponseWriter.Header().Get("X-Request-ID"); id != "" {
+		return id
+	}
+	return c.Request.Header.Get("X-Request-ID")
+}
+
+// responseStatus 响应的状态码，响应还没有写回去的时候就是将要写回去的状态码
+func (c *Context) responseStatus() int {
+	if rw := c.response(); rw.Committed() {
+		return rw.Status()
+	}
+	if c.StatusCode <= 0 {
+		return http.StatusOK
+	}
+	return c.StatusCode
+}
+
+// responseSize 响应体的字节数
+func (c *Context) responseSize() int64 {
+	if rw := c.response(); rw.Committed() {
+		return rw.Size()
+	}
+	if !bodyAllowedForStatus(c.responseStatus()) {
+		return 0
+	}
+	return int64(len(c.ResponseData))
+}
+
+// NewWriterAccessLogger 按照 format 把日志写到 w，并发安全
+func NewWriterAccessLogger(w io.Writer, format AccessLogFormat) AccessLogger {
+	return &writerAccessLogger{w: w, format: format}
+}
+
+type writerAccessLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format AccessLogFormat
+}
+
+func (l *writerAccessLogger) LogAccess(entry *AccessLogEntry) {
+	line := formatAccessLog(l.format, entry)
+	l.mu.Lock()
+	_, _ = l.w.Write(line)
+	l.mu.Unlock()
+}
+
+func formatAccessLog(format AccessLogFormat, e *AccessLogEntry) []byte {
+	switch format {
+	case AccessLogJSON:
+		data, _ := json.Marshal(struct {
+			*AccessLogEntry
+			Latency float64 `json:"latency_ms"`
+		}{AccessLogEntry: e, Latency: float64(e.Latency) / float64(time.Millisecond)})
+		return append(data, '\n')
+	case AccessLogCommon, AccessLogCombined:
+		return formatCLF(format, e)
+	default:
+		return formatText(e)
+	}
+}
+
+func formatText(e *AccessLogEntry) []byte {
+	var sb strings.Builder
+	sb.WriteString("time=")
+	sb.WriteString(e.Time.Format(time.RFC3339))
+	sb.WriteString(" method=")
+	sb.WriteString(e.Method)
+	sb.WriteString(" path=")
+	sb.WriteString(quoteIfNeeded(e.Path))
+	sb.WriteString(" route=")
+	sb.WriteString(quoteIfNeeded(e.Route))
+	sb.WriteString(" status=")
+	sb.WriteString(strconv.Itoa(e.Status))
+	sb.WriteString(" bytes=")
+	sb.WriteString(strconv.FormatInt(e.Bytes, 10))
+	sb.WriteString(" latency=")
+	sb.WriteString(e.Latency.String())
+	sb.WriteString(" ip=")
+	sb.WriteString(e.ClientIP)
+	if e.User != "" {
+		sb.WriteString(" user=")
+		sb.WriteString(quoteIfNeeded(e.User))
+	}
+	if e.RequestID != "" {
+		sb.WriteString(" request_id=")
+		sb.WriteString(quoteIfNeeded(e.RequestID))
+	}
+	sb.WriteByte('\n')
+	return []byte(sb.String())
+}
+
+func quoteIfNeeded(s string) string {
+	if s == "" || strings.ContainsAny(s, " \"=\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// formatCLF 127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326
+func formatCLF(format AccessLogFormat, e *AccessLogEntry) []byte {
+	var sb strings.Builder
+	sb.WriteString(e.ClientIP)
+	sb.WriteString(" - ")
+	// 用户名不在引号里面，空格也要转义，否则会把后面的字段挤乱
+	sb.WriteString(strings.ReplaceAll(clfEscape(dashIfEmpty(e.User)), " ", `\x20`))
+	sb.WriteString(" [")
+	sb.WriteString(e.Time.Format("02/Jan/2006:15:04:05 -0700"))
+	sb.WriteString("] \"")
+	uri := e.RequestURI
+	if uri == "" {
+		uri = e.Path
+	}
+	sb.WriteString(clfEscape(e.Method + " " + uri + " " + e.Proto))
+	sb.WriteString("\" ")
+	sb.WriteString(strconv.Itoa(e.Status))
+	sb.WriteByte(' ')
+	if e.Bytes == 0 {
+		sb.WriteByte('-')
+	} else {
+		sb.WriteString(strconv.FormatInt(e.Bytes, 10))
+	}
+	if format == AccessLogCombined {
+		sb.WriteString(" \"")
+		sb.WriteString(clfEscape(dashIfEmpty(e.Referer)))
+		sb.WriteString("\" \"")
+		sb.WriteString(clfEscape(dashIfEmpty(e.UserAgent)))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('\n')
+	return []byte(sb.String())
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// clfEscape 防止请求里面的引号和换行伪造日志
+func clfEscape(s string) string {
+	q := strconv.Quote(s)
+	return q[1 : len(q)-1]
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		entries []*AccessLogEntry
+	)
+	s := NewHTTPServer("test", "")
+	s.Use(AccessLog(WithAccessLogger(AccessLoggerFunc(func(entry *AccessLogEntry) {
+		mu.Lock()
+		entries = append(entries, entry)
+		mu.Unlock()
+	})), WithAccessLogSkipPaths("/healthz")))
+	s.Get("/user/:id", func(ctx *Context) {
+		ctx.Header("X-Request-ID", "req-1")
+		_ = ctx.StatusOK("hello")
+	})
+	s.Get("/stream", func(ctx *Context) {
+		_ = ctx.Stream(func(w io.Writer) error {
+			_, err := w.Write([]byte("streamed"))
+			return err
+		})
+	})
+	s.Get("/healthz", func(ctx *Context) {
+		_ = ctx.StatusOK("ok")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/user/12?a=b", nil)
+	req.RemoteAddr = "1.2.3.4:5678"
+	req.Header.Set("User-Agent", "test-agent")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stream", nil))
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/missing", nil))
+
+	require.Len(t, entries, 3)
+	e := entries[0]
+	assert.Equal(t, http.MethodGet, e.Method)
+	assert.Equal(t, "/user/12", e.Path)
+	assert.Equal(t, "/user/:id", e.Route)
+	assert.Equal(t, http.StatusOK, e.Status)
+	assert.Equal(t, int64(5), e.Bytes)
+	assert.Equal(t, "1.2.3.4", e.ClientIP)
+	assert.Equal(t, "req-1", e.RequestID)
+	assert.Equal(t, "test-agent", e.UserAgent)
+	assert.Equal(t, "/user/12?a=b", e.RequestURI)
+
+	assert.Equal(t, int64(8), entries[1].Bytes)
+	assert.Equal(t, http.StatusOK, entries[1].Status)
+
+	// 找不到路由的请求也会被记录
+	assert.Equal(t, http.StatusNotFound, entries[2].Status)
+	assert.Equal(t, "", entries[2].Route)
+}
+
+func TestAccessLog_Sampling(t *testing.T) {
+	count := 0
+	s := NewHTTPServer("test", "")
+	s.Use(AccessLog(WithAccessLogSampling(0.000001), WithAccessLogger(AccessLoggerFunc(func(entry *AccessLogEntry) {
+		count++
+	}))))
+	s.Get("/ok", func(ctx *Context) {
+		_ = ctx.StatusOK("ok")
+	})
+	s.Get("/error", func(ctx *Context) {
+		_ = ctx.StatusInternalServerError("error")
+	})
+	for i := 0; i < 100; i++ {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	}
+	assert.Equal(t, 0, count)
+	// 5xx 总是会被记录
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/error", nil))
+	assert.Equal(t, 1, count)
+}
+
+func Test_formatAccessLog(t *testing.T) {
+	entry := &AccessLogEntry{
+		Time:       time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+		Method:     http.MethodGet,
+		Path:       "/apache_pb.gif",
+		Route:      "/apache_pb.gif",
+		Proto:      "HTTP/1.0",
+		Status:     200,
+		Bytes:      2326,
+		Latency:    1500 * time.Microsecond,
+		ClientIP:   "127.0.0.1",
+		RequestID:  "abc",
+		UserAgent:  `Mozilla/4.08 "evil"`,
+		Referer:    "http://www.example.com/start.html",
+		RequestURI: "/apache_pb.gif",
+		User:       "frank",
+	}
+
+	assert.Equal(t, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`+"\n",
+		string(formatAccessLog(AccessLogCommon, entry)))
+	assert.Equal(t, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 \"evil\""`+"\n",
+		string(formatAccessLog(AccessLogCombined, entry)))
+	assert.Equal(t, "time=2000-10-10T13:55:36-07:00 method=GET path=/apache_pb.gif route=/apache_pb.gif status=200 bytes=2326 latency=1.5ms ip=127.0.0.1 user=frank request_id=abc\n",
+		string(formatAccessLog(AccessLogText, entry)))
+
+	// 用户名里面的空格、引号和换行不能伪造日志
+	forged := *entry
+	forged.User = "x\" 200 1\n1.2.3.4 - admin"
+	assert.Equal(t, `127.0.0.1 - x\"\x20200\x201\n1.2.3.4\x20-\x20admin [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`+"\n",
+		string(formatAccessLog(AccessLogCommon, &forged)))
+	assert.Contains(t, string(formatAccessLog(AccessLogText, &forged)), ` user="x\" 200 1\n1.2.3.4 - admin" `)
+
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(formatAccessLog(AccessLogJSON, entry), &m))
+	assert.Equal(t, 1.5, m["latency_ms"])
+	assert.Equal(t, "/apache_pb.gif", m["route"])
+	assert.Equal(t, float64(200), m["status"])
+}
+
+func TestNewWriterAccessLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	s := NewHTTPServer("test", "")
+	s.Get("/", func(ctx *Context) {
+		_ = ctx.NoContent()
+	}, AccessLog(WithAccessLogWriter(buf), WithAccessLogFormat(AccessLogCommon)))
+	// 没有经过认证的 Basic 用户名不会记录下来
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("frank", "")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Regexp(t, regexp.MustCompile(`^192\.0\.2\.1 - - \[.+\] "GET / HTTP/1\.1" 204 -\n$`), buf.String())
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+}
@@ -93,6 +93,12 @@ func (app *App) shutdown() {
 		s.rejectReq()
 	}
 
+	// 长连接不会自己结束，要先通知它们关闭，不然等待请求完结没有意义
+	log.Println("通知长连接关闭")
+	for _, s := range app.servers {
+		s.closeLongLivedConns()
+	}
+
 	//TODO go func 实时监听请求是否完成
 	log.Println("等待正在执行请求完结")
 	time.Sleep(app.waitTime)
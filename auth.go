@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofaquan/go-http/middleware/auth"
+)
+
+type authConfig struct {
+	optional bool
+}
+
+type AuthOption func(cfg *authConfig)
+
+// WithAuthOptional 没有带凭证的请求也放行，只是 ctx.Principal 返回 nil。
+// 带了错误凭证的请求仍然返回 401
+func WithAuthOptional(optional bool) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.optional = optional
+	}
+}
+
+// Authenticate 依次尝试 authenticators，第一个认证成功的结果放到 Context 和请求的 context.Context 里面。
+// 返回 auth.ErrNoCredentials 的认证器会被跳过，其它错误直接返回 401，
+// WWW-Authenticate 由实现了 auth.Challenger 的认证器提供
+func Authenticate(authenticators []auth.Authenticator, opts ...AuthOption) Middleware {
+	if len(authenticators) == 0 {
+		panic("web: Authenticate 至少需要一个 Authenticator")
+	}
+	cfg := &authConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	var challenges []string
+	for _, a := range authenticators {
+		if c, ok := a.(auth.Challenger); ok {
+			challenges = append(challenges, c.Challenge())
+		}
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			err := auth.ErrNoCredentials
+			for _, a := range authenticators {
+				var p *auth.Principal
+				p, err = a.Authenticate(ctx.Request)
+				if err == nil && p != nil {
+					ctx.principal = p
+					ctx.Request = ctx.Request.WithContext(auth.WithPrincipal(ctx.Request.Context(), p))
+					next(ctx)
+					return
+				}
+				if err == nil || errors.Is(err, auth.ErrNoCredentials) {
+					err = auth.ErrNoCredentials
+					continue
+				}
+				break
+			}
+			if cfg.optional && errors.Is(err, auth.ErrNoCredentials) {
+				ctx.authChallenges = challenges
+				next(ctx)
+				return
+			}
+			for _, c := range challenges {
+				ctx.ResponseWriter.Header().Add("WWW-Authenticate", c)
+			}
+			ctx.Error(&HTTPError{
+				Code:    http.StatusUnauthorized,
+				Message: http.StatusText(http.StatusUnauthorized),
+				Err:     err,
+			})
+		}
+	}
+}
+
+// Principal 认证通过的调用方，没有经过 Authenticate 或者匿名访问的时候返回 nil
+func (c *Context) Principal() *auth.Principal {
+	return c.principal
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gofaquan/go-http/middleware/auth"
+)
+
+func TestAuthenticate(t *testing.T) {
+	basic := auth.NewBasicAuth("admin", auth.BasicUsers(map[string]string{"alice": "pw"}))
+	apiKey := auth.NewAPIKeyAuth(auth.StaticAPIKeys(map[string]*auth.Principal{"key-1": {Subject: "ci"}}))
+	handler := func(ctx *Context) {
+		p := ctx.Principal()
+		if p == nil {
+			_ = ctx.StatusOK("anonymous")
+			return
+		}
+		assert.Equal(t, p, auth.PrincipalFrom(ctx.Request.Context()))
+		_ = ctx.StatusOK(p.Method + ":" + p.Subject)
+	}
+	s := NewHTTPServer("test", "")
+	s.Get("/private", handler, Authenticate([]auth.Authenticator{basic, apiKey}))
+	s.Get("/public", handler, Authenticate([]auth.Authenticator{basic, apiKey}, WithAuthOptional(true)))
+
+	testCases := []struct {
+		name          string
+		path          string
+		req           func(r *http.Request)
+		wantCode      int
+		wantBody      string
+		wantChallenge []string
+	}{
+		{name: "basic", path: "/private", req: func(r *http.Request) { r.SetBasicAuth("alice", "pw") },
+			wantCode: http.StatusOK, wantBody: "basic:alice"},
+		{name: "api key", path: "/private", req: func(r *http.Request) { r.Header.Set("Authorization", "Bearer key-1") },
+			wantCode: http.StatusOK, wantBody: "apikey:ci"},
+		{name: "no credentials", path: "/private", req: func(r *http.Request) {},
+			wantCode: http.StatusUnauthorized, wantBody: "Unauthorized",
+			wantChallenge: []string{`Basic realm="admin", charset="UTF-8"`, "Bearer"}},
+		// 错误的凭证不会继续尝试后面的认证器
+		{name: "wrong password", path: "/private", req: func(r *http.Request) {
+			r.SetBasicAuth("alice", "x")
+			r.Header.Set("X-API-Key", "key-1")
+		}, wantCode: http.StatusUnauthorized, wantBody: "Unauthorized",
+			wantChallenge: []string{`Basic realm="admin", charset="UTF-8"`, "Bearer"}},
+		{name: "optional anonymous", path: "/public", req: func(r *http.Request) {},
+			wantCode: http.StatusOK, wantBody: "anonymous"},
+		{name: "optional wrong key", path: "/public", req: func(r *http.Request) { r.Header.Set("X-API-Key", "key-2") },
+			wantCode: http.StatusUnauthorized, wantBody: "Unauthorized",
+			wantChallenge: []string{`Basic realm="admin", charset="UTF-8"`, "Bearer"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			tc.req(req)
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantChallenge, recorder.Header().Values("WWW-Authenticate"))
+		})
+	}
+}
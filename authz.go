@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gofaquan/go-http/middleware/auth"
+)
+
+// Policy 访问路由需要满足的条件，一个路由上的所有 Policy 都要满足。
+// Name 用来描述这个条件，出现在 403 的日志和 RoutePolicies 的结果里面
+type Policy struct {
+	Name  string
+	check func(ctx *Context, p *auth.Principal) bool
+	// anonymous 允许没有认证的请求访问
+	anonymous bool
+}
+
+// PolicyFunc 自定义的条件，p 为 nil 表示请求没有认证。
+// 可以用来检查路径参数之类的属性，例如只允许作者修改自己的文章
+func PolicyFunc(name string, fn func(ctx *Context, p *auth.Principal) bool) Policy {
+	return Policy{Name: name, check: fn}
+}
+
+// AllowAnonymous 不要求认证，一般单独用在登录页、健康检查之类的公开路由上
+func AllowAnonymous() Policy {
+	return Policy{
+		Name:      "anonymous",
+		check:     func(ctx *Context, p *auth.Principal) bool { return true },
+		anonymous: true,
+	}
+}
+
+// Authenticated 只要求通过认证
+func Authenticated() Policy {
+	return PolicyFunc("authenticated", func(ctx *Context, p *auth.Principal) bool {
+		return p != nil
+	})
+}
+
+// RequireRoles 拥有 roles 中的任意一个角色
+func RequireRoles(roles ...string) Policy {
+	return PolicyFunc("roles("+strings.Join(roles, "|")+")", func(ctx *Context, p *auth.Principal) bool {
+		if p == nil {
+			return false
+		}
+		for _, role := range roles {
+			if p.HasRole(role) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RequireScopes 拥有 scopes 中的全部权限范围
+func RequireScopes(scopes ...string) Policy {
+	return PolicyFunc("scopes("+strings.Join(scopes, ",")+")", func(ctx *Context, p *auth.Principal) bool {
+		if p == nil {
+			return false
+		}
+		for _, scope := range scopes {
+			if !p.HasScope(scope) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireOwner 路径参数 param 的值等于调用方的 Subject，例如 /users/:id 只允许用户访问自己的数据
+func RequireOwner(param string) Policy {
+	return PolicyFunc("owner(:"+param+")", func(ctx *Context, p *auth.Principal) bool {
+		if p == nil {
+			return false
+		}
+		val, ok := ctx.PathParams.Get(param)
+		return ok && val != "" && val == p.Subject
+	})
+}
+
+// AnyOf 满足其中任意一个条件，例如管理员或者数据的所有者
+func AnyOf(policies ...Policy) Policy {
+	names := make([]string, 0, len(policies))
+	anonymous := false
+	for _, policy := range policies {
+		names = append(names, policy.Name)
+		anonymous = anonymous || policy.anonymous
+	}
+	return Policy{
+		Name: "any(" + strings.Join(names, ", ") + ")",
+		check: func(ctx *Context, p *auth.Principal) bool {
+			for _, policy := range policies {
+				if (p != nil || policy.anonymous) && policy.check(ctx, p) {
+					return true
+				}
+			}
+			return false
+		},
+		anonymous: anonymous,
+	}
+}
+
+// routeAuthz 路由自己声明的条件以及所属的路由组
+type routeAuthz struct {
+	group    *Group
+	policies []Policy
+}
+
+// all 外层路由组的条件在前，路由自己的条件在后
+func (ra *routeAuthz) all() []Policy {
+	if ra == nil {
+		return nil
+	}
+	res := ra.policies
+	for g := ra.group; g != nil; g = g.parent {
+		if len(g.policies) > 0 {
+			res = append(append(make([]Policy, 0, len(g.policies)+len(res)), g.policies...), res...)
+		}
+	}
+	return res
+}
+
+// Require 给路由追加条件
+func (r *Route) Require(policies ...Policy) *Route {
+	if r.n.authz == nil {
+		r.n.authz = &routeAuthz{}
+	}
+	r.n.authz.policies = append(r.n.authz.policies, policies...)
+	return r
+}
+
+// Require 给路由组追加条件，组里面的路由包括子路由组的路由都要满足
+func (g *Group) Require(policies ...Policy) *Group {
+	g.policies = append(g.policies, policies...)
+	return g
+}
+
+type authzConfig struct {
+	allowUndeclared bool
+}
+
+type AuthzOption func(cfg *authzConfig)
+
+// WithAuthzAllowUndeclared 没有声明任何条件的路由是否放行，默认拒绝，
+// 避免新加的路由忘了声明权限就直接暴露出去
+func WithAuthzAllowUndeclared(allow bool) AuthzOption {
+	return func(cfg *authzConfig) {
+		cfg.allowUndeclared = allow
+	}
+}
+
+// Authorize 检查路由以及路由组通过 Require 声明的条件。
+// 需要放在 Authenticate 的内层，没有认证而路由又不允许匿名访问，或者匿名请求不满足条件的时候返回 401，
+// 认证过的请求不满足条件的时候返回 403，两者都交给 ErrorHandler 处理。找不到路由的请求直接放行
+//
+//	s.Use(Authenticate(authenticators, WithAuthOptional(true)), Authorize())
+func Authorize(opts ...AuthzOption) Middleware {
+	cfg := &authzConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			if ctx.MatchedRoute == "" {
+				next(ctx)
+				return
+			}
+			policies := ctx.authz.all()
+			if len(policies) == 0 {
+				if cfg.allowUndeclared {
+					next(ctx)
+					return
+				}
+				ctx.Error(&HTTPError{
+					Code:    http.StatusForbidden,
+					Message: http.StatusText(http.StatusForbidden),
+					Err:     errors.New("web: 路由没有声明权限 " + ctx.MatchedRoute),
+				})
+				return
+			}
+
+			p := ctx.principal
+			if p == nil && !anyAnonymous(policies) {
+				unauthorized(ctx)
+				return
+			}
+			for _, policy := range policies {
+				if policy.check(ctx, p) {
+					continue
+				}
+				// 匿名请求不满足条件，认证之后可能就满足了，所以返回 401 而不是 403
+				if p == nil {
+					unauthorized(ctx)
+					return
+				}
+				ctx.Error(&HTTPError{
+					Code:    http.StatusForbidden,
+					Message: http.StatusText(http.StatusForbidden),
+					Err:     errors.New("web: 不满足权限要求 " + policy.Name),
+				})
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// unauthorized 带上 Authenticate 留下的 WWW-Authenticate 返回 401
+func unauthorized(ctx *Context) {
+	for _, c := range ctx.authChallenges {
+		ctx.ResponseWriter.Header().Add("WWW-Authenticate", c)
+	}
+	ctx.Error(&HTTPError{
+		Code:    http.StatusUnauthorized,
+		Message: http.StatusText(http.StatusUnauthorized),
+		Err:     auth.ErrNoCredentials,
+	})
+}
+
+func anyAnonymous(policies []Policy) bool {
+	for _, policy := range policies {
+		if policy.anonymous {
+			return true
+		}
+	}
+	return false
+}
+
+// RoutePolicies 每个路由声明的条件，key 是 "方法 路由"，没有声明的路由对应空切片。
+// 一般在测试里面断言所有的路由都声明了预期的权限
+func (h *HTTPServer) RoutePolicies() map[string][]string {
+	res := make(map[string][]string)
+	for method, root := range h.trees {
+		walkRoutes(root, func(n *node) {
+			names := []string{}
+			for _, policy := range n.authz.all() {
+				names = append(names, policy.Name)
+			}
+			res[method+" "+n.route] = names
+		})
+	}
+	return res
+}
+
+func walkRoutes(n *node, fn func(n *node)) {
+	if n.handler != nil {
+		fn(n)
+	}
+	for _, child := range n.children {
+		walkRoutes(child, fn)
+	}
+	if n.paramChild != nil {
+		walkRoutes(n.paramChild, fn)
+	}
+	if n.starChild != nil {
+		walkRoutes(n.starChild, fn)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gofaquan/go-http/middleware/auth"
+)
+
+// assertRoutePolicies 断言每一个注册过的路由都声明了预期的权限，
+// 新加的路由没有写进 want 的时候测试会失败，避免忘了声明权限
+func assertRoutePolicies(t *testing.T, s *HTTPServer, want map[string][]string) {
+	t.Helper()
+	got := s.RoutePolicies()
+	for route, policies := range got {
+		if len(policies) == 0 {
+			t.Errorf("路由 %s 没有声明权限", route)
+		}
+	}
+	assert.Equal(t, want, got)
+}
+
+func newAuthzServer() *HTTPServer {
+	keys := auth.StaticAPIKeys(map[string]*auth.Principal{
+		"admin":  {Subject: "1", Roles: []string{"admin"}},
+		"alice":  {Subject: "2", Roles: []string{"user"}, Scopes: []string{"posts:write"}},
+		"reader": {Subject: "3", Roles: []string{"user"}},
+	})
+	s := NewHTTPServer("test", "")
+	s.Use(Authenticate([]auth.Authenticator{auth.NewAPIKeyAuth(keys)}, WithAuthOptional(true)), Authorize())
+	ok := func(ctx *Context) {
+		_ = ctx.StatusOK("ok")
+	}
+	s.Get("/health", ok).Require(AllowAnonymous())
+
+	users := s.Group("/users").Require(Authenticated())
+	users.Get("/:id", ok).Require(AnyOf(RequireRoles("admin"), RequireOwner("id")))
+	users.Post("/:id/posts", ok).Require(RequireOwner("id"), RequireScopes("posts:write"))
+	// 路由允许匿名访问，但是组要求认证
+	users.Get("/:id/avatar", ok).Require(AllowAnonymous())
+
+	admin := s.Group("/admin").Require(RequireRoles("admin"))
+	admin.Group("/reports").Get("/", ok)
+	return s
+}
+
+func TestAuthorize(t *testing.T) {
+	s := newAuthzServer()
+	s.Get("/undeclared", func(ctx *Context) { _ = ctx.StatusOK("ok") })
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		key      string
+		wantCode int
+	}{
+		{name: "anonymous public", method: http.MethodGet, path: "/health", wantCode: http.StatusOK},
+		{name: "undeclared", method: http.MethodGet, path: "/undeclared", key: "admin", wantCode: http.StatusForbidden},
+		{name: "not found", method: http.MethodGet, path: "/missing", wantCode: http.StatusNotFound},
+		{name: "anonymous private", method: http.MethodGet, path: "/users/2", wantCode: http.StatusUnauthorized},
+		{name: "anonymous fails group policy", method: http.MethodGet, path: "/users/2/avatar", wantCode: http.StatusUnauthorized},
+		{name: "authenticated passes group policy", method: http.MethodGet, path: "/users/2/avatar", key: "reader", wantCode: http.StatusOK},
+		{name: "owner", method: http.MethodGet, path: "/users/2", key: "alice", wantCode: http.StatusOK},
+		{name: "admin reads others", method: http.MethodGet, path: "/users/2", key: "admin", wantCode: http.StatusOK},
+		{name: "reads others", method: http.MethodGet, path: "/users/2", key: "reader", wantCode: http.StatusForbidden},
+		{name: "owner with scope", method: http.MethodPost, path: "/users/2/posts", key: "alice", wantCode: http.StatusOK},
+		{name: "owner without scope", method: http.MethodPost, path: "/users/3/posts", key: "reader", wantCode: http.StatusForbidden},
+		{name: "admin is not owner", method: http.MethodPost, path: "/users/2/posts", key: "admin", wantCode: http.StatusForbidden},
+		{name: "nested group", method: http.MethodGet, path: "/admin/reports", key: "admin", wantCode: http.StatusOK},
+		{name: "nested group forbidden", method: http.MethodGet, path: "/admin/reports", key: "alice", wantCode: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.key != "" {
+				req.Header.Set("X-API-Key", tc.key)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantCode == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", recorder.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	// 放行没有声明权限的路由
+	s = NewHTTPServer("test", "")
+	s.Use(Authorize(WithAuthzAllowUndeclared(true)))
+	s.Get("/", func(ctx *Context) { _ = ctx.StatusOK("ok") })
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestHTTPServer_RoutePolicies(t *testing.T) {
+	s := newAuthzServer()
+	assertRoutePolicies(t, s, map[string][]string{
+		"GET /health":           {"anonymous"},
+		"GET /users/:id":        {"authenticated", "any(roles(admin), owner(:id))"},
+		"POST /users/:id/posts": {"authenticated", "owner(:id)", "scopes(posts:write)"},
+		"GET /users/:id/avatar": {"authenticated", "anonymous"},
+		"GET /admin/reports":    {"roles(admin)"},
+	})
+
+	s.Get("/undeclared", func(ctx *Context) {})
+	assert.Equal(t, []string{}, s.RoutePolicies()["GET /undeclared"])
+}
+
+func TestGroup(t *testing.T) {
+	var order []string
+	mdl := func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				order = append(order, name)
+				next(ctx)
+			}
+		}
+	}
+	s := NewHTTPServer("test", "")
+	api := s.Group("/api", mdl("api"))
+	v1 := api.Group("/v1", mdl("v1"))
+	v1.Get("/", func(ctx *Context) { _ = ctx.StatusOK(ctx.MatchedRoute) })
+	v1.Get("/users/:id", func(ctx *Context) { _ = ctx.StatusOK(ctx.MatchedRoute) }, mdl("route"))
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil))
+	assert.Equal(t, "/api/v1/users/:id", recorder.Body.String())
+	assert.Equal(t, []string{"api", "v1", "route"}, order)
+
+	recorder = httptest.NewRecorder()
+	order = nil
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1", nil))
+	assert.Equal(t, "/api/v1", recorder.Body.String())
+	assert.Equal(t, []string{"api", "v1"}, order)
+
+	// 直接注册在组的路径下面的路由不经过组的中间件
+	s.Get("/api/v1/direct", func(ctx *Context) { _ = ctx.StatusOK("direct") })
+	order = nil
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/direct", nil))
+	assert.Equal(t, "direct", recorder.Body.String())
+	assert.Empty(t, order)
+
+	assert.Panics(t, func() { s.Group("api") })
+	assert.Panics(t, func() { s.Group("/api/") })
+	assert.Panics(t, func() { v1.Get("users", func(ctx *Context) {}) })
+}
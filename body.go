@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+var ErrBodyTooLarge = errors.New("web: 请求体超过大小限制")
+
+// WithMaxBodySize 服务器级别的请求体大小限制，小于等于 0 表示不限制，路由上可以用 MaxBodySize 覆盖
+func WithMaxBodySize(n int64) ServerOption {
+	return func(server *HTTPServer) {
+		server.maxBodySize = n
+	}
+}
+
+// MaxBodySize 路由级别的请求体大小限制，可以比服务器级别的限制更大或者更小，小于等于 0 表示不限制
+func MaxBodySize(n int64) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.limitBody(n)
+			next(ctx)
+		}
+	}
+}
+
+// limitBody 总是包装原始的请求体，所以后设置的限制会覆盖前面的
+func (c *Context) limitBody(n int64) {
+	if c.Request == nil || c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return
+	}
+	if c.rawBody == nil {
+		c.rawBody = c.Request.Body
+	}
+	if n <= 0 {
+		c.Request.Body = c.rawBody
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.ResponseWriter, c.rawBody, n)
+}
+
+// checkBodyErr 请求体超过限制的时候设置 413 响应并返回 ErrBodyTooLarge
+func (c *Context) checkBodyErr(err error) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		_ = c.ResponseWithString(http.StatusRequestEntityTooLarge, "413 REQUEST ENTITY TOO LARGE")
+		return ErrBodyTooLarge
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	s := NewHTTPServer("test", "", WithMaxBodySize(16))
+	handler := func(ctx *Context) {
+		var m map[string]string
+		if err := ctx.Bind(&m); err != nil {
+			assert.Equal(t, ErrBodyTooLarge, err)
+			return
+		}
+		_ = ctx.StatusOK(m["a"])
+	}
+	s.Post("/small", handler)
+	s.Post("/large", handler, MaxBodySize(64))
+	s.Post("/unlimited", handler, MaxBodySize(0))
+	s.Post("/form", func(ctx *Context) {
+		_, err := ctx.FormValue("a").String()
+		assert.Equal(t, ErrBodyTooLarge, err)
+	})
+
+	body := `{"a":"` + strings.Repeat("x", 20) + `"}`
+	testCases := []struct {
+		path     string
+		wantCode int
+	}{
+		{path: "/small", wantCode: http.StatusRequestEntityTooLarge},
+		{path: "/large", wantCode: http.StatusOK},
+		{path: "/unlimited", wantCode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(body))
+			req.Header.Set("Content-Type", MediaTypeJSON)
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader("a="+strings.Repeat("x", 20)))
+	req.Header.Set("Content-Type", MediaTypeForm)
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	req = newMultipartRequest(t, map[string]string{"a": strings.Repeat("x", 20)}, nil)
+	req.URL.Path = "/form"
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
+
+func TestJSONCodec_Decode(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+	}
+	type user struct {
+		Name    string  `json:"name"`
+		Age     int     `json:"age"`
+		Address address `json:"address"`
+	}
+
+	testCases := []struct {
+		name      string
+		opts      JSONOptions
+		body      string
+		wantErr   bool
+		wantField string
+		wantOff   int64
+		check     func(t *testing.T, u *user)
+	}{
+		{
+			name: "ok",
+			body: `{"name":"tom","age":18}`,
+			check: func(t *testing.T, u *user) {
+				assert.Equal(t, user{Name: "tom", Age: 18}, *u)
+			},
+		},
+		{
+			name:      "unknown field",
+			body:      `{"name":"tom","admin":true}`,
+			wantErr:   true,
+			wantField: "admin",
+		},
+		{
+			name: "allow unknown field",
+			opts: JSONOptions{AllowUnknownFields: true},
+			body: `{"name":"tom","admin":true}`,
+		},
+		{
+			name:      "type error",
+			body:      `{"name":"tom","address":{"city":1}}`,
+			wantErr:   true,
+			wantField: "address.city",
+			wantOff:   33,
+		},
+		{
+			name:    "syntax error",
+			body:    `{"name":"tom",}`,
+			wantErr: true,
+			wantOff: 15,
+		},
+		{
+			name: "trailing data allowed by default",
+			body: `{"name":"tom"} {"name":"jerry"}`,
+		},
+		{
+			name:    "trailing data",
+			opts:    JSONOptions{DisallowTrailingData: true},
+			body:    `{"name":"tom"} {"name":"jerry"}`,
+			wantErr: true,
+		},
+		{
+			name:    "trailing garbage",
+			opts:    JSONOptions{DisallowTrailingData: true},
+			body:    `{"name":"tom"} x`,
+			wantErr: true,
+		},
+		{
+			name: "trailing whitespace",
+			opts: JSONOptions{DisallowTrailingData: true},
+			body: "{\"name\":\"tom\"}\n\t ",
+		},
+		{
+			name:    "too deep",
+			opts:    JSONOptions{MaxDepth: 2},
+			body:    `{"address":{"city":"[{\"x\"}]"},"name":[[1]]}`,
+			wantErr: true,
+			wantOff: 40,
+		},
+		{
+			name: "deep string is fine",
+			opts: JSONOptions{MaxDepth: 2},
+			body: `{"address":{"city":"[[[[{{"}}`,
+			check: func(t *testing.T, u *user) {
+				assert.Equal(t, "[[[[{{", u.Address.City)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &user{}
+			err := JSONCodec{JSONOptions: tc.opts}.Decode(strings.NewReader(tc.body), u)
+			if !tc.wantErr {
+				require.NoError(t, err)
+				if tc.check != nil {
+					tc.check(t, u)
+				}
+				return
+			}
+			var bindErr *BindError
+			require.ErrorAs(t, err, &bindErr)
+			assert.Equal(t, tc.wantField, bindErr.Field)
+			if tc.wantOff > 0 {
+				assert.Equal(t, tc.wantOff, bindErr.Offset)
+			}
+		})
+	}
+}
+
+func TestWithJSONOptions(t *testing.T) {
+	s := NewHTTPServer("test", "", WithJSONOptions(JSONOptions{UseNumber: true, AllowUnknownFields: true}))
+	s.Post("/", func(ctx *Context) {
+		var m map[string]any
+		require.NoError(t, ctx.BindJSON(&m))
+		n, ok := m["id"].(json.Number)
+		require.True(t, ok)
+		_ = ctx.StatusOK(n.String())
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":12345678901234567890}`)))
+	assert.Equal(t, "12345678901234567890", recorder.Body.String())
+
+	// BindError 可以拿到原始错误
+	err := JSONCodec{}.Decode(strings.NewReader(`{"a":1}`), &struct{}{})
+	var bindErr *BindError
+	require.True(t, errors.As(err, &bindErr))
+	assert.Contains(t, err.Error(), "字段 a")
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gofaquan/go-http/codec/msgpack"
+)
+
+const (
+	MediaTypeJSON       = "application/json"
+	MediaTypeXML        = "application/xml"
+	MediaTypeTextXML    = "text/xml"
+	MediaTypeForm       = "application/x-www-form-urlencoded"
+	MediaTypePlain      = "text/plain"
+	MediaTypeMsgpack    = "application/msgpack"
+	MediaTypeXMsgpack   = "application/x-msgpack"
+	MediaTypeVndMsgpack = "application/vnd.msgpack"
+)
+
+var (
+	ErrUnsupportedMediaType = errors.New("web: 不支持的 Content-Type")
+	ErrNotAcceptable        = errors.New("web: 没有满足 Accept 的编码方式")
+)
+
+// Codec 负责一种媒体类型的编解码
+type Codec interface {
+	// MediaType 返回响应时使用的 Content-Type，例如 application/json
+	MediaType() string
+	Encode(val any) ([]byte, error)
+	Decode(r io.Reader, val any) error
+}
+
+// WithCodec 注册或者覆盖编解码器，aliases 是额外匹配的媒体类型，例如 text/xml
+func WithCodec(c Codec, aliases ...string) ServerOption {
+	return func(server *HTTPServer) {
+		server.codecs.register(c.MediaType(), c)
+		for _, alias := range aliases {
+			server.codecs.register(alias, c)
+		}
+	}
+}
+
+// codecRegistry 按照媒体类型索引编解码器，注册顺序决定通配符匹配时的优先级
+type codecRegistry struct {
+	codecs map[string]Codec
+	order  []string
+}
+
+func newCodecRegistry() *codecRegistry {
+	return &codecRegistry{codecs: map[string]Codec{}}
+}
+
+func defaultCodecRegistry() *codecRegistry {
+	r := newCodecRegistry()
+	r.register(MediaTypeJSON, JSONCodec{})
+	r.register(MediaTypeXML, XMLCodec{})
+	r.register(MediaTypeTextXML, XMLCodec{})
+	r.register(MediaTypeForm, FormCodec{})
+	r.register(MediaTypePlain, PlainCodec{})
+	r.register(MediaTypeMsgpack, MsgpackCodec{})
+	r.register(MediaTypeXMsgpack, MsgpackCodec{})
+	r.register(MediaTypeVndMsgpack, MsgpackCodec{})
+	return r
+}
+
+func (r *codecRegistry) register(mediaType string, c Codec) {
+	mediaType = strings.ToLower(mediaType)
+	if _, ok := r.codecs[mediaType]; !ok {
+		r.order = append(r.order, mediaType)
+	}
+	r.codecs[mediaType] = c
+}
+
+// lookup 根据 Content-Type 查找解码器，参数部分（charset 之类）会被忽略
+func (r *codecRegistry) lookup(contentType string) (Codec, bool) {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	c, ok := r.codecs[strings.ToLower(strings.TrimSpace(mediaType))]
+	return c, ok
+}
+
+// negotiate 根据 Accept 头部选择编码器，Accept 为空的时候使用第一个注册的编码器
+func (r *codecRegistry) negotiate(accept string) (Codec, bool) {
+	if len(r.order) == 0 {
+		return nil, false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return r.codecs[r.order[0]], true
+	}
+
+	ranges := parseAccept(accept)
+	var (
+		best      Codec
+		bestQ     float64
+		bestRange int
+	)
+	for _, mt := range r.order {
+		// RFC 9110 12.5.1 媒体类型的 q 值由匹配它的最具体的一项决定，
+		// 所以 application/*;q=0 会拒绝 application/json，即使后面还有 */*
+		idx := -1
+		for i, ar := range ranges {
+			if !ar.match(mt) {
+				continue
+			}
+			// 同样具体的时候 q 值小的优先，明确的拒绝不能被另外一项覆盖
+			if idx < 0 || ar.specificity() > ranges[idx].specificity() ||
+				(ar.specificity() == ranges[idx].specificity() && ar.q < ranges[idx].q) {
+				idx = i
+			}
+		}
+		if idx < 0 || ranges[idx].q == 0 {
+			continue
+		}
+		// q 值相同的时候选在 Accept 里面排在前面的，再相同就按照注册的顺序
+		if q := ranges[idx].q; best == nil || q > bestQ || (q == bestQ && idx < bestRange) {
+			best, bestQ, bestRange = r.codecs[mt], q, idx
+		}
+	}
+	return best, best != nil
+}
+
+// mediaTypes 返回所有注册过的媒体类型，用于 406 响应里面提示客户端
+func (r *codecRegistry) mediaTypes() []string {
+	return r.order
+}
+
+// JSONOptions JSON 解码的选项，零值和之前的行为保持一致：不允许未知字段，允许尾随数据，不限制深度
+type JSONOptions struct {
+	// AllowUnknownFields 允许请求里面出现结构体没有的字段
+	AllowUnknownFields bool
+	// UseNumber 解码到 any 的时候数字保存成 json.Number，避免大整数丢失精度
+	UseNumber bool
+	// DisallowTrailingData 第一个 JSON 值后面还有数据（空白除外）的时候报错
+	DisallowTrailingData bool
+	// MaxDepth 对象和数组最多嵌套多少层，小于等于 0 表示不限制
+	MaxDepth int
+}
+
+// WithJSONOptions 设置 JSON 解码选项，对 Bind 和 BindJSON 都生效
+func WithJSONOptions(opts JSONOptions) ServerOption {
+	return WithCodec(JSONCodec{JSONOptions: opts})
+}
+
+// JSONCodec application/json，解码出错的时候返回 *BindError
+type JSONCodec struct {
+	JSONOptions
+}
+
+func (JSONCodec) MediaType() string {
+	return MediaTypeJSON
+}
+
+func (JSONCodec) Encode(val any) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+func (j JSONCodec) Decode(r io.Reader, val any) error {
+	if j.MaxDepth > 0 {
+		// 需要先检查深度再解码，否则深度很大的请求仍然会消耗大量的栈和内存
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if offset, ok := checkJSONDepth(data, j.MaxDepth); !ok {
+			return &BindError{Offset: offset, Err: fmt.Errorf("嵌套深度超过 %d", j.MaxDepth)}
+		}
+		r = bytes.NewReader(data)
+	}
+
+	decoder := json.NewDecoder(r)
+	if !j.AllowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if j.UseNumber {
+		decoder.UseNumber()
+	}
+	if err := decoder.Decode(val); err != nil {
+		return jsonBindError(err, decoder)
+	}
+	if j.DisallowTrailingData {
+		if _, err := decoder.Token(); err != io.EOF {
+			if err == nil || isSyntaxError(err) {
+				return &BindError{Offset: decoder.InputOffset(), Err: errors.New("JSON 后面还有多余的数据")}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func isSyntaxError(err error) bool {
+	var se *json.SyntaxError
+	return errors.As(err, &se)
+}
+
+// BindError 请求体解析失败，Field 是出错的字段（可能为空），Offset 是出错的位置（字节）
+type BindError struct {
+	Field  string
+	Offset int64
+	Err    error
+}
+
+func (e *BindError) Error() string {
+	msg := "web: 解析请求体失败"
+	if e.Field != "" {
+		msg += ", 字段 " + e.Field
+	}
+	return msg + ", 位置 " + strconv.FormatInt(e.Offset, 10) + ": " + e.Err.Error()
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// jsonBindError 把 encoding/json 的错误转换成 BindError，读取请求体本身的错误原样返回
+func jsonBindError(err error, decoder *json.Decoder) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		field := typeErr.Field
+		if field == "" {
+			field = typeErr.Struct
+		}
+		return &BindError{Field: field, Offset: typeErr.Offset, Err: err}
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &BindError{Offset: syntaxErr.Offset, Err: err}
+	}
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return &BindError{Offset: decoder.InputOffset(), Err: err}
+	}
+	// encoding/json 没有导出未知字段的错误类型，只能从错误信息里面取
+	if msg := err.Error(); strings.HasPrefix(msg, "json: unknown field ") {
+		field, _ := strconv.Unquote(strings.TrimPrefix(msg, "json: unknown field "))
+		return &BindError{Field: field, Offset: decoder.InputOffset(), Err: err}
+	}
+	return err
+}
+
+// checkJSONDepth 超过 maxDepth 的时候返回出错的位置，字符串里面的括号不算
+func checkJSONDepth(data []byte, maxDepth int) (int64, bool) {
+	depth := 0
+	inString := false
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		if inString {
+			switch b {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > maxDepth {
+				return int64(i), false
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return 0, true
+}
+
+// XMLCodec application/xml 和 text/xml
+type XMLCodec struct{}
+
+func (XMLCodec) MediaType() string {
+	return MediaTypeXML
+}
+
+func (XMLCodec) Encode(val any) ([]byte, error) {
+	return xml.Marshal(val)
+}
+
+func (XMLCodec) Decode(r io.Reader, val any) error {
+	return xml.NewDecoder(r).Decode(val)
+}
+
+// MsgpackCodec 使用手写的 msgpack 包
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) MediaType() string {
+	return MediaTypeMsgpack
+}
+
+func (MsgpackCodec) Encode(val any) ([]byte, error) {
+	return msgpack.Marshal(val)
+}
+
+func (MsgpackCodec) Decode(r io.Reader, val any) error {
+	return msgpack.NewDecoder(r).Decode(val)
+}
+
+// PlainCodec text/plain，只支持字符串和字节切片
+type PlainCodec struct{}
+
+func (PlainCodec) MediaType() string {
+	return MediaTypePlain
+}
+
+func (PlainCodec) Encode(val any) ([]byte, error) {
+	switch v := val.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	case error:
+		return []byte(v.Error()), nil
+	}
+	return []byte(fmt.Sprint(val)), nil
+}
+
+func (PlainCodec) Decode(r io.Reader, val any) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	switch v := val.(type) {
+	case *string:
+		*v = string(data)
+	case *[]byte:
+		*v = data
+	default:
+		return fmt.Errorf("web: text/plain 只能解码到 *string 或者 *[]byte，实际是 %T", val)
+	}
+	return nil
+}
+
+// FormCodec application/x-www-form-urlencoded
+// 解码到结构体的时候使用 `form:"name"` 标签，没有标签则使用字段名
+type FormCodec struct{}
+
+func (FormCodec) MediaType() string {
+	return MediaTypeForm
+}
+
+func (FormCodec) Encode(val any) ([]byte, error) {
+	switch v := val.(type) {
+	case url.Values:
+		return []byte(v.Encode()), nil
+	case map[string]string:
+		vals := url.Values{}
+		for k, s := range v {
+			vals.Set(k, s)
+		}
+		return []byte(vals.Encode()), nil
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(val))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("web: 表单无法编码类型 %T", val)
+	}
+	vals := url.Values{}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		name := formFieldName(sf)
+		if name == "" {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Slice {
+			for j := 0; j < fv.Len(); j++ {
+				vals.Add(name, fmt.Sprint(fv.Index(j).Interface()))
+			}
+			continue
+		}
+		vals.Set(name, fmt.Sprint(fv.Interface()))
+	}
+	return []byte(vals.Encode()), nil
+}
+
+func (FormCodec) Decode(r io.Reader, val any) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	vals, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	return bindValues(vals, val)
+}
+
+// bindValues 把 url.Values 绑定到 val 上
+func bindValues(vals url.Values, val any) error {
+	switch v := val.(type) {
+	case *url.Values:
+		*v = vals
+		return nil
+	case *map[string][]string:
+		*v = vals
+		return nil
+	case *map[string]string:
+		if *v == nil {
+			*v = make(map[string]string, len(vals))
+		}
+		for k := range vals {
+			(*v)[k] = vals.Get(k)
+		}
+		return nil
+	}
+
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("web: 表单只能解码到结构体指针，实际是 %T", val)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		name := formFieldName(sf)
+		if name == "" {
+			continue
+		}
+		strs, ok := vals[name]
+		if !ok || len(strs) == 0 {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Slice {
+			s := reflect.MakeSlice(fv.Type(), len(strs), len(strs))
+			for j, str := range strs {
+				if err := setString(s.Index(j), str); err != nil {
+					return fmt.Errorf("web: 表单字段 %s: %w", name, err)
+				}
+			}
+			fv.Set(s)
+			continue
+		}
+		if err := setString(fv, strs[0]); err != nil {
+			return fmt.Errorf("web: 表单字段 %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func formFieldName(sf reflect.StructField) string {
+	if !sf.IsExported() {
+		return ""
+	}
+	tag := sf.Tag.Get("form")
+	if tag == "-" {
+		return ""
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name
+	}
+	return sf.Name
+}
+
+// setString 把字符串转换成 v 的类型并赋值
+func setString(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("不支持的类型 %s", v.Type())
+	}
+	return nil
+}
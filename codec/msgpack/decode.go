@@ -0,0 +1,541 @@
+package msgpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// maxDepth 嵌套层数上限，防止恶意数据把栈打爆
+const maxDepth = 1000
+
+var errTooDeep = errors.New("msgpack: 嵌套层数过深")
+
+// Unmarshal 把 MessagePack 数据解码到 v，v 必须是非 nil 指针
+func Unmarshal(data []byte, v any) error {
+	d := NewDecoder(bytes.NewReader(data))
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if d.r.(*bytes.Reader).Len() > 0 {
+		return errors.New("msgpack: 数据末尾有多余的内容")
+	}
+	return nil
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// Decoder 从 io.Reader 里面读取并解码
+type Decoder struct {
+	r byteReader
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{r: br}
+}
+
+// Decode 读取下一个值并解码到 v
+func (d *Decoder) Decode(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("msgpack: Decode 的参数必须是非 nil 指针")
+	}
+	val, err := d.readValue(0)
+	if err != nil {
+		return err
+	}
+	return assign(rv.Elem(), val)
+}
+
+// mapValue 解码的中间结果，保留 key 的原始类型和顺序
+type mapValue []kv
+
+type kv struct {
+	key any
+	val any
+}
+
+// readValue 把下一个值解码成中间结果：
+// nil, bool, int64, uint64, float64, string, []byte, []any, mapValue, time.Time
+func (d *Decoder) readValue(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, errTooDeep
+	}
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c <= PosFixIntMax:
+		return int64(c), nil
+	case c >= NegFixIntMin:
+		return int64(int8(c)), nil
+	case c >= FixMapMin && c <= FixMapMax:
+		return d.readMap(int(c&0x0f), depth)
+	case c >= FixArrayMin && c <= FixArrayMax:
+		return d.readArray(int(c&0x0f), depth)
+	case c >= FixStrMin && c <= FixStrMax:
+		b, err := d.readN(int(c & 0x1f))
+		return string(b), err
+	}
+
+	switch c {
+	case Nil:
+		return nil, nil
+	case False:
+		return false, nil
+	case True:
+		return true, nil
+	case Uint8, Uint16, Uint32, Uint64:
+		u, err := d.readUint(c)
+		if err != nil {
+			return nil, err
+		}
+		if u > math.MaxInt64 {
+			return u, nil
+		}
+		return int64(u), nil
+	case Int8:
+		u, err := d.readUint(Uint8)
+		return int64(int8(u)), err
+	case Int16:
+		u, err := d.readUint(Uint16)
+		return int64(int16(u)), err
+	case Int32:
+		u, err := d.readUint(Uint32)
+		return int64(int32(u)), err
+	case Int64:
+		u, err := d.readUint(Uint64)
+		return int64(u), err
+	case Float32:
+		u, err := d.readUint(Uint32)
+		return float64(math.Float32frombits(uint32(u))), err
+	case Float64:
+		u, err := d.readUint(Uint64)
+		return math.Float64frombits(u), err
+	case Str8, Str16, Str32:
+		l, err := d.readLen(c - Str8)
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.readN(l)
+		return string(b), err
+	case Bin8, Bin16, Bin32:
+		l, err := d.readLen(c - Bin8)
+		if err != nil {
+			return nil, err
+		}
+		return d.readN(l)
+	case Array16, Array32:
+		l, err := d.readLen(c - Array16 + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.readArray(l, depth)
+	case Map16, Map32:
+		l, err := d.readLen(c - Map16 + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.readMap(l, depth)
+	case FixExt1, FixExt2, FixExt4, FixExt8, FixExt16:
+		return d.readExt(1 << (c - FixExt1))
+	case Ext8, Ext16, Ext32:
+		l, err := d.readLen(c - Ext8)
+		if err != nil {
+			return nil, err
+		}
+		return d.readExt(l)
+	}
+	return nil, fmt.Errorf("msgpack: 非法的格式前缀 0x%x", c)
+}
+
+// readLen 读取长度字段，size 为 0、1、2 时分别对应 8、16、32 位
+func (d *Decoder) readLen(size byte) (int, error) {
+	u, err := d.readUint(Uint8 + size)
+	return int(u), err
+}
+
+func (d *Decoder) readUint(c byte) (uint64, error) {
+	var buf [8]byte
+	n := 1 << (c - Uint8)
+	if _, err := io.ReadFull(d.r, buf[:n]); err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(buf[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(buf[:])), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(buf[:])), nil
+	default:
+		return binary.BigEndian.Uint64(buf[:]), nil
+	}
+}
+
+// readN 读取 n 个字节。长度字段不可信，大块数据边读边扩容，避免一次性分配
+func (d *Decoder) readN(n int) ([]byte, error) {
+	if n <= 64*1024 {
+		b := make([]byte, n)
+		_, err := io.ReadFull(d.r, b)
+		return b, err
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *Decoder) readArray(l int, depth int) ([]any, error) {
+	res := make([]any, 0, min(l, 1024))
+	for i := 0; i < l; i++ {
+		v, err := d.readValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+func (d *Decoder) readMap(l int, depth int) (mapValue, error) {
+	res := make(mapValue, 0, min(l, 1024))
+	for i := 0; i < l; i++ {
+		k, err := d.readValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.readValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, kv{key: k, val: v})
+	}
+	return res, nil
+}
+
+func (d *Decoder) readExt(l int) (any, error) {
+	typ, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.readN(l)
+	if err != nil {
+		return nil, err
+	}
+	if typ != timestampExt {
+		return nil, fmt.Errorf("msgpack: 不支持的扩展类型 %d", int8(typ))
+	}
+	switch l {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), nil
+	case 8:
+		u := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data[:4])
+		sec := binary.BigEndian.Uint64(data[4:])
+		return time.Unix(int64(sec), int64(nsec)), nil
+	}
+	return nil, fmt.Errorf("msgpack: 非法的时间戳长度 %d", l)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// assign 把中间结果写入目标
+func assign(dst reflect.Value, val any) error {
+	if val == nil {
+		switch dst.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+			dst.Set(reflect.Zero(dst.Type()))
+		}
+		return nil
+	}
+
+	if dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(dst.Elem(), val)
+	}
+
+	if dst.Kind() == reflect.Interface {
+		if dst.NumMethod() != 0 {
+			return typeErr(val, dst.Type())
+		}
+		g, err := generic(val)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(g))
+		return nil
+	}
+
+	if dst.Type() == timeType {
+		t, ok := val.(time.Time)
+		if !ok {
+			return typeErr(val, dst.Type())
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if s, ok := val.(string); ok && dst.CanAddr() && dst.Addr().Type().Implements(textUnmarshalerType) {
+		return dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v := val.(type) {
+	case bool:
+		if dst.Kind() != reflect.Bool {
+			return typeErr(val, dst.Type())
+		}
+		dst.SetBool(v)
+	case int64:
+		return assignInt(dst, v)
+	case uint64:
+		switch dst.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if dst.OverflowUint(v) {
+				return overflowErr(val, dst.Type())
+			}
+			dst.SetUint(v)
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(float64(v))
+		default:
+			return typeErr(val, dst.Type())
+		}
+	case float64:
+		if dst.Kind() != reflect.Float32 && dst.Kind() != reflect.Float64 {
+			return typeErr(val, dst.Type())
+		}
+		dst.SetFloat(v)
+	case string:
+		switch {
+		case dst.Kind() == reflect.String:
+			dst.SetString(v)
+		case dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8:
+			dst.SetBytes([]byte(v))
+		default:
+			return typeErr(val, dst.Type())
+		}
+	case []byte:
+		switch {
+		case dst.Kind() == reflect.String:
+			dst.SetString(string(v))
+		case dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8:
+			dst.SetBytes(v)
+		case dst.Kind() == reflect.Array && dst.Type().Elem().Kind() == reflect.Uint8:
+			if len(v) != dst.Len() {
+				return typeErr(val, dst.Type())
+			}
+			reflect.Copy(dst, reflect.ValueOf(v))
+		default:
+			return typeErr(val, dst.Type())
+		}
+	case []any:
+		return assignArray(dst, v)
+	case mapValue:
+		return assignMap(dst, v)
+	case time.Time:
+		return typeErr(val, dst.Type())
+	}
+	return nil
+}
+
+func assignInt(dst reflect.Value, v int64) error {
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if dst.OverflowInt(v) {
+			return overflowErr(v, dst.Type())
+		}
+		dst.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v < 0 || dst.OverflowUint(uint64(v)) {
+			return overflowErr(v, dst.Type())
+		}
+		dst.SetUint(uint64(v))
+	case reflect.Float32, reflect.Float64:
+		dst.SetFloat(float64(v))
+	default:
+		return typeErr(v, dst.Type())
+	}
+	return nil
+}
+
+func assignArray(dst reflect.Value, v []any) error {
+	switch dst.Kind() {
+	case reflect.Slice:
+		s := reflect.MakeSlice(dst.Type(), len(v), len(v))
+		for i, e := range v {
+			if err := assign(s.Index(i), e); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+	case reflect.Array:
+		if len(v) > dst.Len() {
+			return typeErr(v, dst.Type())
+		}
+		for i, e := range v {
+			if err := assign(dst.Index(i), e); err != nil {
+				return err
+			}
+		}
+	default:
+		return typeErr(v, dst.Type())
+	}
+	return nil
+}
+
+func assignMap(dst reflect.Value, v mapValue) error {
+	switch dst.Kind() {
+	case reflect.Map:
+		t := dst.Type()
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(t, len(v)))
+		}
+		for _, e := range v {
+			k := reflect.New(t.Key()).Elem()
+			if err := assign(k, e.key); err != nil {
+				return err
+			}
+			if !k.Type().Comparable() {
+				return fmt.Errorf("msgpack: map 的 key 类型 %s 不可比较", k.Type())
+			}
+			val := reflect.New(t.Elem()).Elem()
+			if err := assign(val, e.val); err != nil {
+				return err
+			}
+			dst.SetMapIndex(k, val)
+		}
+	case reflect.Struct:
+		fields := cachedFields(dst.Type())
+		for _, e := range v {
+			name, ok := e.key.(string)
+			if !ok {
+				return fmt.Errorf("msgpack: 结构体 %s 的 key 必须是字符串", dst.Type())
+			}
+			f := lookupField(fields, name)
+			if f == nil {
+				// 未知字段直接忽略
+				continue
+			}
+			fv := fieldByIndexAlloc(dst, f.index)
+			if err := assign(fv, e.val); err != nil {
+				return fmt.Errorf("msgpack: 字段 %s: %w", f.name, err)
+			}
+		}
+	default:
+		return typeErr(v, dst.Type())
+	}
+	return nil
+}
+
+func lookupField(fields []field, name string) *field {
+	for i := range fields {
+		if fields[i].name == name {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, name) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// fieldByIndexAlloc 遇到 nil 的内嵌指针时自动分配
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, idx := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+	return v
+}
+
+// generic 把中间结果转换成解码到 any 时的结果
+func generic(val any) (any, error) {
+	switch v := val.(type) {
+	case []any:
+		for i, e := range v {
+			g, err := generic(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = g
+		}
+		return v, nil
+	case mapValue:
+		allString := true
+		for _, e := range v {
+			if _, ok := e.key.(string); !ok {
+				allString = false
+				break
+			}
+		}
+		if allString {
+			res := make(map[string]any, len(v))
+			for _, e := range v {
+				g, err := generic(e.val)
+				if err != nil {
+					return nil, err
+				}
+				res[e.key.(string)] = g
+			}
+			return res, nil
+		}
+		res := make(map[any]any, len(v))
+		for _, e := range v {
+			if e.key != nil && !reflect.TypeOf(e.key).Comparable() {
+				return nil, errors.New("msgpack: map 的 key 不可比较")
+			}
+			g, err := generic(e.val)
+			if err != nil {
+				return nil, err
+			}
+			res[e.key] = g
+		}
+		return res, nil
+	}
+	return val, nil
+}
+
+func typeErr(val any, t reflect.Type) error {
+	return fmt.Errorf("msgpack: 无法把 %T 解码到 %s", val, t)
+}
+
+func overflowErr(val any, t reflect.Type) error {
+	return fmt.Errorf("msgpack: %v 超出了 %s 的范围", val, t)
+}
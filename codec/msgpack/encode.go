@@ -0,0 +1,311 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Marshal 把 v 编码成 MessagePack
+func Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Encoder 把值编码后写入 io.Writer
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+	// 对 map 的 key 排序，保证输出稳定
+	sortMapKeys bool
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, sortMapKeys: true}
+}
+
+// Encode 编码一个值，编码完成之后才写入底层的 io.Writer
+func (e *Encoder) Encode(v any) error {
+	e.buf = e.buf[:0]
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func (e *Encoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.writeNil()
+		return nil
+	}
+
+	if v.Type() == timeType {
+		e.writeTime(v.Interface().(time.Time))
+		return nil
+	}
+	if v.Kind() == reflect.Struct && v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		e.writeString(string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			e.writeNil()
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, True)
+		} else {
+			e.buf = append(e.buf, False)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.writeUint(v.Uint())
+	case reflect.Float32:
+		e.buf = append(e.buf, Float32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.buf = append(e.buf, Float64)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v.Float()))
+	case reflect.String:
+		e.writeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.writeNil()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.writeBytes(v.Bytes())
+			return nil
+		}
+		return e.encodeArray(v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			e.writeBytes(b)
+			return nil
+		}
+		return e.encodeArray(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.writeNil()
+			return nil
+		}
+		return e.encodeMap(v)
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	default:
+		return fmt.Errorf("msgpack: 不支持编码类型 %s", v.Type())
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArray(v reflect.Value) error {
+	e.writeArrayLen(v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMap(v reflect.Value) error {
+	keys := v.MapKeys()
+	if e.sortMapKeys {
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+	}
+	e.writeMapLen(len(keys))
+	for _, k := range keys {
+		if err := e.encode(k); err != nil {
+			return err
+		}
+		if err := e.encode(v.MapIndex(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeStruct(v reflect.Value) error {
+	fields := cachedFields(v.Type())
+	vals := make([]reflect.Value, 0, len(fields))
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && fv.IsZero()) {
+			continue
+		}
+		vals = append(vals, fv)
+		names = append(names, f.name)
+	}
+	e.writeMapLen(len(vals))
+	for i, fv := range vals {
+		e.writeString(names[i])
+		if err := e.encode(fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex 和 reflect.Value.FieldByIndex 类似，但是遇到 nil 的内嵌指针不会 panic
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, idx := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+	return v, true
+}
+
+func (e *Encoder) writeNil() {
+	e.buf = append(e.buf, Nil)
+}
+
+func (e *Encoder) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		e.writeUint(uint64(i))
+	case i >= -32:
+		e.buf = append(e.buf, byte(i))
+	case i >= math.MinInt8:
+		e.buf = append(e.buf, Int8, byte(i))
+	case i >= math.MinInt16:
+		e.buf = append(e.buf, Int16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(i))
+	case i >= math.MinInt32:
+		e.buf = append(e.buf, Int32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(i))
+	default:
+		e.buf = append(e.buf, Int64)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(i))
+	}
+}
+
+func (e *Encoder) writeUint(u uint64) {
+	switch {
+	case u <= uint64(PosFixIntMax):
+		e.buf = append(e.buf, byte(u))
+	case u <= math.MaxUint8:
+		e.buf = append(e.buf, Uint8, byte(u))
+	case u <= math.MaxUint16:
+		e.buf = append(e.buf, Uint16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(u))
+	case u <= math.MaxUint32:
+		e.buf = append(e.buf, Uint32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(u))
+	default:
+		e.buf = append(e.buf, Uint64)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, u)
+	}
+}
+
+func (e *Encoder) writeString(s string) {
+	l := len(s)
+	switch {
+	case l < 32:
+		e.buf = append(e.buf, FixStrMin|byte(l))
+	case l <= math.MaxUint8:
+		e.buf = append(e.buf, Str8, byte(l))
+	case l <= math.MaxUint16:
+		e.buf = append(e.buf, Str16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(l))
+	default:
+		e.buf = append(e.buf, Str32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(l))
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *Encoder) writeBytes(b []byte) {
+	l := len(b)
+	switch {
+	case l <= math.MaxUint8:
+		e.buf = append(e.buf, Bin8, byte(l))
+	case l <= math.MaxUint16:
+		e.buf = append(e.buf, Bin16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(l))
+	default:
+		e.buf = append(e.buf, Bin32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(l))
+	}
+	e.buf = append(e.buf, b...)
+}
+
+func (e *Encoder) writeArrayLen(l int) {
+	switch {
+	case l < 16:
+		e.buf = append(e.buf, FixArrayMin|byte(l))
+	case l <= math.MaxUint16:
+		e.buf = append(e.buf, Array16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(l))
+	default:
+		e.buf = append(e.buf, Array32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(l))
+	}
+}
+
+func (e *Encoder) writeMapLen(l int) {
+	switch {
+	case l < 16:
+		e.buf = append(e.buf, FixMapMin|byte(l))
+	case l <= math.MaxUint16:
+		e.buf = append(e.buf, Map16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(l))
+	default:
+		e.buf = append(e.buf, Map32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(l))
+	}
+}
+
+// writeTime 使用规范里面的 timestamp 扩展类型（-1）
+func (e *Encoder) writeTime(t time.Time) {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	switch {
+	case sec>>34 == 0 && nsec == 0:
+		// timestamp 32
+		e.buf = append(e.buf, FixExt4, timestampExt)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(sec))
+	case sec>>34 == 0:
+		// timestamp 64
+		e.buf = append(e.buf, FixExt8, timestampExt)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(nsec)<<34|uint64(sec))
+	default:
+		// timestamp 96
+		e.buf = append(e.buf, Ext8, 12, timestampExt)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(nsec))
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(sec))
+	}
+}
@@ -0,0 +1,113 @@
+// Package msgpack 是一个手写的 MessagePack 编解码实现，
+// 规范见 https://github.com/msgpack/msgpack/blob/master/spec.md
+//
+// 结构体按照 map 编码，字段名通过 `msgpack:"name,omitempty"` 标签指定，
+// 没有标签的时候使用字段名。time.Time 使用 timestamp 扩展类型。
+package msgpack
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// 格式前缀
+const (
+	PosFixIntMax byte = 0x7f
+	FixMapMin    byte = 0x80
+	FixMapMax    byte = 0x8f
+	FixArrayMin  byte = 0x90
+	FixArrayMax  byte = 0x9f
+	FixStrMin    byte = 0xa0
+	FixStrMax    byte = 0xbf
+	Nil          byte = 0xc0
+	False        byte = 0xc2
+	True         byte = 0xc3
+	Bin8         byte = 0xc4
+	Bin16        byte = 0xc5
+	Bin32        byte = 0xc6
+	Ext8         byte = 0xc7
+	Ext16        byte = 0xc8
+	Ext32        byte = 0xc9
+	Float32      byte = 0xca
+	Float64      byte = 0xcb
+	Uint8        byte = 0xcc
+	Uint16       byte = 0xcd
+	Uint32       byte = 0xce
+	Uint64       byte = 0xcf
+	Int8         byte = 0xd0
+	Int16        byte = 0xd1
+	Int32        byte = 0xd2
+	Int64        byte = 0xd3
+	FixExt1      byte = 0xd4
+	FixExt2      byte = 0xd5
+	FixExt4      byte = 0xd6
+	FixExt8      byte = 0xd7
+	FixExt16     byte = 0xd8
+	Str8         byte = 0xd9
+	Str16        byte = 0xda
+	Str32        byte = 0xdb
+	Array16      byte = 0xdc
+	Array32      byte = 0xdd
+	Map16        byte = 0xde
+	Map32        byte = 0xdf
+	NegFixIntMin byte = 0xe0
+)
+
+// timestampExt 规范预留的时间戳扩展类型 -1
+const timestampExt byte = 0xff
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+func cachedFields(t reflect.Type) []field {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.([]field)
+	}
+	fs, _ := fieldCache.LoadOrStore(t, typeFields(t, nil))
+	return fs.([]field)
+}
+
+// typeFields 解析结构体的字段，没有打标签的内嵌结构体会被展开
+func typeFields(t reflect.Type, parent []int) []field {
+	res := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("msgpack")
+		if tag == "-" {
+			continue
+		}
+		index := make([]int, len(parent)+1)
+		copy(index, parent)
+		index[len(parent)] = i
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				res = append(res, typeFields(ft, index)...)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		res = append(res, field{
+			name:      name,
+			index:     index,
+			omitEmpty: opts == "omitempty",
+		})
+	}
+	return res
+}
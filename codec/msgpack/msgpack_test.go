@@ -0,0 +1,140 @@
+package msgpack
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Inner struct {
+	Tags []string `msgpack:"tags"`
+}
+
+type User struct {
+	Inner
+	ID       int64             `msgpack:"id"`
+	Name     string            `msgpack:"name"`
+	Email    string            `msgpack:"email,omitempty"`
+	Score    float64           `msgpack:"score"`
+	Active   bool              `msgpack:"active"`
+	Avatar   []byte            `msgpack:"avatar"`
+	Attrs    map[string]string `msgpack:"attrs"`
+	Created  time.Time         `msgpack:"created"`
+	Ignored  string            `msgpack:"-"`
+	internal int
+}
+
+func TestMarshal_Format(t *testing.T) {
+	testCases := []struct {
+		name string
+		val  any
+		want []byte
+	}{
+		{name: "nil", val: nil, want: []byte{0xc0}},
+		{name: "true", val: true, want: []byte{0xc3}},
+		{name: "false", val: false, want: []byte{0xc2}},
+		{name: "positive fixint", val: 127, want: []byte{0x7f}},
+		{name: "negative fixint", val: -32, want: []byte{0xe0}},
+		{name: "uint8", val: 200, want: []byte{0xcc, 0xc8}},
+		{name: "int8", val: -100, want: []byte{0xd0, 0x9c}},
+		{name: "uint16", val: 1000, want: []byte{0xcd, 0x03, 0xe8}},
+		{name: "int16", val: -1000, want: []byte{0xd1, 0xfc, 0x18}},
+		{name: "uint32", val: uint32(1 << 20), want: []byte{0xce, 0x00, 0x10, 0x00, 0x00}},
+		{name: "uint64", val: uint64(math.MaxUint64), want: []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "float64", val: 1.5, want: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{name: "float32", val: float32(1.5), want: []byte{0xca, 0x3f, 0xc0, 0, 0}},
+		{name: "fixstr", val: "abc", want: []byte{0xa3, 'a', 'b', 'c'}},
+		{name: "bin", val: []byte{1, 2}, want: []byte{0xc4, 0x02, 1, 2}},
+		{name: "fixarray", val: []int{1, 2}, want: []byte{0x92, 0x01, 0x02}},
+		{name: "fixmap", val: map[string]int{"a": 1}, want: []byte{0x81, 0xa1, 'a', 0x01}},
+		{name: "timestamp32", val: time.Unix(1, 0), want: []byte{0xd6, 0xff, 0, 0, 0, 1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := Marshal(tc.val)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, data)
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	u := User{
+		Inner:   Inner{Tags: []string{"a", "b"}},
+		ID:      -12345678901,
+		Name:    "Tom",
+		Score:   99.5,
+		Active:  true,
+		Avatar:  []byte{0xde, 0xad},
+		Attrs:   map[string]string{"lang": "go"},
+		Created: time.Unix(1675580000, 123456789),
+		Ignored: "x",
+	}
+	data, err := Marshal(u)
+	require.NoError(t, err)
+
+	var got User
+	require.NoError(t, Unmarshal(data, &got))
+	assert.Equal(t, u.Inner, got.Inner)
+	assert.Equal(t, u.ID, got.ID)
+	assert.Equal(t, u.Name, got.Name)
+	assert.Equal(t, "", got.Email)
+	assert.Equal(t, u.Score, got.Score)
+	assert.True(t, got.Active)
+	assert.Equal(t, u.Avatar, got.Avatar)
+	assert.Equal(t, u.Attrs, got.Attrs)
+	assert.True(t, u.Created.Equal(got.Created))
+	assert.Equal(t, "", got.Ignored)
+}
+
+func TestUnmarshal_Any(t *testing.T) {
+	data, err := Marshal(map[string]any{
+		"list": []any{1, "x", nil},
+		"big":  uint64(math.MaxUint64),
+		"neg":  -1,
+	})
+	require.NoError(t, err)
+
+	var got any
+	require.NoError(t, Unmarshal(data, &got))
+	assert.Equal(t, map[string]any{
+		"list": []any{int64(1), "x", nil},
+		"big":  uint64(math.MaxUint64),
+		"neg":  int64(-1),
+	}, got)
+}
+
+func TestUnmarshal_Error(t *testing.T) {
+	var i8 int8
+	assert.Error(t, Unmarshal([]byte{0xcd, 0x03, 0xe8}, &i8), "溢出")
+
+	var s string
+	assert.Error(t, Unmarshal([]byte{0x01}, &s), "类型不匹配")
+	assert.Error(t, Unmarshal([]byte{0xa3, 'a'}, &s), "数据不完整")
+	assert.Error(t, Unmarshal([]byte{0xc1}, &s), "非法前缀")
+	assert.Error(t, Unmarshal([]byte{0x01, 0x02}, &i8), "多余数据")
+	assert.Error(t, Unmarshal([]byte{0x01}, i8), "非指针")
+
+	deep := bytes.Repeat([]byte{0x91}, maxDepth+2)
+	var v any
+	assert.ErrorIs(t, Unmarshal(append(deep, 0xc0), &v), errTooDeep)
+}
+
+func TestDecoder_Stream(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	require.NoError(t, enc.Encode("first"))
+	require.NoError(t, enc.Encode(2))
+
+	dec := NewDecoder(&buf)
+	var s string
+	var i int
+	require.NoError(t, dec.Decode(&s))
+	require.NoError(t, dec.Decode(&i))
+	assert.Equal(t, "first", s)
+	assert.Equal(t, 2, i)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofaquan/go-http/codec/msgpack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type codecUser struct {
+	Name string `json:"name" xml:"name" form:"name" msgpack:"name"`
+	Age  int    `json:"age" xml:"age" form:"age" msgpack:"age"`
+}
+
+func Test_parseAccept(t *testing.T) {
+	ranges := parseAccept("text/*;q=0.5, application/json, */*;q=0.1, text/html;level=1;q=0.5, bad, a/b;q=2")
+	got := make([]string, 0, len(ranges))
+	for _, ar := range ranges {
+		got = append(got, ar.mediaType())
+	}
+	assert.Equal(t, []string{"application/json", "text/html", "text/*", "*/*"}, got)
+}
+
+func Test_codecRegistry_negotiate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		accept string
+		want   string
+		found  bool
+	}{
+		{name: "empty", accept: "", want: MediaTypeJSON, found: true},
+		{name: "exact", accept: "application/xml", want: MediaTypeXML, found: true},
+		{name: "q value", accept: "application/json;q=0.4, application/msgpack;q=0.9", want: MediaTypeMsgpack, found: true},
+		{name: "type wildcard", accept: "text/*", want: MediaTypeXML, found: true},
+		{name: "any", accept: "*/*", want: MediaTypeJSON, found: true},
+		{name: "any but rejected", accept: "application/json;q=0, */*", want: MediaTypeXML, found: true},
+		{name: "browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: MediaTypeXML, found: true},
+		{name: "type wildcard rejected", accept: "application/*;q=0, */*", want: MediaTypeXML, found: true},
+		{name: "type wildcard rejected plain", accept: "application/*;q=0, text/plain", want: MediaTypePlain, found: true},
+		// 更具体的一项优先，不管 q 值大小
+		{name: "more specific wins", accept: "application/*;q=0, application/msgpack;q=0.5", want: MediaTypeMsgpack, found: true},
+		{name: "specific rejected", accept: "application/*, application/json;q=0", want: MediaTypeXML, found: true},
+		{name: "all rejected", accept: "*/*;q=0"},
+		// 参数不影响匹配，也不能让一项更具体
+		{name: "rejected with parameters", accept: "application/json;q=0, application/json;charset=foo"},
+		{name: "parameters", accept: "application/json;charset=utf-8", want: MediaTypeJSON, found: true},
+		{name: "not acceptable", accept: "image/png"},
+	}
+
+	r := defaultCodecRegistry()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, ok := r.negotiate(tc.accept)
+			assert.Equal(t, tc.found, ok)
+			if !ok {
+				return
+			}
+			assert.Equal(t, tc.want, c.MediaType())
+		})
+	}
+}
+
+func TestContext_Bind(t *testing.T) {
+	mp, err := msgpack.Marshal(codecUser{Name: "Tom", Age: 18})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		contentType string
+		body        []byte
+		wantUser    codecUser
+		wantCode    int
+	}{
+		{name: "json", contentType: "application/json; charset=utf-8", body: []byte(`{"name":"Tom","age":18}`),
+			wantUser: codecUser{Name: "Tom", Age: 18}, wantCode: http.StatusOK},
+		{name: "no content type", body: []byte(`{"name":"Tom","age":18}`),
+			wantUser: codecUser{Name: "Tom", Age: 18}, wantCode: http.StatusOK},
+		{name: "xml", contentType: "text/xml", body: []byte(`<codecUser><name>Tom</name><age>18</age></codecUser>`),
+			wantUser: codecUser{Name: "Tom", Age: 18}, wantCode: http.StatusOK},
+		{name: "form", contentType: MediaTypeForm, body: []byte(`name=Tom&age=18`),
+			wantUser: codecUser{Name: "Tom", Age: 18}, wantCode: http.StatusOK},
+		{name: "msgpack", contentType: MediaTypeXMsgpack, body: mp,
+			wantUser: codecUser{Name: "Tom", Age: 18}, wantCode: http.StatusOK},
+		{name: "unsupported", contentType: "application/yaml", body: []byte(`name: Tom`),
+			wantCode: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer("test", "")
+			var u codecUser
+			s.Post("/user", func(ctx *Context) {
+				if err := ctx.Bind(&u); err != nil {
+					return
+				}
+				_ = ctx.StatusOK("ok")
+			})
+			req := httptest.NewRequest(http.MethodPost, "/user", bytes.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantUser, u)
+		})
+	}
+}
+
+func TestContext_Render(t *testing.T) {
+	testCases := []struct {
+		name            string
+		accept          string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{name: "default json", wantCode: http.StatusOK, wantContentType: MediaTypeJSON,
+			wantBody: `{"name":"Tom","age":18}`},
+		{name: "xml", accept: "application/xml", wantCode: http.StatusOK, wantContentType: MediaTypeXML,
+			wantBody: `<codecUser><name>Tom</name><age>18</age></codecUser>`},
+		{name: "form", accept: "application/x-www-form-urlencoded", wantCode: http.StatusOK, wantContentType: MediaTypeForm,
+			wantBody: `age=18&name=Tom`},
+		{name: "plain", accept: "text/plain", wantCode: http.StatusOK, wantContentType: "text/plain; charset=utf-8",
+			wantBody: `{Tom 18}`},
+		{name: "not acceptable", accept: "image/png", wantCode: http.StatusNotAcceptable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer("test", "")
+			s.Get("/user", func(ctx *Context) {
+				_ = ctx.Render(http.StatusOK, codecUser{Name: "Tom", Age: 18})
+			})
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			req.Header.Set("Accept", tc.accept)
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, "Accept", recorder.Header().Get("Vary"))
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tc.wantContentType, recorder.Header().Get("Content-Type"))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+type upperCodec struct {
+	PlainCodec
+}
+
+func (upperCodec) MediaType() string {
+	return "text/upper"
+}
+
+func (u upperCodec) Encode(val any) ([]byte, error) {
+	data, err := u.PlainCodec.Encode(val)
+	return []byte(strings.ToUpper(string(data))), err
+}
+
+func TestWithCodec(t *testing.T) {
+	s := NewHTTPServer("test", "", WithCodec(upperCodec{}, "text/x-upper"))
+	s.Get("/", func(ctx *Context) {
+		_ = ctx.Render(http.StatusOK, "hello")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/x-upper")
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, "HELLO", recorder.Body.String())
+	assert.Equal(t, "text/upper; charset=utf-8", recorder.Header().Get("Content-Type"))
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// encoder gzip.Writer 和 zlib.Writer 共同的方法
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+type compressConfig struct {
+	level   int
+	minSize int
+	types   []string
+	pools   map[string]*sync.Pool
+}
+
+type CompressOption func(cfg *compressConfig)
+
+// WithCompressLevel 压缩级别，取值和 compress/flate 一样，默认 gzip.DefaultCompression
+func WithCompressLevel(level int) CompressOption {
+	return func(cfg *compressConfig) {
+		cfg.level = level
+	}
+}
+
+// WithCompressMinSize 响应体小于 size 字节的时候不压缩，默认 1024
+// 流式响应只有设置了 Content-Length 的时候才会检查
+func WithCompressMinSize(size int) CompressOption {
+	return func(cfg *compressConfig) {
+		cfg.minSize = size
+	}
+}
+
+// WithCompressTypes 需要压缩的 Content-Type，支持 text/* 这种写法，会覆盖默认的类型
+func WithCompressTypes(types ...string) CompressOption {
+	return func(cfg *compressConfig) {
+		cfg.types = cfg.types[:0]
+		for _, t := range types {
+			cfg.types = append(cfg.types, strings.ToLower(t))
+		}
+	}
+}
+
+var defaultCompressTypes = []string{
+	"text/html", "text/plain", "text/css", "text/javascript", "text/xml", "text/csv",
+	"application/json", "application/javascript", "application/xml", "image/svg+xml",
+}
+
+// Compress 根据 Accept-Encoding 使用 gzip 或者 deflate 压缩响应
+// 普通响应在 handler 返回之后压缩 ResponseData，流式响应（ctx.Writer、ctx.File 等）在发送响应头的时候决定是否压缩。
+// 已经设置了 Content-Encoding 的响应、206 以及不允许有响应体的响应不会被压缩。
+// text/event-stream 默认不压缩，需要的话通过 WithCompressTypes 加上
+func Compress(opts ...CompressOption) Middleware {
+	cfg := &compressConfig{
+		level:   gzip.DefaultCompression,
+		minSize: 1024,
+		types:   append([]string(nil), defaultCompressTypes...),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if _, err := gzip.NewWriterLevel(io.Discard, cfg.level); err != nil {
+		panic(fmt.Sprintf("web: 非法的压缩级别 %d", cfg.level))
+	}
+	cfg.pools = map[string]*sync.Pool{
+		EncodingGzip: {New: func() any {
+			w, _ := gzip.NewWriterLevel(io.Discard, cfg.level)
+			return w
+		}},
+		EncodingDeflate: {New: func() any {
+			w, _ := zlib.NewWriterLevel(io.Discard, cfg.level)
+			return w
+		}},
+	}
+
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			encoding := ""
+			if ctx.Request.Method != http.MethodHead {
+				encoding = negotiateEncoding(ctx.Request.Header.Values("Accept-Encoding"))
+			}
+			cw := &compressWriter{
+				ResponseWriter: ctx.ResponseWriter,
+				cfg:            cfg,
+				encoding:       encoding,
+			}
+			ctx.response()
+			ctx.ResponseWriter = cw
+			defer func() {
+				ctx.ResponseWriter = cw.ResponseWriter
+			}()
+
+			next(ctx)
+
+			if cw.decided {
+				cw.close()
+				return
+			}
+			if ctx.Committed() {
+				return
+			}
+			cfg.compressBuffered(ctx, encoding)
+		}
+	}
+}
+
+// compressBuffered handler 把响应放在 ResponseData 里面，直接压缩 ResponseData
+func (cfg *compressConfig) compressBuffered(ctx *Context, encoding string) {
+	header := ctx.ResponseWriter.Header()
+	status := ctx.StatusCode
+	if status <= 0 {
+		status = http.StatusOK
+	}
+	// 不压缩的时候 Content-Type 留给 net/http 识别，压缩之后就只能在这里识别了
+	contentType, sniffed := header.Get("Content-Type"), false
+	if contentType == "" && len(ctx.ResponseData) > 0 {
+		contentType, sniffed = http.DetectContentType(ctx.ResponseData), true
+	}
+	if !cfg.eligible(header, contentType, status, len(ctx.ResponseData)) {
+		return
+	}
+	header.Add("Vary", "Accept-Encoding")
+	if encoding == "" {
+		return
+	}
+
+	buf := compressBufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	enc := cfg.getEncoder(encoding, buf)
+	_, err := enc.Write(ctx.ResponseData)
+	if err == nil {
+		err = enc.Close()
+	}
+	cfg.pools[encoding].Put(enc)
+	if err != nil {
+		compressBufPool.Put(buf)
+		return
+	}
+	if sniffed {
+		header.Set("Content-Type", contentType)
+	}
+	setEncodingHeaders(header, encoding)
+	ctx.ResponseData = buf.Bytes()
+	// ResponseData 写回去之后才能复用 buf
+	ctx.addCleanup(func() {
+		if buf.Cap() <= maxPooledCompressBuf {
+			compressBufPool.Put(buf)
+		}
+	})
+}
+
+// eligible 响应是否需要压缩，和客户端支持什么压缩算法无关
+func (cfg *compressConfig) eligible(header http.Header, contentType string, status int, size int) bool {
+	if !bodyAllowedForStatus(status) || status == http.StatusPartialContent {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if size >= 0 && size < cfg.minSize {
+		return false
+	}
+	return cfg.matchType(contentType)
+}
+
+func (cfg *compressConfig) matchType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range cfg.types {
+		if t == mediaType {
+			return true
+		}
+		if strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *compressConfig) getEncoder(encoding string, w io.Writer) encoder {
+	enc := cfg.pools[encoding].Get().(encoder)
+	enc.Reset(w)
+	return enc
+}
+
+// setEncodingHeaders 压缩之后长度变了，Range 也不再适用，强 ETag 要变成弱 ETag
+func setEncodingHeaders(header http.Header, encoding string) {
+	header.Set("Content-Encoding", encoding)
+	header.Del("Content-Length")
+	header.Del("Accept-Ranges")
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+const maxPooledCompressBuf = 1 << 20
+
+var compressBufPool = sync.Pool{
+	New: func() any {
+		return &bytes.Buffer{}
+	},
+}
+
+// compressWriter 流式响应的时候包装 ctx.ResponseWriter，在发送响应头的时候决定是否压缩
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      *compressConfig
+	encoding string
+	decided  bool
+	enc      encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.decided = true
+	header := w.Header()
+	size := -1
+	if cl := header.Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil {
+			size = n
+		}
+	}
+	if w.cfg.eligible(header, header.Get("Content-Type"), code, size) {
+		header.Add("Vary", "Accept-Encoding")
+		if w.encoding != "" {
+			setEncodingHeaders(header, w.encoding)
+			w.enc = w.cfg.getEncoder(w.encoding, w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush 先把压缩器里面的数据刷出去，再刷底层的 ResponseWriter
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.enc != nil {
+		_ = w.enc.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close 写入压缩数据的结尾并且把压缩器放回池里面
+func (w *compressWriter) close() {
+	if w.enc == nil {
+		return
+	}
+	_ = w.enc.Close()
+	w.cfg.pools[w.encoding].Put(w.enc)
+	w.enc = nil
+}
+
+// negotiateEncoding 按照 q 值选择压缩算法，q 值相同的时候优先 gzip，都不接受的时候返回空字符串
+func negotiateEncoding(values []string) string {
+	gzipQ, deflateQ, anyQ := -1.0, -1.0, -1.0
+	for _, line := range values {
+		for _, part := range strings.Split(line, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			q := 1.0
+			if key, val, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+				var err error
+				q, err = strconv.ParseFloat(strings.TrimSpace(val), 64)
+				if err != nil || q < 0 || q > 1 {
+					continue
+				}
+			}
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "gzip", "x-gzip":
+				gzipQ = q
+			case "deflate":
+				deflateQ = q
+			case "*":
+				anyQ = q
+			}
+		}
+	}
+	if gzipQ < 0 {
+		gzipQ = anyQ
+	}
+	if deflateQ < 0 {
+		deflateQ = anyQ
+	}
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return EncodingGzip
+	case deflateQ > 0:
+		return EncodingDeflate
+	}
+	return ""
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decompress(t *testing.T, encoding string, data []byte) string {
+	var r io.Reader
+	var err error
+	switch encoding {
+	case EncodingGzip:
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case EncodingDeflate:
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return string(data)
+	}
+	require.NoError(t, err)
+	res, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(res)
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("hello world ", 200)
+	s := NewHTTPServer("test", "")
+	s.Use(Compress(WithCompressMinSize(100)))
+	s.Get("/large", func(ctx *Context) {
+		ctx.ResponseWriter.Header().Set("ETag", `"v1"`)
+		_ = ctx.StatusOK(large)
+	})
+	s.Get("/small", func(ctx *Context) {
+		_ = ctx.StatusOK("small")
+	})
+	s.Get("/png", func(ctx *Context) {
+		ctx.ResponseWriter.Header().Set("Content-Type", "image/png")
+		_ = ctx.StatusOK(large)
+	})
+	s.Get("/encoded", func(ctx *Context) {
+		ctx.ResponseWriter.Header().Set("Content-Encoding", "br")
+		_ = ctx.StatusOK(large)
+	})
+	s.Get("/stream", func(ctx *Context) {
+		ctx.ResponseWriter.Header().Set("Content-Type", "text/plain")
+		_ = ctx.Stream(func(w io.Writer) error {
+			for i := 0; i < 3; i++ {
+				_, _ = io.WriteString(w, "chunk ")
+				ctx.Writer().Flush()
+			}
+			return nil
+		})
+	})
+
+	testCases := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+		wantVary       bool
+		wantBody       string
+	}{
+		{
+			name:           "gzip",
+			path:           "/large",
+			acceptEncoding: "gzip, deflate",
+			wantEncoding:   EncodingGzip,
+			wantVary:       true,
+			wantBody:       large,
+		},
+		{
+			name:           "deflate by q",
+			path:           "/large",
+			acceptEncoding: "gzip;q=0.5, deflate",
+			wantEncoding:   EncodingDeflate,
+			wantVary:       true,
+			wantBody:       large,
+		},
+		{
+			name:     "no accept encoding",
+			path:     "/large",
+			wantVary: true,
+			wantBody: large,
+		},
+		{
+			name:           "gzip refused",
+			path:           "/large",
+			acceptEncoding: "*, gzip;q=0, deflate;q=0",
+			wantVary:       true,
+			wantBody:       large,
+		},
+		{
+			name:           "below threshold",
+			path:           "/small",
+			acceptEncoding: "gzip",
+			wantBody:       "small",
+		},
+		{
+			name:           "type not configured",
+			path:           "/png",
+			acceptEncoding: "gzip",
+			wantBody:       large,
+		},
+		{
+			name:           "already encoded",
+			path:           "/encoded",
+			acceptEncoding: "gzip",
+			wantEncoding:   "br",
+			wantBody:       large,
+		},
+		{
+			name:           "stream",
+			path:           "/stream",
+			acceptEncoding: "gzip",
+			wantEncoding:   EncodingGzip,
+			wantVary:       true,
+			wantBody:       "chunk chunk chunk ",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			header := recorder.Header()
+			assert.Equal(t, tc.wantEncoding, header.Get("Content-Encoding"))
+			assert.Equal(t, tc.wantVary, header.Get("Vary") == "Accept-Encoding")
+			if tc.wantEncoding == EncodingGzip || tc.wantEncoding == EncodingDeflate {
+				if cl := header.Get("Content-Length"); cl != "" {
+					assert.Equal(t, cl, strconv.Itoa(recorder.Body.Len()))
+				}
+				if tc.path == "/large" {
+					assert.Equal(t, `W/"v1"`, header.Get("ETag"))
+				}
+			}
+			assert.Equal(t, tc.wantBody, decompress(t, tc.wantEncoding, recorder.Body.Bytes()))
+		})
+	}
+}
+
+// TestCompress_SniffContentType 只有压缩的时候才需要提前识别 Content-Type
+func TestCompress_SniffContentType(t *testing.T) {
+	var contentType string
+	s := NewHTTPServer("test", "")
+	s.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			contentType = ctx.ResponseWriter.Header().Get("Content-Type")
+		}
+	}, Compress(WithCompressMinSize(100)))
+	s.Get("/large", func(ctx *Context) {
+		_ = ctx.StatusOK(strings.Repeat("hello world ", 200))
+	})
+	s.Get("/small", func(ctx *Context) {
+		_ = ctx.StatusOK("small")
+	})
+
+	testCases := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		wantType       string
+	}{
+		{
+			name:           "compressed",
+			path:           "/large",
+			acceptEncoding: "gzip",
+			wantType:       "text/plain; charset=utf-8",
+		},
+		{
+			name: "no accept encoding",
+			path: "/large",
+		},
+		{
+			name:           "below threshold",
+			path:           "/small",
+			acceptEncoding: "gzip",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			contentType = ""
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			s.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tc.wantType, contentType)
+		})
+	}
+}
+
+// TestCompress_File 文件的 Content-Length 由 http.ServeContent 设置，压缩的时候必须删掉，Range 请求不压缩
+func TestCompress_File(t *testing.T) {
+	content := strings.Repeat("a", 4096)
+	s := NewHTTPServer("test", "")
+	s.Use(Compress())
+	s.Get("/file", func(ctx *Context) {
+		ctx.ServeContent("a.txt", time.Time{}, strings.NewReader(content))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/file", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, EncodingGzip, recorder.Header().Get("Content-Encoding"))
+	assert.Empty(t, recorder.Header().Get("Content-Length"))
+	assert.Empty(t, recorder.Header().Get("Accept-Ranges"))
+	assert.Equal(t, content, decompress(t, EncodingGzip, recorder.Body.Bytes()))
+
+	req = httptest.NewRequest(http.MethodGet, "/file", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=0-9")
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusPartialContent, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Content-Encoding"))
+	assert.Equal(t, "aaaaaaaaaa", recorder.Body.String())
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	testCases := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "gzip", want: EncodingGzip},
+		{header: "x-gzip", want: EncodingGzip},
+		{header: "deflate, gzip", want: EncodingGzip},
+		{header: "deflate", want: EncodingDeflate},
+		{header: "gzip;q=0.2, deflate;q=0.8", want: EncodingDeflate},
+		{header: "*", want: EncodingGzip},
+		{header: "*;q=0.5, gzip;q=0", want: EncodingDeflate},
+		{header: "identity", want: ""},
+		{header: "br, gzip;q=abc", want: ""},
+		{header: "GZIP ; Q=0.7", want: EncodingGzip},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.header, func(t *testing.T) {
+			assert.Equal(t, tc.want, negotiateEncoding([]string{tc.header}))
+		})
+	}
+}
+
+func BenchmarkCompress(b *testing.B) {
+	s := NewHTTPServer("bench", "")
+	s.Use(Compress())
+	body := []byte(strings.Repeat("hello world ", 200))
+	s.Get("/", func(ctx *Context) {
+		ctx.ResponseWriter.Header().Set("Content-Type", "text/plain")
+		ctx.StatusCode = http.StatusOK
+		ctx.ResponseData = body
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.ServeHTTP(&discardResponseWriter{header: http.Header{}}, req)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "sync"
+
+// longLivedConn SSE、WebSocket 这类会一直占用请求的连接，
+// 优雅退出的时候需要主动通知它们关闭，否则等待请求完结会一直等到超时
+type longLivedConn interface {
+	shutdown()
+}
+
+type connTracker struct {
+	mu     sync.Mutex
+	conns  map[longLivedConn]struct{}
+	closed bool
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: map[longLivedConn]struct{}{}}
+}
+
+// add 开始跟踪连接，已经开始关闭的时候返回 false
+func (t *connTracker) add(c longLivedConn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	t.conns[c] = struct{}{}
+	return true
+}
+
+func (t *connTracker) remove(c longLivedConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, c)
+}
+
+func (t *connTracker) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
+
+// closeAll 通知所有连接关闭，之后新的连接会被拒绝
+func (t *connTracker) closeAll() {
+	t.mu.Lock()
+	t.closed = true
+	conns := make([]longLivedConn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+
+	for _, c := range conns {
+		c.shutdown()
+	}
+}
@@ -3,72 +3,251 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"net/netip"
 	"net/url"
-	"strconv"
+	"strings"
+
+	"github.com/gofaquan/go-http/middleware/auth"
+	"github.com/gofaquan/go-http/middleware/session"
+	"github.com/gofaquan/go-http/middleware/tracing"
 )
 
+// Context 会被复用，handler 返回之后不能再使用，需要在 goroutine 里面用到的数据要先复制出来
 type Context struct {
 	Request        *http.Request
 	ResponseWriter http.ResponseWriter
 
 	StatusCode   int
 	ResponseData []byte
-	PathParams   map[string]string
+	PathParams   Params
 
 	MatchedRoute string
 
 	cacheQueryValues url.Values
+
+	codecs *codecRegistry
+
+	// resp 框架的 ResponseWriter，记录响应有没有提交。
+	// 从池里面取出来的 Context 指向 rw，避免每个请求都分配一次
+	resp   *ResponseWriter
+	rw     ResponseWriter
+	stream *StreamWriter
+	// flushed flushResponse 已经把 ResponseData 写回去了
+	flushed bool
+
+	conns *connTracker
+	// cleanups 在请求处理完毕、响应写回之后执行
+	cleanups []func()
+
+	uploadLimits uploadLimits
+	formParsed   bool
+	formErr      error
+
+	templateEngine  TemplateEngine
+	redirectHosts   map[string]struct{}
+	cookieKeys      *cookieKeyring
+	trustedProxies  []netip.Prefix
+	forwardedHeader ForwardedHeader
+	// rawBody 没有被 MaxBytesReader 包装过的请求体
+	rawBody io.ReadCloser
+
+	sess *session.Session
+
+	requestID       string
+	requestIDHeader string
+
+	tracer tracing.Tracer
+	span   tracing.Span
+
+	principal *auth.Principal
+	// authChallenges 可选认证没有拿到凭证的时候留给 Authorize 返回 401 用
+	authChallenges []string
+	authz          *routeAuthz
+
+	csrf *csrfConfig
+	// csrfToken 当前请求的原始 CSRF token，延迟生成
+	csrfToken []byte
+
+	errorHandler ErrorHandler
 }
 
 type HandleFunc func(ctx *Context)
 
+// reset 放回池里面之前清空上一个请求的数据，PathParams 和 cleanups 的底层数组会被复用
+func (c *Context) reset() {
+	params := c.PathParams[:0]
+	for i := range c.PathParams {
+		c.PathParams[i] = Param{}
+	}
+	cleanups := c.cleanups[:0]
+	for i := range c.cleanups {
+		c.cleanups[i] = nil
+	}
+	*c = Context{
+		PathParams: params,
+		cleanups:   cleanups,
+	}
+}
+
+// BindJSON 不管 Content-Type 是什么都按照 JSON 解码，选项见 WithJSONOptions
 func (c *Context) BindJSON(val any) error {
 	if c.Request.Body == nil {
 		return errors.New("request body 为 nil")
 	}
 
-	decoder := json.NewDecoder(c.Request.Body)
-	decoder.DisallowUnknownFields() // 出现无法解析的字段报错
-	return decoder.Decode(val)
+	codec, ok := c.codecRegistry().lookup(MediaTypeJSON)
+	if !ok {
+		codec = JSONCodec{}
+	}
+	return c.checkBodyErr(codec.Decode(c.Request.Body, val))
 }
 
-type StringVal struct {
-	val string
-	err error
+// Bind 根据请求的 Content-Type 选择解码器，没有 Content-Type 的时候使用默认的编解码器
+// 不支持的 Content-Type 会返回 415 以及 ErrUnsupportedMediaType
+func (c *Context) Bind(val any) error {
+	if c.Request.Body == nil {
+		return errors.New("request body 为 nil")
+	}
+
+	registry := c.codecRegistry()
+	contentType := c.Request.Header.Get("Content-Type")
+	var codec Codec
+	if contentType == "" {
+		codec, _ = registry.negotiate("")
+	} else {
+		codec, _ = registry.lookup(contentType)
+	}
+	if codec == nil {
+		_ = c.ResponseWithString(http.StatusUnsupportedMediaType, "415 UNSUPPORTED MEDIA TYPE")
+		return ErrUnsupportedMediaType
+	}
+	return c.checkBodyErr(codec.Decode(c.Request.Body, val))
 }
 
-func (c *Context) FormValue(key string) StringVal {
-	if err := c.Request.ParseMultipartForm(1024); err != nil {
-		return StringVal{err: err}
+// Render 根据请求的 Accept 选择编码器，支持 q 值
+// 没有满足 Accept 的编码器时返回 406 以及 ErrNotAcceptable
+func (c *Context) Render(code int, val any) error {
+	registry := c.codecRegistry()
+	header := c.ResponseWriter.Header()
+	header.Add("Vary", "Accept")
+	codec, ok := registry.negotiate(c.Request.Header.Get("Accept"))
+	if !ok {
+		_ = c.ResponseWithString(http.StatusNotAcceptable,
+			"406 NOT ACCEPTABLE, 支持 "+strings.Join(registry.mediaTypes(), ", "))
+		return ErrNotAcceptable
+	}
+
+	bytes, err := codec.Encode(val)
+	if err != nil {
+		return err
 	}
+	contentType := codec.MediaType()
+	if strings.HasPrefix(contentType, "text/") {
+		contentType += "; charset=utf-8"
+	}
+	header.Set("Content-Type", contentType)
+	c.StatusCode = code
+	c.ResponseData = bytes
+	return nil
+}
 
-	if err := c.Request.ParseForm(); err != nil {
-		return StringVal{err: err}
+// Writer 进入流式响应模式，立刻把响应头和状态码（默认 200）发送给客户端
+// 之后写入的数据不经过 ResponseData，而是直接写给客户端；之前已经设置的 ResponseData 会先被写出
+func (c *Context) Writer() *StreamWriter {
+	if c.stream != nil {
+		return c.stream
 	}
+	if c.StatusCode == 0 {
+		c.StatusCode = http.StatusOK
+	}
+	// 通过 ctx.ResponseWriter 发送响应头，这样包装它的中间件（例如压缩）能够在提交之前修改响应头
+	c.response()
+	c.ResponseWriter.WriteHeader(c.StatusCode)
+	c.stream = &StreamWriter{w: c.ResponseWriter}
+	if len(c.ResponseData) > 0 {
+		_, _ = c.stream.Write(c.ResponseData)
+		c.ResponseData = nil
+	}
+	return c.stream
+}
 
-	return StringVal{val: c.Request.FormValue(key)}
+// Stream 以流式响应的方式执行 fn，fn 返回之后会 Flush 一次
+func (c *Context) Stream(fn func(w io.Writer) error) error {
+	w := c.Writer()
+	err := fn(w)
+	w.Flush()
+	return err
+}
+
+// Committed 响应是否已经直接发送给了客户端，
+// 返回 true 的时候修改 StatusCode 和 ResponseData 都不会再生效
+func (c *Context) Committed() bool {
+	return c.response().Committed()
+}
+
+func (c *Context) addCleanup(fn func()) {
+	c.cleanups = append(c.cleanups, fn)
+}
+
+func (c *Context) runCleanups() {
+	for _, fn := range c.cleanups {
+		fn()
+	}
+}
+
+func (c *Context) codecRegistry() *codecRegistry {
+	if c.codecs == nil {
+		c.codecs = defaultCodecRegistry()
+	}
+	return c.codecs
+}
+
+func (c *Context) FormValue(key string) StringVal {
+	if err := c.parseForm(); err != nil {
+		return StringVal{key: key, err: err}
+	}
+
+	return StringVal{key: key, val: c.Request.FormValue(key)}
 }
 
 func (c *Context) QueryValue(key string) StringVal {
-	if c.cacheQueryValues == nil {
-		c.cacheQueryValues = c.Request.URL.Query()
+	valSlice, ok := c.queryValues()[key]
+	if !ok {
+		return StringVal{key: key, err: ErrKeyNotFound}
 	}
+	return StringVal{key: key, val: valSlice[0]}
+}
 
-	valSlice, ok := c.cacheQueryValues[key]
+// QueryValues 获取查询参数的所有值，例如 ?id=1&id=2
+func (c *Context) QueryValues(key string) StringsVal {
+	valSlice, ok := c.queryValues()[key]
 	if !ok {
-		return StringVal{err: errors.New("找不到对应 key")}
+		return StringsVal{key: key, err: ErrKeyNotFound}
+	}
+	return StringsVal{key: key, vals: valSlice}
+}
+
+// QueryInts 获取查询参数的所有值并转换成 int
+func (c *Context) QueryInts(key string) ([]int, error) {
+	return c.QueryValues(key).ToInts()
+}
+
+func (c *Context) queryValues() url.Values {
+	if c.cacheQueryValues == nil {
+		c.cacheQueryValues = c.Request.URL.Query()
 	}
-	return StringVal{val: valSlice[0]}
+	return c.cacheQueryValues
 }
 
 func (c *Context) PathValue(key string) StringVal {
-	val, ok := c.PathParams[key]
+	val, ok := c.PathParams.Get(key)
 	if !ok {
-		return StringVal{err: errors.New("找不到对应 key")}
+		return StringVal{key: key, err: ErrKeyNotFound}
 	}
 
-	return StringVal{val: val}
+	return StringVal{key: key, val: val}
 }
 
 func (c *Context) SetCookie(cookie *http.Cookie) {
@@ -93,22 +272,6 @@ func (c *Context) ResponseWithJSON(code int, val any) error {
 	return err
 }
 
-func (s StringVal) String() (string, error) {
-	return s.val, s.err
-}
-func (s StringVal) ToInt64() (int64, error) {
-	if s.err != nil {
-		return 0, s.err
-	}
-	return strconv.ParseInt(s.val, 10, 64)
-}
-func (s StringVal) ToUInt64() (uint64, error) {
-	if s.err != nil {
-		return 0, s.err
-	}
-	return strconv.ParseUint(s.val, 10, 64)
-}
-
 func (c *Context) StatusOK(msg string) error {
 	return c.ResponseWithString(http.StatusOK, msg)
 }
@@ -127,3 +290,27 @@ func (c *Context) JSONStatusNotFound(val any) error {
 func (c *Context) JSONStatusInternalServerError(val any) error {
 	return c.ResponseWithJSON(http.StatusInternalServerError, val)
 }
+
+// StreamWriter 流式响应的写入器，写入的数据直接发送给客户端
+type StreamWriter struct {
+	w       http.ResponseWriter
+	written int64
+}
+
+func (s *StreamWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.written += int64(n)
+	return n, err
+}
+
+// Flush 把缓冲的数据立刻发送给客户端，底层不支持 http.Flusher 的时候什么也不做
+func (s *StreamWriter) Flush() {
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Written 已经写入的字节数
+func (s *StreamWriter) Written() int64 {
+	return s.written
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext_Stream(t *testing.T) {
+	s := NewHTTPServer("test", "")
+	// 模拟一个会检查 ResponseData 的中间件
+	var committed bool
+	inspect := func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			committed = ctx.Committed()
+			if !ctx.Committed() {
+				ctx.ResponseData = append(ctx.ResponseData, " inspected"...)
+				return
+			}
+			// 流式响应之后再修改 ResponseData 不会被写出去
+			ctx.ResponseData = []byte("should be dropped")
+		}
+	}
+	s.addRoute(http.MethodGet, "/export", func(ctx *Context) {
+		ctx.StatusCode = http.StatusAccepted
+		_ = ctx.Stream(func(w io.Writer) error {
+			for i := 0; i < 3; i++ {
+				if _, err := fmt.Fprintf(w, "line %d\n", i); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}, inspect)
+	s.addRoute(http.MethodGet, "/buffered", func(ctx *Context) {
+		_ = ctx.StatusOK("buffered")
+	}, inspect)
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/export", nil))
+	assert.True(t, committed)
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "line 0\nline 1\nline 2\n", recorder.Body.String())
+	assert.Empty(t, recorder.Header().Get("Content-Length"))
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/buffered", nil))
+	assert.False(t, committed)
+	assert.Equal(t, "buffered inspected", recorder.Body.String())
+}
+
+func TestContext_Writer(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	ctx := &Context{
+		Request:        httptest.NewRequest(http.MethodGet, "/", nil),
+		ResponseWriter: recorder,
+		ResponseData:   []byte("head,"),
+	}
+	w := ctx.Writer()
+	assert.Same(t, w, ctx.Writer())
+	_, _ = w.Write([]byte("body"))
+	w.Flush()
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "head,body", recorder.Body.String())
+	assert.Equal(t, int64(9), w.Written())
+	assert.Nil(t, ctx.ResponseData)
+}
+
+func TestContext_SSE(t *testing.T) {
+	s := NewHTTPServer("test", "")
+	started := make(chan struct{})
+	s.Get("/events", func(ctx *Context) {
+		sse, err := ctx.SSE()
+		if err != nil {
+			_ = ctx.StatusInternalServerError(err.Error())
+			return
+		}
+		assert.Equal(t, "41", sse.LastEventID())
+		assert.NoError(t, sse.Retry(3*time.Second))
+		assert.NoError(t, sse.Send("progress", "42", "50%\nhalf way"))
+		assert.NoError(t, sse.Send("", "", "no\r\nevent"))
+		assert.NoError(t, sse.Heartbeat())
+		close(started)
+		<-sse.Done()
+		assert.ErrorIs(t, sse.Send("progress", "43", "100%"), ErrSSEClosed)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Last-Event-ID", "41")
+	recorder := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		s.ServeHTTP(recorder, req)
+		close(finished)
+	}()
+
+	<-started
+	assert.Equal(t, 1, s.conns.len())
+	// 模拟 App 优雅退出
+	s.closeLongLivedConns()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("SSE handler 没有在服务器退出的时候返回")
+	}
+
+	assert.Equal(t, 0, s.conns.len())
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", recorder.Header().Get("Cache-Control"))
+	assert.Equal(t, "retry: 3000\n\n"+
+		"id: 42\nevent: progress\ndata: 50%\ndata: half way\n\n"+
+		"data: no\ndata: event\n\n"+
+		": heartbeat\n\n", recorder.Body.String())
+
+	// 退出之后不再接受新的 SSE 连接
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestContext_SSE_ClientDisconnect(t *testing.T) {
+	s := NewHTTPServer("test", "")
+	returned := make(chan struct{})
+	s.Get("/events", func(ctx *Context) {
+		sse, err := ctx.SSE()
+		if !assert.NoError(t, err) {
+			return
+		}
+		sse.KeepAlive(10 * time.Millisecond)
+		<-sse.Done()
+		close(returned)
+	})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if !assert.NoError(t, err) {
+		return
+	}
+	buf := make([]byte, len(": heartbeat\n\n"))
+	_, err = io.ReadFull(resp.Body, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, ": heartbeat\n\n", string(buf))
+	_ = resp.Body.Close()
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("客户端断开之后 Done 没有关闭")
+	}
+}
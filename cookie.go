@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxCookieSize 浏览器一般只保证 4096 字节以内的 cookie 能够保存下来
+const maxCookieSize = 4096
+
+var (
+	ErrNoCookieKeys   = errors.New("web: 没有设置 cookie 密钥")
+	ErrInvalidCookie  = errors.New("web: cookie 校验失败")
+	ErrCookieTooLarge = errors.New("web: cookie 超过 4096 字节")
+)
+
+// WithCookieKeys 设置签名和加密 cookie 使用的密钥，第一个密钥用于签名和加密，
+// 其余的密钥只用于校验和解密，轮换密钥的时候把新密钥放在最前面，旧密钥保留一段时间再删除
+func WithCookieKeys(keys ...[]byte) ServerOption {
+	if len(keys) == 0 {
+		panic("web: 至少需要一个 cookie 密钥")
+	}
+	ring := &cookieKeyring{}
+	for _, key := range keys {
+		if len(key) < 32 {
+			panic("web: cookie 密钥至少 32 字节")
+		}
+		ring.keys = append(ring.keys, newCookieKey(key))
+	}
+	return func(server *HTTPServer) {
+		server.cookieKeys = ring
+	}
+}
+
+type cookieKeyring struct {
+	keys []cookieKey
+}
+
+// cookieKey 签名和加密使用从同一个密钥派生出来的不同子密钥
+type cookieKey struct {
+	sign []byte
+	aead cipher.AEAD
+}
+
+func newCookieKey(secret []byte) cookieKey {
+	block, err := aes.NewCipher(deriveKey(secret, "web cookie encryption"))
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return cookieKey{sign: deriveKey(secret, "web cookie signing"), aead: aead}
+}
+
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Cookie 读取 cookie 的原始值
+func (c *Context) Cookie(name string) StringVal {
+	cookie, err := c.Request.Cookie(name)
+	if err != nil {
+		return StringVal{key: name, err: ErrKeyNotFound}
+	}
+	return StringVal{key: name, val: cookie.Value}
+}
+
+// SetSignedCookie 写入 HMAC-SHA256 签名的 cookie，客户端能看到值但是无法篡改。
+// 签名里面包含了 cookie 的名字，所以不能把一个 cookie 的值挪到另外一个 cookie 上
+func (c *Context) SetSignedCookie(cookie *http.Cookie) error {
+	if c.cookieKeys == nil {
+		return ErrNoCookieKeys
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(cookie.Value))
+	mac := cookieMAC(c.cookieKeys.keys[0].sign, cookie.Name, payload)
+	return c.setEncodedCookie(cookie, payload+"."+base64.RawURLEncoding.EncodeToString(mac))
+}
+
+// SignedCookie 读取签名的 cookie，签名不对的时候返回 ErrInvalidCookie
+func (c *Context) SignedCookie(name string) StringVal {
+	raw := c.Cookie(name)
+	if raw.err != nil {
+		return raw
+	}
+	if c.cookieKeys == nil {
+		return StringVal{key: name, err: ErrNoCookieKeys}
+	}
+	payload, sig, ok := strings.Cut(raw.val, ".")
+	if !ok {
+		return StringVal{key: name, err: ErrInvalidCookie}
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return StringVal{key: name, err: ErrInvalidCookie}
+	}
+	for _, key := range c.cookieKeys.keys {
+		if !hmac.Equal(mac, cookieMAC(key.sign, name, payload)) {
+			continue
+		}
+		val, err := base64.RawURLEncoding.DecodeString(payload)
+		if err != nil {
+			return StringVal{key: name, err: ErrInvalidCookie}
+		}
+		return StringVal{key: name, val: string(val)}
+	}
+	return StringVal{key: name, err: ErrInvalidCookie}
+}
+
+func cookieMAC(key []byte, name, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	mac.Write([]byte{'|'})
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// SetEncryptedCookie 写入 AES-GCM 加密的 cookie，客户端既看不到值也无法篡改
+func (c *Context) SetEncryptedCookie(cookie *http.Cookie) error {
+	if c.cookieKeys == nil {
+		return ErrNoCookieKeys
+	}
+	aead := c.cookieKeys.keys[0].aead
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(cookie.Value)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	// 名字作为附加数据，防止把加密的值挪到其它 cookie 上
+	sealed := aead.Seal(nonce, nonce, []byte(cookie.Value), []byte(cookie.Name))
+	return c.setEncodedCookie(cookie, base64.RawURLEncoding.EncodeToString(sealed))
+}
+
+// EncryptedCookie 读取加密的 cookie，解密失败的时候返回 ErrInvalidCookie
+func (c *Context) EncryptedCookie(name string) StringVal {
+	raw := c.Cookie(name)
+	if raw.err != nil {
+		return raw
+	}
+	if c.cookieKeys == nil {
+		return StringVal{key: name, err: ErrNoCookieKeys}
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(raw.val)
+	if err != nil {
+		return StringVal{key: name, err: ErrInvalidCookie}
+	}
+	for _, key := range c.cookieKeys.keys {
+		nonceSize := key.aead.NonceSize()
+		if len(sealed) < nonceSize {
+			break
+		}
+		val, err := key.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+		if err == nil {
+			return StringVal{key: name, val: string(val)}
+		}
+	}
+	return StringVal{key: name, err: ErrInvalidCookie}
+}
+
+// setEncodedCookie 复制一份 cookie 再修改值，不影响调用者传进来的 cookie
+func (c *Context) setEncodedCookie(cookie *http.Cookie, value string) error {
+	encoded := *cookie
+	encoded.Value = value
+	if len(encoded.String()) > maxCookieSize {
+		return ErrCookieTooLarge
+	}
+	c.SetCookie(&encoded)
+	return nil
+}
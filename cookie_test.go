@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	cookieKeyOld = bytes.Repeat([]byte("o"), 32)
+	cookieKeyNew = bytes.Repeat([]byte("n"), 32)
+)
+
+// issueCookie 执行 set 并返回写入的 cookie
+func issueCookie(t *testing.T, opts []ServerOption, set func(ctx *Context) error) *http.Cookie {
+	s := NewHTTPServer("test", "", opts...)
+	s.Get("/set", func(ctx *Context) {
+		require.NoError(t, set(ctx))
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/set", nil))
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	return cookies[0]
+}
+
+// readCookie 带着 cookies 发请求，用 get 读取
+func readCookie(opts []ServerOption, get func(ctx *Context) StringVal, cookies ...*http.Cookie) StringVal {
+	s := NewHTTPServer("test", "", opts...)
+	var res StringVal
+	s.Get("/get", func(ctx *Context) {
+		res = get(ctx)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/get", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	return res
+}
+
+func TestContext_Cookie(t *testing.T) {
+	val := readCookie(nil, func(ctx *Context) StringVal {
+		return ctx.Cookie("lang")
+	}, &http.Cookie{Name: "lang", Value: "zh"})
+	assert.Equal(t, "zh", val.OrDefault(""))
+
+	val = readCookie(nil, func(ctx *Context) StringVal {
+		return ctx.Cookie("missing")
+	})
+	assert.Equal(t, ErrKeyNotFound, val.Err())
+}
+
+func TestContext_SignedCookie(t *testing.T) {
+	oldOpts := []ServerOption{WithCookieKeys(cookieKeyOld)}
+	rotatedOpts := []ServerOption{WithCookieKeys(cookieKeyNew, cookieKeyOld)}
+	newOpts := []ServerOption{WithCookieKeys(cookieKeyNew)}
+	get := func(ctx *Context) StringVal {
+		return ctx.SignedCookie("uid")
+	}
+
+	cookie := issueCookie(t, oldOpts, func(ctx *Context) error {
+		return ctx.SetSignedCookie(&http.Cookie{Name: "uid", Value: "123; 中文", HttpOnly: true})
+	})
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, "123; 中文", readCookie(oldOpts, get, cookie).OrDefault(""))
+	// 轮换之后旧密钥签名的 cookie 仍然有效，删除旧密钥之后失效
+	assert.Equal(t, "123; 中文", readCookie(rotatedOpts, get, cookie).OrDefault(""))
+	assert.Equal(t, ErrInvalidCookie, readCookie(newOpts, get, cookie).Err())
+
+	// 篡改值
+	payload, sig, _ := strings.Cut(cookie.Value, ".")
+	tampered := &http.Cookie{Name: "uid", Value: payload + "A." + sig}
+	assert.Equal(t, ErrInvalidCookie, readCookie(oldOpts, get, tampered).Err())
+	// 挪到其它名字的 cookie 上
+	moved := &http.Cookie{Name: "admin", Value: cookie.Value}
+	assert.Equal(t, ErrInvalidCookie, readCookie(oldOpts, func(ctx *Context) StringVal {
+		return ctx.SignedCookie("admin")
+	}, moved).Err())
+
+	// 没有设置密钥
+	assert.Equal(t, ErrNoCookieKeys, readCookie(nil, get, cookie).Err())
+}
+
+func TestContext_EncryptedCookie(t *testing.T) {
+	oldOpts := []ServerOption{WithCookieKeys(cookieKeyOld)}
+	rotatedOpts := []ServerOption{WithCookieKeys(cookieKeyNew, cookieKeyOld)}
+	newOpts := []ServerOption{WithCookieKeys(cookieKeyNew)}
+	get := func(ctx *Context) StringVal {
+		return ctx.EncryptedCookie("token")
+	}
+
+	cookie := issueCookie(t, oldOpts, func(ctx *Context) error {
+		return ctx.SetEncryptedCookie(&http.Cookie{Name: "token", Value: "secret"})
+	})
+	assert.NotContains(t, cookie.Value, "secret")
+	assert.Equal(t, "secret", readCookie(oldOpts, get, cookie).OrDefault(""))
+	assert.Equal(t, "secret", readCookie(rotatedOpts, get, cookie).OrDefault(""))
+	assert.Equal(t, ErrInvalidCookie, readCookie(newOpts, get, cookie).Err())
+
+	moved := &http.Cookie{Name: "other", Value: cookie.Value}
+	assert.Equal(t, ErrInvalidCookie, readCookie(oldOpts, func(ctx *Context) StringVal {
+		return ctx.EncryptedCookie("other")
+	}, moved).Err())
+	assert.Equal(t, ErrInvalidCookie, readCookie(oldOpts, get, &http.Cookie{Name: "token", Value: "abc"}).Err())
+
+	// 太大的 cookie 直接报错，不会写到响应里面
+	s := NewHTTPServer("test", "", oldOpts...)
+	s.Get("/big", func(ctx *Context) {
+		err := ctx.SetEncryptedCookie(&http.Cookie{Name: "big", Value: strings.Repeat("a", maxCookieSize)})
+		assert.Equal(t, ErrCookieTooLarge, err)
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/big", nil))
+	assert.Empty(t, recorder.Header().Get("Set-Cookie"))
+}
+
+func TestWithCookieKeys(t *testing.T) {
+	assert.Panics(t, func() {
+		WithCookieKeys()
+	})
+	assert.Panics(t, func() {
+		WithCookieKeys([]byte("short"))
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type corsConfig struct {
+	allowAll      bool
+	origins       map[string]struct{}
+	wildcards     [][2]string
+	originFunc    func(origin string) bool
+	methods       []string
+	headers       map[string]struct{}
+	exposeHeaders string
+	credentials   bool
+	maxAge        time.Duration
+}
+
+type CORSOption func(cfg *corsConfig)
+
+// WithCORSOrigins 允许的来源，支持精确匹配 https://a.com、子域名通配 https://*.example.com 和 * 表示所有来源
+func WithCORSOrigins(origins ...string) CORSOption {
+	return func(cfg *corsConfig) {
+		for _, origin := range origins {
+			origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+			switch {
+			case origin == "*":
+				cfg.allowAll = true
+			case strings.Contains(origin, "*"):
+				prefix, suffix, _ := strings.Cut(origin, "*")
+				cfg.wildcards = append(cfg.wildcards, [2]string{prefix, suffix})
+			default:
+				cfg.origins[origin] = struct{}{}
+			}
+		}
+	}
+}
+
+// WithCORSOriginFunc 自定义的来源校验，和 WithCORSOrigins 任意一个通过就允许
+func WithCORSOriginFunc(fn func(origin string) bool) CORSOption {
+	return func(cfg *corsConfig) {
+		cfg.originFunc = fn
+	}
+}
+
+// WithCORSMethods 预检请求允许的方法，默认 GET、HEAD、POST、PUT、DELETE、PATCH
+func WithCORSMethods(methods ...string) CORSOption {
+	return func(cfg *corsConfig) {
+		cfg.methods = cfg.methods[:0]
+		for _, m := range methods {
+			cfg.methods = append(cfg.methods, strings.ToUpper(m))
+		}
+	}
+}
+
+// WithCORSHeaders 预检请求允许的请求头，默认 Accept、Content-Type、Authorization、X-Requested-With
+func WithCORSHeaders(headers ...string) CORSOption {
+	return func(cfg *corsConfig) {
+		cfg.headers = make(map[string]struct{}, len(headers))
+		for _, h := range headers {
+			cfg.headers[strings.ToLower(h)] = struct{}{}
+		}
+	}
+}
+
+// WithCORSExposeHeaders 允许浏览器里面的脚本读取的响应头
+func WithCORSExposeHeaders(headers ...string) CORSOption {
+	return func(cfg *corsConfig) {
+		cfg.exposeHeaders = strings.Join(headers, ", ")
+	}
+}
+
+// WithCORSCredentials 允许携带 cookie，这时候 Access-Control-Allow-Origin 不能是 *，会返回请求的 Origin
+func WithCORSCredentials(allow bool) CORSOption {
+	return func(cfg *corsConfig) {
+		cfg.credentials = allow
+	}
+}
+
+// WithCORSMaxAge 预检请求的结果可以缓存多久
+func WithCORSMaxAge(d time.Duration) CORSOption {
+	return func(cfg *corsConfig) {
+		cfg.maxAge = d
+	}
+}
+
+// CORS 跨域中间件，需要通过 HTTPServer.Use 注册，这样没有注册 OPTIONS 路由的预检请求也能得到响应
+func CORS(opts ...CORSOption) Middleware {
+	cfg := &corsConfig{
+		origins: map[string]struct{}{},
+		methods: []string{
+			http.MethodGet, http.MethodHead, http.MethodPost,
+			http.MethodPut, http.MethodDelete, http.MethodPatch,
+		},
+	}
+	WithCORSHeaders("Accept", "Content-Type", "Authorization", "X-Requested-With")(cfg)
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	allowMethods := strings.Join(cfg.methods, ", ")
+
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			r := ctx.Request
+			header := ctx.ResponseWriter.Header()
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			// 响应和 Origin 有关的时候必须加上 Vary，否则缓存可能把一个来源的响应返回给另外一个来源
+			if !cfg.allowAll || cfg.credentials {
+				header.Add("Vary", "Origin")
+			}
+			if preflight {
+				header.Add("Vary", "Access-Control-Request-Method")
+				header.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next(ctx)
+				return
+			}
+			allowed := cfg.allowOrigin(origin)
+			if !preflight {
+				if allowed {
+					cfg.setOrigin(header, origin)
+					if cfg.exposeHeaders != "" {
+						header.Set("Access-Control-Expose-Headers", cfg.exposeHeaders)
+					}
+				}
+				next(ctx)
+				return
+			}
+
+			// 预检请求不会交给 handler，不允许的时候不带任何 CORS 响应头，浏览器会拒绝真正的请求
+			_ = ctx.NoContent()
+			if !allowed || !cfg.allowMethod(r.Header.Get("Access-Control-Request-Method")) {
+				return
+			}
+			reqHeaders, ok := cfg.allowHeaders(r.Header.Values("Access-Control-Request-Headers"))
+			if !ok {
+				return
+			}
+			cfg.setOrigin(header, origin)
+			header.Set("Access-Control-Allow-Methods", allowMethods)
+			if reqHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", reqHeaders)
+			}
+			if cfg.maxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.maxAge/time.Second)))
+			}
+		}
+	}
+}
+
+func (cfg *corsConfig) setOrigin(header http.Header, origin string) {
+	if cfg.allowAll && !cfg.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if cfg.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (cfg *corsConfig) allowOrigin(origin string) bool {
+	if cfg.allowAll {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if _, ok := cfg.origins[lower]; ok {
+		return true
+	}
+	for _, w := range cfg.wildcards {
+		if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) {
+			return true
+		}
+	}
+	return cfg.originFunc != nil && cfg.originFunc(origin)
+}
+
+func (cfg *corsConfig) allowMethod(method string) bool {
+	method = strings.ToUpper(method)
+	for _, m := range cfg.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders 请求的头都被允许的时候原样返回
+func (cfg *corsConfig) allowHeaders(values []string) (string, bool) {
+	var res []string
+	for _, line := range values {
+		for _, h := range strings.Split(line, ",") {
+			h = strings.TrimSpace(h)
+			if h == "" {
+				continue
+			}
+			if _, ok := cfg.headers[strings.ToLower(h)]; !ok {
+				return "", false
+			}
+			res = append(res, h)
+		}
+	}
+	return strings.Join(res, ", "), true
+}
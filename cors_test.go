@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	s := NewHTTPServer("test", "")
+	s.Use(CORS(
+		WithCORSOrigins("https://app.example.com", "https://*.example.org"),
+		WithCORSOriginFunc(func(origin string) bool {
+			return strings.HasSuffix(origin, ".local:3000")
+		}),
+		WithCORSMethods("GET", "POST", "PUT"),
+		WithCORSHeaders("Content-Type", "X-Token"),
+		WithCORSExposeHeaders("X-Total-Count"),
+		WithCORSCredentials(true),
+		WithCORSMaxAge(10*time.Minute),
+	))
+	s.PUT("/user", func(ctx *Context) {
+		_ = ctx.StatusOK("updated")
+	})
+
+	testCases := []struct {
+		name       string
+		method     string
+		header     http.Header
+		wantCode   int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{
+			name:     "no origin",
+			method:   http.MethodPut,
+			wantCode: http.StatusOK,
+			wantBody: "updated",
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Vary":                        "Origin",
+			},
+		},
+		{
+			name:     "actual request",
+			method:   http.MethodPut,
+			header:   http.Header{"Origin": {"https://app.example.com"}},
+			wantCode: http.StatusOK,
+			wantBody: "updated",
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Total-Count",
+			},
+		},
+		{
+			name:     "wildcard subdomain",
+			method:   http.MethodPut,
+			header:   http.Header{"Origin": {"https://a.b.example.org"}},
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "https://a.b.example.org",
+			},
+		},
+		{
+			name:     "wildcard does not match apex",
+			method:   http.MethodPut,
+			header:   http.Header{"Origin": {"https://example.org"}},
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:     "origin func",
+			method:   http.MethodPut,
+			header:   http.Header{"Origin": {"http://dev.local:3000"}},
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "http://dev.local:3000",
+			},
+		},
+		{
+			name:     "disallowed origin",
+			method:   http.MethodPut,
+			header:   http.Header{"Origin": {"https://evil.com"}},
+			wantCode: http.StatusOK,
+			wantBody: "updated",
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			// 没有注册 OPTIONS 路由
+			name:   "preflight",
+			method: http.MethodOptions,
+			header: http.Header{
+				"Origin":                         {"https://app.example.com"},
+				"Access-Control-Request-Method":  {"PUT"},
+				"Access-Control-Request-Headers": {"content-type, x-token"},
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Methods":     "GET, POST, PUT",
+				"Access-Control-Allow-Headers":     "content-type, x-token",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+				"Vary":                             "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			name:   "preflight disallowed method",
+			method: http.MethodOptions,
+			header: http.Header{
+				"Origin":                        {"https://app.example.com"},
+				"Access-Control-Request-Method": {"DELETE"},
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:   "preflight disallowed header",
+			method: http.MethodOptions,
+			header: http.Header{
+				"Origin":                         {"https://app.example.com"},
+				"Access-Control-Request-Method":  {"PUT"},
+				"Access-Control-Request-Headers": {"X-Admin"},
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			// 不是预检请求的 OPTIONS 交给路由处理
+			name:     "plain options",
+			method:   http.MethodOptions,
+			header:   http.Header{"Origin": {"https://app.example.com"}},
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/user", nil)
+			for k, vs := range tc.header {
+				req.Header[k] = vs
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, recorder.Body.String())
+			}
+			for k, v := range tc.wantHeader {
+				assert.Equal(t, v, strings.Join(recorder.Header().Values(k), ", "), k)
+			}
+		})
+	}
+}
+
+func TestCORS_AllowAll(t *testing.T) {
+	s := NewHTTPServer("test", "")
+	s.Use(CORS(WithCORSOrigins("*")))
+	s.Get("/", func(ctx *Context) {
+		_ = ctx.StatusOK("ok")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://any.com")
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+	// 所有来源的响应都一样，不需要 Vary
+	assert.Empty(t, recorder.Header().Get("Vary"))
+}
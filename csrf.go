@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	HeaderCSRFToken = "X-CSRF-Token"
+
+	// csrfTokenLen 原始 token 的字节数
+	csrfTokenLen    = 32
+	csrfSessionKey  = "web.csrf_token"
+	csrfDefaultName = "csrf_token"
+	// csrfPeekLimit multipart 请求里面为了找到 token 最多读取的字节数
+	csrfPeekLimit = 16 << 10
+)
+
+var (
+	ErrCSRFToken  = errors.New("web: CSRF token 校验失败")
+	ErrCSRFOrigin = errors.New("web: CSRF Origin 校验失败")
+)
+
+// CSRFMode token 的保存方式
+type CSRFMode int
+
+const (
+	// CSRFDoubleSubmit token 放在 cookie 里面，提交的时候和表单或者头部里面的 token 比较。
+	// 设置了 WithCookieKeys 的时候 cookie 会被签名，子域名没有办法伪造
+	CSRFDoubleSubmit CSRFMode = iota
+	// CSRFSynchronizer token 放在会话里面，需要在外层使用 Sessions 中间件
+	CSRFSynchronizer
+)
+
+type csrfConfig struct {
+	mode           CSRFMode
+	field          string
+	header         string
+	cookie         http.Cookie
+	trustedOrigins map[string]struct{}
+	exempt         map[string]struct{}
+}
+
+type CSRFOption func(cfg *csrfConfig)
+
+// WithCSRFMode 默认 CSRFDoubleSubmit
+func WithCSRFMode(mode CSRFMode) CSRFOption {
+	return func(cfg *csrfConfig) {
+		cfg.mode = mode
+	}
+}
+
+// WithCSRFField 表单里面 token 的字段名，默认 csrf_token
+func WithCSRFField(field string) CSRFOption {
+	return func(cfg *csrfConfig) {
+		cfg.field = field
+	}
+}
+
+// WithCSRFHeader 前端通过 AJAX 提交 token 使用的头部，默认 X-CSRF-Token
+func WithCSRFHeader(header string) CSRFOption {
+	return func(cfg *csrfConfig) {
+		cfg.header = http.CanonicalHeaderKey(header)
+	}
+}
+
+// WithCSRFCookie 双重提交模式下保存 token 的 cookie，Name 和 Path 为空的时候使用默认值，
+// Value 和过期时间会被忽略，HttpOnly 总是开启
+func WithCSRFCookie(cookie http.Cookie) CSRFOption {
+	return func(cfg *csrfConfig) {
+		if cookie.Name == "" {
+			cookie.Name = cfg.cookie.Name
+		}
+		if cookie.Path == "" {
+			cookie.Path = "/"
+		}
+		cfg.cookie = cookie
+	}
+}
+
+// WithCSRFTrustedOrigins 除了同源以外允许的 Origin，例如 https://admin.example.com
+func WithCSRFTrustedOrigins(origins ...string) CSRFOption {
+	return func(cfg *csrfConfig) {
+		for _, origin := range origins {
+			cfg.trustedOrigins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = struct{}{}
+		}
+	}
+}
+
+// WithCSRFExempt 不做 CSRF 检查的路由，使用注册路由时的写法，例如 /webhooks/:provider。
+// 一般是用其它方式认证的 webhook、API 之类的路由
+func WithCSRFExempt(routes ...string) CSRFOption {
+	return func(cfg *csrfConfig) {
+		for _, route := range routes {
+			cfg.exempt[route] = struct{}{}
+		}
+	}
+}
+
+// CSRF 跨站请求伪造防护。GET、HEAD、OPTIONS、TRACE 不检查，其它方法要求：
+//   - Origin 和请求同源或者在信任列表里面，没有 Origin 的时候检查 Referer，HTTPS 请求两者都没有的时候拒绝
+//   - 头部或者表单字段里面的 token 和 cookie 或者会话里面的 token 一致。
+//     multipart 表单只检查第一部分，token 字段要放在文件之前，最好直接使用 ctx.CSRFField 作为表单的第一个字段
+//
+// 校验失败的时候通过 ErrorHandler 返回 403。页面通过 ctx.CSRFToken 或者 ctx.CSRFField 拿到 token
+func CSRF(opts ...CSRFOption) Middleware {
+	cfg := &csrfConfig{
+		field:  csrfDefaultName,
+		header: HeaderCSRFToken,
+		cookie: http.Cookie{
+			Name:     "_csrf",
+			Path:     "/",
+			SameSite: http.SameSiteLaxMode,
+		},
+		trustedOrigins: map[string]struct{}{},
+		exempt:         map[string]struct{}{},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.csrf = cfg
+			switch ctx.Request.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				next(ctx)
+				return
+			}
+			if _, ok := cfg.exempt[ctx.MatchedRoute]; ok && ctx.MatchedRoute != "" {
+				next(ctx)
+				return
+			}
+			token, err := cfg.verify(ctx)
+			if err != nil {
+				ctx.Error(&HTTPError{
+					Code:    http.StatusForbidden,
+					Message: http.StatusText(http.StatusForbidden),
+					Err:     err,
+				})
+				return
+			}
+			ctx.csrfToken = token
+			next(ctx)
+		}
+	}
+}
+
+// verify 校验通过的时候返回保存的原始 token
+func (cfg *csrfConfig) verify(ctx *Context) ([]byte, error) {
+	if err := cfg.checkOrigin(ctx); err != nil {
+		return nil, err
+	}
+	expected := cfg.storedToken(ctx)
+	if expected == nil {
+		return nil, ErrCSRFToken
+	}
+	submitted := ctx.Request.Header.Get(cfg.header)
+	if submitted == "" {
+		submitted = cfg.formToken(ctx)
+	}
+	token := unmaskCSRFToken(submitted)
+	if token == nil || subtle.ConstantTimeCompare(token, expected) != 1 {
+		return nil, ErrCSRFToken
+	}
+	return expected, nil
+}
+
+// formToken 从表单里面读取 token。
+// multipart 表单不会整个解析，只读取第一部分，所以 token 字段必须放在表单的最前面，
+// 读过的数据会放回请求体，handler 仍然可以使用 FormValue、FormFile 或者流式的 MultipartReader
+func (cfg *csrfConfig) formToken(ctx *Context) string {
+	mediaType, params, err := mime.ParseMediaType(ctx.Request.Header.Get("Content-Type"))
+	if err != nil || ctx.Request.Body == nil {
+		return ""
+	}
+	if mediaType == MediaTypeForm {
+		return ctx.FormValue(cfg.field).OrDefault("")
+	}
+	if mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return ""
+	}
+
+	body := ctx.Request.Body
+	peeked := &bytes.Buffer{}
+	mr := multipart.NewReader(io.TeeReader(io.LimitReader(body, csrfPeekLimit), peeked), params["boundary"])
+	token := ""
+	if part, err := mr.NextPart(); err == nil && part.FormName() == cfg.field && part.FileName() == "" {
+		// 掩码之后的 token 是固定长度的，多读一个字节用来发现过长的值
+		data, _ := io.ReadAll(io.LimitReader(part, 4*csrfTokenLen+1))
+		token = string(data)
+	}
+	ctx.Request.Body = &peekedBody{Reader: io.MultiReader(bytes.NewReader(peeked.Bytes()), body), Closer: body}
+	// 之后 limitBody 会重新包装原始请求体，读过的数据也要放回去
+	if ctx.rawBody != nil {
+		ctx.rawBody = &peekedBody{Reader: io.MultiReader(bytes.NewReader(peeked.Bytes()), ctx.rawBody), Closer: ctx.rawBody}
+	}
+	return token
+}
+
+// peekedBody 已经读出来的数据放在前面，再接着读原来的请求体
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// checkOrigin 浏览器跨站提交表单的时候总会带上 Origin 或者 Referer，
+// 没有这两个头部的一般是非浏览器的客户端，交给 token 检查
+func (cfg *csrfConfig) checkOrigin(ctx *Context) error {
+	origin := ctx.Request.Header.Get("Origin")
+	if origin == "" {
+		referer := ctx.Request.Referer()
+		if referer == "" {
+			if ctx.Scheme() == "https" {
+				return ErrCSRFOrigin
+			}
+			return nil
+		}
+		u, err := url.Parse(referer)
+		if err != nil {
+			return ErrCSRFOrigin
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+	origin = strings.ToLower(origin)
+	if origin == strings.ToLower(ctx.Scheme()+"://"+ctx.Host()) {
+		return nil
+	}
+	if _, ok := cfg.trustedOrigins[origin]; ok {
+		return nil
+	}
+	return ErrCSRFOrigin
+}
+
+// storedToken cookie 或者会话里面保存的原始 token，没有或者格式不对的时候返回 nil
+func (cfg *csrfConfig) storedToken(ctx *Context) []byte {
+	var encoded string
+	if cfg.mode == CSRFSynchronizer {
+		encoded = ctx.Session().GetString(csrfSessionKey)
+	} else if ctx.cookieKeys != nil {
+		encoded = ctx.SignedCookie(cfg.cookie.Name).OrDefault("")
+	} else {
+		encoded = ctx.Cookie(cfg.cookie.Name).OrDefault("")
+	}
+	token, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(token) != csrfTokenLen {
+		return nil
+	}
+	return token
+}
+
+// saveToken 生成新的 token 之后保存到 cookie 或者会话里面，需要在响应提交之前调用
+func (cfg *csrfConfig) saveToken(ctx *Context, token []byte) error {
+	encoded := base64.RawURLEncoding.EncodeToString(token)
+	if cfg.mode == CSRFSynchronizer {
+		ctx.Session().Set(csrfSessionKey, encoded)
+		return nil
+	}
+	cookie := cfg.cookie
+	cookie.Value = encoded
+	cookie.HttpOnly = true
+	if ctx.cookieKeys != nil {
+		return ctx.SetSignedCookie(&cookie)
+	}
+	http.SetCookie(ctx.ResponseWriter, &cookie)
+	return nil
+}
+
+// CSRFToken 提交表单或者 AJAX 请求时需要带上的 token，没有使用 CSRF 中间件的时候 panic。
+// 还没有 token 的时候会生成一个并写入 cookie 或者会话，所以要在响应提交之前调用。
+// 每次调用返回的值都不一样（使用随机掩码），避免 BREACH 之类的压缩侧信道攻击
+func (c *Context) CSRFToken() string {
+	if c.csrf == nil {
+		panic("web: 没有使用 CSRF 中间件")
+	}
+	if c.csrfToken == nil {
+		token := c.csrf.storedToken(c)
+		if token == nil {
+			token = make([]byte, csrfTokenLen)
+			if _, err := rand.Read(token); err != nil {
+				panic(err)
+			}
+			if err := c.csrf.saveToken(c, token); err != nil {
+				panic(err)
+			}
+		}
+		c.csrfToken = token
+	}
+	return maskCSRFToken(c.csrfToken)
+}
+
+// CSRFField 表单里面使用的隐藏字段，放进模板数据里面直接输出
+//
+//	<form method="post">{{.CSRFField}}...</form>
+func (c *Context) CSRFField() template.HTML {
+	token := c.CSRFToken()
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(c.csrf.field) +
+		`" value="` + token + `">`)
+}
+
+// maskCSRFToken 结果是 base64(mask || token XOR mask)
+func maskCSRFToken(token []byte) string {
+	buf := make([]byte, 2*len(token))
+	mask := buf[:len(token)]
+	if _, err := rand.Read(mask); err != nil {
+		panic(err)
+	}
+	for i, b := range token {
+		buf[len(token)+i] = b ^ mask[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func unmaskCSRFToken(masked string) []byte {
+	buf, err := base64.RawURLEncoding.DecodeString(masked)
+	if err != nil || len(buf) != 2*csrfTokenLen {
+		return nil
+	}
+	token := make([]byte, csrfTokenLen)
+	for i := range token {
+		token[i] = buf[i] ^ buf[csrfTokenLen+i]
+	}
+	return token
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gofaquan/go-http/middleware/session"
+)
+
+var csrfFieldRe = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+func newCSRFServer(mdls ...Middleware) *HTTPServer {
+	s := NewHTTPServer("test", "", WithCookieKeys([]byte("0123456789abcdef0123456789abcdef")))
+	s.Use(mdls...)
+	s.Get("/form", func(ctx *Context) {
+		_ = ctx.ResponseWithString(http.StatusOK, string(ctx.CSRFField()))
+	})
+	s.Post("/form", func(ctx *Context) {
+		_ = ctx.StatusOK("ok")
+	})
+	s.Post("/webhooks/:provider", func(ctx *Context) {
+		_ = ctx.StatusOK("hook")
+	})
+	return s
+}
+
+// csrfForm 取一次表单页面，返回 cookie 和页面里面的 token
+func csrfForm(t *testing.T, s *HTTPServer) ([]*http.Cookie, string) {
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/form", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	m := csrfFieldRe.FindStringSubmatch(recorder.Body.String())
+	require.Len(t, m, 2)
+	return recorder.Result().Cookies(), m[1]
+}
+
+func TestCSRF(t *testing.T) {
+	m := session.NewManager(session.NewMemoryStore(0))
+	servers := map[string]*HTTPServer{
+		"double submit": newCSRFServer(CSRF(WithCSRFExempt("/webhooks/:provider"),
+			WithCSRFTrustedOrigins("https://admin.example.com/"))),
+		"synchronizer": newCSRFServer(Sessions(m), CSRF(WithCSRFMode(CSRFSynchronizer),
+			WithCSRFExempt("/webhooks/:provider"), WithCSRFTrustedOrigins("https://admin.example.com"))),
+	}
+	for name, s := range servers {
+		t.Run(name, func(t *testing.T) {
+			cookies, token := csrfForm(t, s)
+			require.Len(t, cookies, 1)
+
+			testCases := []struct {
+				name     string
+				path     string
+				form     url.Values
+				header   map[string]string
+				cookies  []*http.Cookie
+				wantCode int
+			}{
+				{name: "form field", form: url.Values{"csrf_token": {token}}, cookies: cookies, wantCode: http.StatusOK},
+				{name: "header", header: map[string]string{HeaderCSRFToken: token}, cookies: cookies, wantCode: http.StatusOK},
+				{name: "same origin", form: url.Values{"csrf_token": {token}}, cookies: cookies,
+					header: map[string]string{"Origin": "http://example.com"}, wantCode: http.StatusOK},
+				{name: "trusted origin", form: url.Values{"csrf_token": {token}}, cookies: cookies,
+					header: map[string]string{"Origin": "https://admin.example.com"}, wantCode: http.StatusOK},
+				{name: "cross origin", form: url.Values{"csrf_token": {token}}, cookies: cookies,
+					header: map[string]string{"Origin": "https://evil.com"}, wantCode: http.StatusForbidden},
+				{name: "cross site referer", form: url.Values{"csrf_token": {token}}, cookies: cookies,
+					header: map[string]string{"Referer": "https://evil.com/page"}, wantCode: http.StatusForbidden},
+				{name: "same site referer", form: url.Values{"csrf_token": {token}}, cookies: cookies,
+					header: map[string]string{"Referer": "http://example.com/form"}, wantCode: http.StatusOK},
+				{name: "no token", cookies: cookies, wantCode: http.StatusForbidden},
+				{name: "wrong token", form: url.Values{"csrf_token": {token[:len(token)-2] + "AA"}}, cookies: cookies, wantCode: http.StatusForbidden},
+				{name: "no cookie", form: url.Values{"csrf_token": {token}}, wantCode: http.StatusForbidden},
+				{name: "exempt", path: "/webhooks/github", wantCode: http.StatusOK},
+			}
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					path := tc.path
+					if path == "" {
+						path = "/form"
+					}
+					req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(tc.form.Encode()))
+					req.Header.Set("Content-Type", MediaTypeForm)
+					for k, v := range tc.header {
+						req.Header.Set(k, v)
+					}
+					for _, c := range tc.cookies {
+						req.AddCookie(c)
+					}
+					recorder := httptest.NewRecorder()
+					s.ServeHTTP(recorder, req)
+					assert.Equal(t, tc.wantCode, recorder.Code)
+				})
+			}
+		})
+	}
+}
+
+func TestCSRF_Multipart(t *testing.T) {
+	s := newCSRFServer(CSRF())
+	upload := func(ctx *Context) {
+		// CSRF 检查之后仍然可以流式读取整个表单
+		mr, err := ctx.MultipartReader()
+		require.NoError(t, err)
+		var names []string
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			data, _ := io.ReadAll(part)
+			names = append(names, part.FormName()+":"+strconv.Itoa(len(data)))
+		}
+		_ = ctx.StatusOK(strings.Join(names, ","))
+	}
+	s.Post("/upload", upload)
+	// 路由上的 MaxBodySize 在 CSRF 之后重新包装请求体，不能丢掉已经读过的数据
+	s.Post("/limited", upload, MaxBodySize(1<<20))
+	cookies, token := csrfForm(t, s)
+
+	post := func(path string, tokenFirst bool) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		if tokenFirst {
+			require.NoError(t, w.WriteField("csrf_token", token))
+		}
+		fw, err := w.CreateFormFile("file", "a.bin")
+		require.NoError(t, err)
+		_, err = fw.Write(make([]byte, 64<<10))
+		require.NoError(t, err)
+		if !tokenFirst {
+			require.NoError(t, w.WriteField("csrf_token", token))
+		}
+		require.NoError(t, w.Close())
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	want := "csrf_token:" + strconv.Itoa(len(token)) + ",file:65536"
+	recorder := post("/upload", true)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, want, recorder.Body.String())
+	recorder = post("/limited", true)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, want, recorder.Body.String())
+	// token 放在文件后面的时候不会为了找它读取整个请求体
+	assert.Equal(t, http.StatusForbidden, post("/upload", false).Code)
+}
+
+func TestCSRF_HTTPS(t *testing.T) {
+	s := newCSRFServer(CSRF())
+	cookies, token := csrfForm(t, s)
+	post := func(header string, val string) int {
+		req := httptest.NewRequest(http.MethodPost, "https://example.com/form", nil)
+		req.Header.Set(HeaderCSRFToken, token)
+		if header != "" {
+			req.Header.Set(header, val)
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	// HTTPS 请求没有 Origin 也没有 Referer 的时候拒绝
+	assert.Equal(t, http.StatusForbidden, post("", ""))
+	assert.Equal(t, http.StatusOK, post("Origin", "https://example.com"))
+	// 协议不同也是跨域
+	assert.Equal(t, http.StatusForbidden, post("Origin", "http://example.com"))
+}
+
+func TestContext_CSRFToken(t *testing.T) {
+	assert.Panics(t, func() {
+		(&Context{}).CSRFToken()
+	})
+	token := make([]byte, csrfTokenLen)
+	token[0] = 1
+	masked := maskCSRFToken(token)
+	assert.NotEqual(t, masked, maskCSRFToken(token))
+	assert.Equal(t, token, unmaskCSRFToken(masked))
+	assert.Nil(t, unmaskCSRFToken("abc"))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrorHandler 统一处理 handler 和中间件交出来的错误，包括 panic 转换成的 *PanicError
+type ErrorHandler func(ctx *Context, err error)
+
+// WithErrorHandler 自定义错误处理，例如按照 JSON 的格式返回错误
+func WithErrorHandler(handler ErrorHandler) ServerOption {
+	return func(server *HTTPServer) {
+		server.errorHandler = handler
+	}
+}
+
+// HTTPError 带着状态码的错误，Message 会直接返回给客户端，Err 只用于日志
+type HTTPError struct {
+	Code    int
+	Message string
+	Err     error
+}
+
+func NewHTTPError(code int, msg string) *HTTPError {
+	return &HTTPError{Code: code, Message: msg}
+}
+
+func (e *HTTPError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Code)
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// Error 把错误交给 ErrorHandler 处理
+func (c *Context) Error(err error) {
+	if err == nil {
+		return
+	}
+	if c.errorHandler != nil {
+		c.errorHandler(c, err)
+		return
+	}
+	DefaultErrorHandler(c, err)
+}
+
+// DefaultErrorHandler *HTTPError 使用它的状态码和信息，其它错误一律返回 500，不会把错误细节暴露给客户端
+func DefaultErrorHandler(ctx *Context, err error) {
+	if ctx.Committed() {
+		return
+	}
+	var he *HTTPError
+	if errors.As(err, &he) {
+		msg := he.Message
+		if msg == "" {
+			msg = http.StatusText(he.Code)
+		}
+		_ = ctx.ResponseWithString(he.Code, msg)
+		return
+	}
+	_ = ctx.StatusInternalServerError("500 INTERNAL SERVER ERROR")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File 发送文件，支持 Range、If-Range、If-Modified-Since 之类的条件请求
+// 文件不存在或者是目录的时候返回 404，没有权限的时候返回 403，其它错误返回 500
+func (c *Context) File(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			_ = c.StatusNotFound("404 NOT FOUND")
+		case errors.Is(err, os.ErrPermission):
+			_ = c.ResponseWithString(http.StatusForbidden, "403 FORBIDDEN")
+		default:
+			_ = c.StatusInternalServerError("500 INTERNAL SERVER ERROR")
+		}
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = c.StatusInternalServerError("500 INTERNAL SERVER ERROR")
+		return err
+	}
+	if info.IsDir() {
+		_ = c.StatusNotFound("404 NOT FOUND")
+		return errors.New("web: 不能发送目录 " + path)
+	}
+	c.ServeContent(info.Name(), info.ModTime(), f)
+	return nil
+}
+
+// Attachment 让浏览器以附件的形式下载，filename 按照 RFC 6266 编码，支持非 ASCII 字符
+// r 实现了 io.ReadSeeker 的时候支持 Range 请求，否则以流式响应的方式发送
+func (c *Context) Attachment(r io.Reader, filename string) error {
+	c.ResponseWriter.Header().Set("Content-Disposition", ContentDisposition("attachment", filename))
+	if rs, ok := r.(io.ReadSeeker); ok {
+		c.ServeContent(filename, time.Time{}, rs)
+		return nil
+	}
+
+	header := c.ResponseWriter.Header()
+	if header.Get("Content-Type") == "" {
+		ctype := mime.TypeByExtension(filepath.Ext(filename))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		header.Set("Content-Type", ctype)
+	}
+	return c.Stream(func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// ServeContent 使用 http.ServeContent 发送内容，支持 Range（包括多段）、If-Range、If-Modified-Since
+// 内容会直接写给客户端，不经过 ResponseData，Content-Length 也由 http.ServeContent 负责
+// modtime 为零值的时候不会发送 Last-Modified
+func (c *Context) ServeContent(name string, modtime time.Time, content io.ReadSeeker) {
+	c.response()
+	http.ServeContent(c.ResponseWriter, c.Request, name, modtime, content)
+}
+
+// ContentDisposition 按照 RFC 6266 生成 Content-Disposition
+// 非 ASCII 的文件名使用 RFC 5987 的 filename*，同时保留一个 ASCII 的 filename 给老的客户端
+func ContentDisposition(dispositionType, filename string) string {
+	var fallback strings.Builder
+	ascii := true
+	for _, r := range filename {
+		switch {
+		case r > 0x7e || r < 0x20:
+			ascii = false
+			fallback.WriteByte('_')
+		case r == '"' || r == '\\':
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+	res := dispositionType + `; filename="` + fallback.String() + `"`
+	if !ascii {
+		res += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return res
+}
+
+// encodeRFC5987 除了 attr-char 以外的字节都要百分号编码
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if isAttrChar(b) {
+			sb.WriteByte(b)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(hex[b>>4])
+		sb.WriteByte(hex[b&0x0f])
+	}
+	return sb.String()
+}
+
+func isAttrChar(b byte) bool {
+	switch {
+	case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_File(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.txt")
+	require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0o644))
+	modtime := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(path, modtime, modtime))
+
+	s := NewHTTPServer("test", "")
+	s.Get("/report", func(ctx *Context) {
+		_ = ctx.File(path)
+	})
+	s.Get("/missing", func(ctx *Context) {
+		assert.Error(t, ctx.File(filepath.Join(dir, "missing.txt")))
+	})
+	s.Get("/dir", func(ctx *Context) {
+		assert.Error(t, ctx.File(dir))
+	})
+	s.Get("/broken", func(ctx *Context) {
+		// 路径中间是普通文件，打开失败但不是 os.ErrNotExist
+		assert.Error(t, ctx.File(filepath.Join(path, "child")))
+	})
+
+	testCases := []struct {
+		name       string
+		path       string
+		header     http.Header
+		wantCode   int
+		wantBody   string
+		wantLength string
+	}{
+		{
+			name:       "full",
+			path:       "/report",
+			wantCode:   http.StatusOK,
+			wantBody:   "0123456789",
+			wantLength: "10",
+		},
+		{
+			name:       "range",
+			path:       "/report",
+			header:     http.Header{"Range": {"bytes=2-4"}},
+			wantCode:   http.StatusPartialContent,
+			wantBody:   "234",
+			wantLength: "3",
+		},
+		{
+			name:     "unsatisfiable range",
+			path:     "/report",
+			header:   http.Header{"Range": {"bytes=20-"}},
+			wantCode: http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name:     "not modified",
+			path:     "/report",
+			header:   http.Header{"If-Modified-Since": {modtime.Format(http.TimeFormat)}},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			// If-Range 不匹配的时候忽略 Range，返回整个文件
+			name: "stale if-range",
+			path: "/report",
+			header: http.Header{
+				"Range":    {"bytes=2-4"},
+				"If-Range": {modtime.Add(-time.Hour).Format(http.TimeFormat)},
+			},
+			wantCode:   http.StatusOK,
+			wantBody:   "0123456789",
+			wantLength: "10",
+		},
+		{
+			name:     "missing",
+			path:     "/missing",
+			wantCode: http.StatusNotFound,
+			wantBody: "404 NOT FOUND",
+		},
+		{
+			name:     "dir",
+			path:     "/dir",
+			wantCode: http.StatusNotFound,
+			wantBody: "404 NOT FOUND",
+		},
+		{
+			name:     "open error",
+			path:     "/broken",
+			wantCode: http.StatusInternalServerError,
+			wantBody: "500 INTERNAL SERVER ERROR",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			for k, vs := range tc.header {
+				req.Header[k] = vs
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, recorder.Body.String())
+			}
+			if tc.wantLength != "" {
+				assert.Equal(t, tc.wantLength, recorder.Header().Get("Content-Length"))
+			}
+		})
+	}
+}
+
+func TestContext_FilePermission(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root 可以读取任何文件")
+	}
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(path, []byte("secret"), 0o000))
+
+	s := NewHTTPServer("test", "")
+	s.Get("/secret", func(ctx *Context) {
+		assert.ErrorIs(t, ctx.File(path), os.ErrPermission)
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/secret", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, "403 FORBIDDEN", recorder.Body.String())
+}
+
+func TestContext_ServeContent_MultiRange(t *testing.T) {
+	s := NewHTTPServer("test", "")
+	s.Get("/data", func(ctx *Context) {
+		// ResponseData 会被忽略，不会追加到内容后面
+		ctx.ResponseData = []byte("ignored")
+		ctx.ServeContent("data.txt", time.Time{}, strings.NewReader("abcdefghij"))
+	})
+	req := httptest.NewRequest(http.MethodGet, "/data", nil)
+	req.Header.Set("Range", "bytes=0-1,5-6")
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusPartialContent, recorder.Code)
+	assert.True(t, strings.HasPrefix(recorder.Header().Get("Content-Type"), "multipart/byteranges"))
+	body := recorder.Body.String()
+	assert.Contains(t, body, "ab")
+	assert.Contains(t, body, "fg")
+	assert.NotContains(t, body, "ignored")
+	assert.Empty(t, recorder.Header().Get("Last-Modified"))
+}
+
+func TestContext_Attachment(t *testing.T) {
+	s := NewHTTPServer("test", "")
+	s.Get("/seeker", func(ctx *Context) {
+		require.NoError(t, ctx.Attachment(bytes.NewReader([]byte("a,b\n1,2\n")), "报表 2023.csv"))
+	})
+	s.Get("/stream", func(ctx *Context) {
+		require.NoError(t, ctx.Attachment(io.MultiReader(strings.NewReader("a,b\n")), "report.csv"))
+	})
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/seeker", nil)
+	req.Header.Set("Range", "bytes=4-")
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusPartialContent, recorder.Code)
+	assert.Equal(t, "1,2\n", recorder.Body.String())
+	assert.Equal(t, `attachment; filename="__ 2023.csv"; filename*=UTF-8''%E6%8A%A5%E8%A1%A8%202023.csv`,
+		recorder.Header().Get("Content-Disposition"))
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "a,b\n", recorder.Body.String())
+	assert.Equal(t, `attachment; filename="report.csv"`, recorder.Header().Get("Content-Disposition"))
+	assert.True(t, strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/csv"))
+}
+
+func TestContentDisposition(t *testing.T) {
+	assert.Equal(t, `inline; filename="a_b_.txt"`, ContentDisposition("inline", `a"b\.txt`))
+	assert.Equal(t, `attachment; filename="_.txt"; filename*=UTF-8''%C3%A9.txt`, ContentDisposition("attachment", "é.txt"))
+}
@@ -4,6 +4,7 @@ go 1.19
 
 require (
 	github.com/stretchr/testify v1.8.1
+	golang.org/x/crypto v0.9.0
 )
 
 require (
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Route 注册好的路由，用来给路由补充权限要求之类的元数据
+type Route struct {
+	n *node
+}
+
+// Group 共用前缀、中间件和权限要求的一组路由，可以嵌套
+//
+//	admin := s.Group("/admin").Require(RequireRoles("admin"))
+//	admin.Get("/users", listUsers)
+type Group struct {
+	server *HTTPServer
+	parent *Group
+	prefix string
+	mdls   []Middleware
+	// policies 组里面所有的路由都要满足，注册路由之后再追加也会生效
+	policies []Policy
+}
+
+// Group 创建路由组，prefix 必须以 / 开头，不能以 / 结尾
+func (h *HTTPServer) Group(prefix string, ms ...Middleware) *Group {
+	checkGroupPrefix(prefix)
+	return &Group{server: h, prefix: prefix, mdls: ms}
+}
+
+// Group 创建子路由组，继承前缀、中间件和权限要求
+func (g *Group) Group(prefix string, ms ...Middleware) *Group {
+	checkGroupPrefix(prefix)
+	return &Group{server: g.server, parent: g, prefix: g.prefix + prefix, mdls: ms}
+}
+
+func checkGroupPrefix(prefix string) {
+	if prefix == "" || prefix[0] != '/' || strings.HasSuffix(prefix, "/") {
+		panic("web: 路由组前缀必须以 / 开头，不能以 / 结尾 [" + prefix + "]")
+	}
+}
+
+func (g *Group) Get(path string, handleFunc HandleFunc, ms ...Middleware) *Route {
+	return g.addRoute(http.MethodGet, path, handleFunc, ms...)
+}
+
+func (g *Group) Post(path string, handleFunc HandleFunc, ms ...Middleware) *Route {
+	return g.addRoute(http.MethodPost, path, handleFunc, ms...)
+}
+
+func (g *Group) Delete(path string, handleFunc HandleFunc, ms ...Middleware) *Route {
+	return g.addRoute(http.MethodDelete, path, handleFunc, ms...)
+}
+
+func (g *Group) PUT(path string, handleFunc HandleFunc, ms ...Middleware) *Route {
+	return g.addRoute(http.MethodPut, path, handleFunc, ms...)
+}
+
+func (g *Group) Options(path string, handleFunc HandleFunc, ms ...Middleware) *Route {
+	return g.addRoute(http.MethodOptions, path, handleFunc, ms...)
+}
+
+// addRoute path 为 / 的时候注册的是前缀本身
+func (g *Group) addRoute(method, path string, handleFunc HandleFunc, ms ...Middleware) *Route {
+	if path == "" || path[0] != '/' {
+		panic("web: 路由必须以 / 开头")
+	}
+	full := g.prefix
+	if path != "/" {
+		full += path
+	}
+	n := g.server.addRoute(method, full, g.wrap(handleFunc, ms))
+	n.authz = &routeAuthz{group: g}
+	return &Route{n: n}
+}
+
+// wrap 注册的时候就把组的中间件和路由自己的中间件套在 handler 外面，外层组的中间件先执行。
+// 不放在路由树的节点上，否则会作用到同一路径下不属于这个组的路由
+func (g *Group) wrap(handleFunc HandleFunc, ms []Middleware) HandleFunc {
+	for i := len(ms) - 1; i >= 0; i-- {
+		handleFunc = ms[i](handleFunc)
+	}
+	for cur := g; cur != nil; cur = cur.parent {
+		for i := len(cur.mdls) - 1; i >= 0; i-- {
+			handleFunc = cur.mdls[i](handleFunc)
+		}
+	}
+	return handleFunc
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofaquan/go-http/middleware/metrics"
+	"github.com/gofaquan/go-http/middleware/ratelimit"
+)
+
+// unmatchedRoute 找不到路由的请求使用的 route 标签，不能用原始路径，否则时间序列会无限增长
+const unmatchedRoute = "unmatched"
+
+type metricsConfig struct {
+	namespace string
+	buckets   []float64
+}
+
+type MetricsOption func(cfg *metricsConfig)
+
+// WithMetricsNamespace 指标名的前缀，例如 myapp 会得到 myapp_http_requests_total
+func WithMetricsNamespace(namespace string) MetricsOption {
+	return func(cfg *metricsConfig) {
+		cfg.namespace = namespace
+	}
+}
+
+// WithMetricsBuckets 请求耗时的桶，单位是秒，默认 metrics.DefBuckets
+func WithMetricsBuckets(buckets ...float64) MetricsOption {
+	return func(cfg *metricsConfig) {
+		cfg.buckets = buckets
+	}
+}
+
+func (cfg *metricsConfig) name(name string) string {
+	if cfg.namespace == "" {
+		return name
+	}
+	return cfg.namespace + "_" + name
+}
+
+// Metrics 按照请求方法、路由和状态码统计请求数和耗时，以及正在处理的请求数。
+// route 标签使用 ctx.MatchedRoute，例如 /user/:id，找不到路由的时候是 unmatched。
+// 一般通过 HTTPServer.Use 注册，配合 MetricsHandler 暴露 /metrics
+func Metrics(registry *metrics.Registry, opts ...MetricsOption) Middleware {
+	cfg := &metricsConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	requests := registry.Counter(cfg.name("http_requests_total"),
+		"处理完成的 HTTP 请求数", "method", "route", "status")
+	duration := registry.Histogram(cfg.name("http_request_duration_seconds"),
+		"HTTP 请求的处理耗时", cfg.buckets, "method", "route")
+	inFlight := registry.Gauge(cfg.name("http_requests_in_flight"),
+		"正在处理的 HTTP 请求数", "method", "route")
+	size := registry.Counter(cfg.name("http_response_size_bytes_total"),
+		"响应体的总字节数", "method", "route")
+
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			method := metricsMethod(ctx.Request.Method)
+			route := ctx.MatchedRoute
+			if route == "" {
+				route = unmatchedRoute
+			}
+			gauge := inFlight.With(method, route)
+			gauge.Inc()
+			start := time.Now()
+			defer func() {
+				gauge.Dec()
+				duration.With(method, route).Observe(time.Since(start).Seconds())
+				requests.With(method, route, strconv.Itoa(ctx.responseStatus())).Inc()
+				size.With(method, route).Add(float64(ctx.responseSize()))
+			}()
+			next(ctx)
+		}
+	}
+}
+
+// metricsMethod 请求方法是客户端随意填写的，不是标准方法的时候统一记为 OTHER，避免产生无限多的时间序列
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// MetricsHandler 以 Prometheus 文本格式输出 registry 里面的所有指标
+//
+//	s.Get("/metrics", MetricsHandler(registry))
+func MetricsHandler(registry *metrics.Registry) HandleFunc {
+	return func(ctx *Context) {
+		buf := &bytes.Buffer{}
+		_, _ = registry.WriteTo(buf)
+		ctx.ResponseWriter.Header().Set("Content-Type", metrics.ContentType)
+		ctx.StatusCode = http.StatusOK
+		ctx.ResponseData = buf.Bytes()
+	}
+}
+
+// RateLimitMetrics 统计限流器的等待时间，name 用来区分不同的限流器
+//
+//	s.Get("/search", handler, RateLimit(time.Second, 100, RateLimitMetrics(registry, "search")))
+func RateLimitMetrics(registry *metrics.Registry, name string, opts ...MetricsOption) ratelimit.TbOption {
+	cfg := &metricsConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	wait := registry.Histogram(cfg.name("ratelimit_wait_seconds"),
+		"限流器拿到令牌之前等待的时间", cfg.buckets, "limiter").With(name)
+	return ratelimit.WithWaitObserver(func(d time.Duration) {
+		wait.Observe(d.Seconds())
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gofaquan/go-http/middleware/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	s := NewHTTPServer("test", "")
+	s.Use(Metrics(registry, WithMetricsNamespace("app"), WithMetricsBuckets(0.1, 1)))
+	inFlight := registry.Gauge("app_http_requests_in_flight", "", "method", "route")
+	s.Get("/user/:id", func(ctx *Context) {
+		assert.Equal(t, float64(1), inFlight.With(http.MethodGet, "/user/:id").Value())
+		_ = ctx.StatusOK("ok")
+	})
+	s.Get("/limited", func(ctx *Context) {
+		_ = ctx.StatusOK("ok")
+	}, RateLimit(time.Millisecond, 1, RateLimitMetrics(registry, "limited", WithMetricsNamespace("app"), WithMetricsBuckets(0.1))))
+	s.Get("/metrics", MetricsHandler(registry))
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user/1", nil))
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user/2", nil))
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing/1", nil))
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("XYZ1", "/missing/1", nil))
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("XYZ2", "/missing/1", nil))
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/limited", nil))
+
+	requests := registry.Counter("app_http_requests_total", "", "method", "route", "status")
+	// 使用路由而不是原始路径
+	assert.Equal(t, float64(2), requests.With(http.MethodGet, "/user/:id", "200").Value())
+	assert.Equal(t, float64(1), requests.With(http.MethodGet, unmatchedRoute, "404").Value())
+	// 非标准的方法合并成 OTHER
+	assert.Equal(t, float64(2), requests.With("OTHER", unmatchedRoute, "404").Value())
+	assert.Equal(t, float64(0), inFlight.With(http.MethodGet, "/user/:id").Value())
+	duration := registry.Histogram("app_http_request_duration_seconds", "", []float64{0.1, 1}, "method", "route")
+	assert.Equal(t, uint64(2), duration.With(http.MethodGet, "/user/:id").Count())
+	size := registry.Counter("app_http_response_size_bytes_total", "", "method", "route")
+	assert.Equal(t, float64(4), size.With(http.MethodGet, "/user/:id").Value())
+	wait := registry.Histogram("app_ratelimit_wait_seconds", "", []float64{0.1}, "limiter")
+	assert.Equal(t, uint64(1), wait.With("limited").Count())
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, metrics.ContentType, recorder.Header().Get("Content-Type"))
+	body := recorder.Body.String()
+	assert.Contains(t, body, `app_http_requests_total{method="GET",route="/user/:id",status="200"} 2`)
+	assert.Contains(t, body, `app_http_request_duration_seconds_bucket{method="GET",route="/user/:id",le="+Inf"} 2`)
+	assert.Contains(t, body, `app_ratelimit_wait_seconds_count{limiter="limited"} 1`)
+	// /metrics 自己还没有处理完，不会出现在 requests_total 里面
+	assert.NotContains(t, body, `route="/metrics",status`)
+	assert.Contains(t, body, `app_http_requests_in_flight{method="GET",route="/metrics"} 1`)
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strings"
+)
+
+// APIKeyAuth 从请求头里面读取 API key，默认读取 X-API-Key 和 Authorization: Bearer
+type APIKeyAuth struct {
+	header string
+	bearer bool
+	query  string
+	lookup func(key string) (*Principal, error)
+}
+
+type APIKeyOption func(a *APIKeyAuth)
+
+// WithAPIKeyHeader 读取 API key 的请求头，默认 X-API-Key，传空字符串表示不读取
+func WithAPIKeyHeader(header string) APIKeyOption {
+	return func(a *APIKeyAuth) {
+		a.header = header
+	}
+}
+
+// WithAPIKeyBearer 是否从 Authorization: Bearer 读取，默认读取。
+// 和 JWT 一起使用的时候，不认识的 Bearer 会交给下一个 Authenticator
+func WithAPIKeyBearer(bearer bool) APIKeyOption {
+	return func(a *APIKeyAuth) {
+		a.bearer = bearer
+	}
+}
+
+// WithAPIKeyQuery 从查询参数读取，默认不读取。查询参数会出现在访问日志里面，尽量不要使用
+func WithAPIKeyQuery(param string) APIKeyOption {
+	return func(a *APIKeyAuth) {
+		a.query = param
+	}
+}
+
+// NewAPIKeyAuth lookup 根据 key 查找调用方，找不到的时候返回 ErrInvalidCredentials
+func NewAPIKeyAuth(lookup func(key string) (*Principal, error), opts ...APIKeyOption) *APIKeyAuth {
+	a := &APIKeyAuth{header: "X-API-Key", bearer: true, lookup: lookup}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func (a *APIKeyAuth) Authenticate(r *http.Request) (*Principal, error) {
+	if a.header != "" {
+		if key := r.Header.Get(a.header); key != "" {
+			return a.lookup(key)
+		}
+	}
+	if a.query != "" {
+		if key := r.URL.Query().Get(a.query); key != "" {
+			return a.lookup(key)
+		}
+	}
+	if a.bearer {
+		if key, ok := bearerToken(r); ok {
+			p, err := a.lookup(key)
+			if err != nil {
+				// 可能是 JWT，交给后面的 Authenticator
+				return nil, ErrNoCredentials
+			}
+			return p, nil
+		}
+	}
+	return nil, ErrNoCredentials
+}
+
+func (a *APIKeyAuth) Challenge() string {
+	return "Bearer"
+}
+
+// StaticAPIKeys 固定的 API key，保存的是 sha256，查找的时间和 key 的内容无关。
+// 返回的 Principal 是复制出来的，Method 为 apikey
+func StaticAPIKeys(keys map[string]*Principal) func(key string) (*Principal, error) {
+	hashed := make(map[[32]byte]*Principal, len(keys))
+	for k, p := range keys {
+		hashed[sha256.Sum256([]byte(k))] = p
+	}
+	return func(key string) (*Principal, error) {
+		p, ok := hashed[sha256.Sum256([]byte(key))]
+		if !ok {
+			return nil, ErrInvalidCredentials
+		}
+		res := *p
+		res.Method = "apikey"
+		return &res, nil
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrNoCredentials 请求里面没有这种认证方式的凭证，会继续尝试下一个 Authenticator
+	ErrNoCredentials = errors.New("auth: 没有认证信息")
+	// ErrInvalidCredentials 凭证不对，不会再尝试其它 Authenticator
+	ErrInvalidCredentials = errors.New("auth: 认证信息错误")
+)
+
+// Principal 认证通过之后的调用方
+type Principal struct {
+	// Subject 用户名、API key 的名字或者 JWT 的 sub
+	Subject string
+	// Method 认证方式，例如 basic、apikey、jwt
+	Method string
+	Roles  []string
+	Scopes []string
+	// Claims JWT 的全部声明，其它认证方式为 nil
+	Claims map[string]any
+}
+
+// HasRole 是否拥有角色 role
+func (p *Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+// HasScope 是否拥有权限范围 scope
+func (p *Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator 从请求里面认证调用方。
+// 请求里面没有对应凭证的时候返回 ErrNoCredentials，凭证错误的时候返回 ErrInvalidCredentials 或者包装了它的错误
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return f(r)
+}
+
+// Challenger 认证失败的时候返回 WWW-Authenticate 的值
+type Challenger interface {
+	Challenge() string
+}
+
+type principalKey struct{}
+
+// WithPrincipal 把 Principal 放进 context.Context，拿不到 *Context 的地方可以通过 PrincipalFrom 取出来
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom 没有认证的时候返回 nil
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
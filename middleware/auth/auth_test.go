@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	require.NoError(t, os.WriteFile(path, []byte("# users\nalice:"+string(hash)+"\n\n"), 0o600))
+	htpasswd, err := LoadHtpasswd(path)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		verify  func(user, password string) bool
+		user    string
+		pass    string
+		noAuth  bool
+		wantErr error
+	}{
+		{name: "htpasswd", verify: htpasswd.Verify, user: "alice", pass: "s3cret"},
+		{name: "htpasswd wrong password", verify: htpasswd.Verify, user: "alice", pass: "x", wantErr: ErrInvalidCredentials},
+		{name: "htpasswd unknown user", verify: htpasswd.Verify, user: "bob", pass: "s3cret", wantErr: ErrInvalidCredentials},
+		{name: "static users", verify: BasicUsers(map[string]string{"bob": "pw"}), user: "bob", pass: "pw"},
+		{name: "static users wrong password", verify: BasicUsers(map[string]string{"bob": "pw"}), user: "bob", pass: "pw2", wantErr: ErrInvalidCredentials},
+		{name: "no credentials", verify: htpasswd.Verify, noAuth: true, wantErr: ErrNoCredentials},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if !tc.noAuth {
+				req.SetBasicAuth(tc.user, tc.pass)
+			}
+			p, err := NewBasicAuth("admin", tc.verify).Authenticate(req)
+			assert.Equal(t, tc.wantErr, err)
+			if err == nil {
+				assert.Equal(t, &Principal{Subject: tc.user, Method: "basic"}, p)
+			}
+		})
+	}
+	assert.Equal(t, `Basic realm="admin", charset="UTF-8"`, NewBasicAuth("admin", nil).Challenge())
+
+	require.NoError(t, os.WriteFile(path, []byte("alice:plain\n"), 0o600))
+	assert.Error(t, htpasswd.Reload())
+	// 加载失败的时候保留原来的用户
+	assert.True(t, htpasswd.Verify("alice", "s3cret"))
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	a := NewAPIKeyAuth(StaticAPIKeys(map[string]*Principal{
+		"key-1": {Subject: "ci", Scopes: []string{"deploy"}},
+	}), WithAPIKeyQuery("api_key"))
+
+	testCases := []struct {
+		name    string
+		req     func(r *http.Request)
+		wantErr error
+	}{
+		{name: "header", req: func(r *http.Request) { r.Header.Set("X-API-Key", "key-1") }},
+		{name: "bearer", req: func(r *http.Request) { r.Header.Set("Authorization", "Bearer key-1") }},
+		{name: "query", req: func(r *http.Request) { r.URL.RawQuery = "api_key=key-1" }},
+		{name: "wrong header", req: func(r *http.Request) { r.Header.Set("X-API-Key", "key-2") }, wantErr: ErrInvalidCredentials},
+		// 不认识的 Bearer 可能是 JWT
+		{name: "unknown bearer", req: func(r *http.Request) { r.Header.Set("Authorization", "Bearer a.b.c") }, wantErr: ErrNoCredentials},
+		{name: "none", req: func(r *http.Request) {}, wantErr: ErrNoCredentials},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tc.req(req)
+			p, err := a.Authenticate(req)
+			assert.Equal(t, tc.wantErr, err)
+			if err == nil {
+				assert.Equal(t, &Principal{Subject: "ci", Method: "apikey", Scopes: []string{"deploy"}}, p)
+			}
+		})
+	}
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signJWT 测试用的签名，key 是 []byte、*rsa.PrivateKey 或者 *ecdsa.PrivateKey
+func signJWT(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, err := json.Marshal(header)
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := b64(h) + "." + b64(c)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + b64(sig)
+}
+
+func TestJWTAuth(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	valid := func() map[string]any {
+		return map[string]any{
+			"sub":   "user-1",
+			"iss":   "https://issuer.example.com",
+			"aud":   []string{"api", "web"},
+			"exp":   now.Add(time.Minute).Unix(),
+			"nbf":   now.Add(-time.Minute).Unix(),
+			"scope": "read write",
+			"roles": []string{"admin"},
+		}
+	}
+	with := func(k string, v any) map[string]any {
+		c := valid()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+	opts := []JWTOption{
+		WithJWTIssuer("https://issuer.example.com"),
+		WithJWTAudience("api"),
+		WithJWTClock(func() time.Time { return now }),
+	}
+
+	testCases := []struct {
+		name    string
+		keys    KeySource
+		token   string
+		wantErr error
+	}{
+		{name: "HS256", keys: HMACSecret(secret), token: signJWT(t, AlgHS256, "", secret, valid())},
+		{name: "RS256", keys: PublicKey(&rsaKey.PublicKey), token: signJWT(t, AlgRS256, "", rsaKey, valid())},
+		{name: "ES256", keys: PublicKey(&ecKey.PublicKey), token: signJWT(t, AlgES256, "", ecKey, valid())},
+		{name: "wrong secret", keys: HMACSecret([]byte("other")), token: signJWT(t, AlgHS256, "", secret, valid()), wantErr: ErrInvalidSignature},
+		// 用公钥当作 HMAC 密钥伪造签名
+		{name: "alg confusion", keys: PublicKey(&rsaKey.PublicKey), token: signJWT(t, AlgHS256, "", []byte("pub"), valid()), wantErr: ErrUnsupportedAlg},
+		{name: "alg none", keys: HMACSecret(secret), token: b64([]byte(`{"alg":"none"}`)) + "." + b64([]byte(`{"sub":"x"}`)) + ".", wantErr: ErrUnsupportedAlg},
+		{name: "expired", keys: HMACSecret(secret), token: signJWT(t, AlgHS256, "", secret, with("exp", now.Add(-time.Minute).Unix())), wantErr: ErrTokenExpired},
+		{name: "expired within leeway", keys: HMACSecret(secret), token: signJWT(t, AlgHS256, "", secret, with("exp", now.Add(-10*time.Second).Unix()))},
+		{name: "no exp", keys: HMACSecret(secret), token: signJWT(t, AlgHS256, "", secret, with("exp", nil)), wantErr: ErrInvalidCredentials},
+		{name: "not yet valid", keys: HMACSecret(secret), token: signJWT(t, AlgHS256, "", secret, with("nbf", now.Add(time.Minute).Unix())), wantErr: ErrTokenNotYetValid},
+		{name: "wrong issuer", keys: HMACSecret(secret), token: signJWT(t, AlgHS256, "", secret, with("iss", "evil")), wantErr: ErrInvalidIssuer},
+		{name: "wrong audience", keys: HMACSecret(secret), token: signJWT(t, AlgHS256, "", secret, with("aud", "web")), wantErr: ErrInvalidAudience},
+		{name: "audience string", keys: HMACSecret(secret), token: signJWT(t, AlgHS256, "", secret, with("aud", "api"))},
+		{name: "malformed", keys: HMACSecret(secret), token: "a.b", wantErr: ErrMalformedToken},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			p, err := NewJWTAuth(tc.keys, opts...).Authenticate(req)
+			assert.True(t, errors.Is(err, tc.wantErr), "%v", err)
+			if tc.wantErr != nil {
+				assert.True(t, errors.Is(err, ErrInvalidCredentials))
+				return
+			}
+			assert.Equal(t, "user-1", p.Subject)
+			assert.Equal(t, "jwt", p.Method)
+			assert.Equal(t, []string{"read", "write"}, p.Scopes)
+			assert.True(t, p.HasRole("admin"))
+			assert.True(t, p.HasScope("write"))
+		})
+	}
+
+	_, err = NewJWTAuth(HMACSecret(secret)).Authenticate(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, ErrNoCredentials, err)
+	// 只允许 RS256 的时候拒绝 HS256
+	_, err = NewJWTAuth(HMACSecret(secret), append(opts, WithJWTAlgorithms(AlgRS256))...).Verify(context.Background(),
+		signJWT(t, AlgHS256, "", secret, valid()))
+	assert.Equal(t, ErrUnsupportedAlg, err)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": AlgRS256,
+		"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	keys := []any{
+		rsaJWK("rsa-1", &rsaKey.PublicKey),
+		map[string]string{
+			"kty": "EC", "kid": "ec-1", "crv": "P-256",
+			"x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+		// 不支持的密钥会被忽略
+		map[string]string{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "abc"},
+		map[string]string{"kty": "RSA", "kid": "enc", "use": "enc", "n": "abc", "e": "AQAB"},
+	}
+	var fetches int32
+	var current atomic.Value
+	setKeys := func(keys []any) {
+		data, err := json.Marshal(map[string]any{"keys": keys})
+		require.NoError(t, err)
+		current.Store(data)
+	}
+	setKeys(keys)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		_, _ = w.Write(current.Load().([]byte))
+	}))
+	defer server.Close()
+
+	clock := now
+	jwks := NewJWKSFromURL(server.URL, nil, WithJWKSClock(func() time.Time { return clock }))
+	ja := NewJWTAuth(jwks, WithJWTClock(func() time.Time { return now }))
+	claims := map[string]any{"sub": "u", "exp": now.Add(time.Hour).Unix()}
+
+	_, err = ja.Verify(context.Background(), signJWT(t, AlgRS256, "rsa-1", rsaKey, claims))
+	require.NoError(t, err)
+	_, err = ja.Verify(context.Background(), signJWT(t, AlgES256, "ec-1", ecKey, claims))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+	// 密钥声明了 alg 的时候不能用于其它算法
+	_, err = ja.Verify(context.Background(), signJWT(t, AlgHS256, "rsa-1", []byte("x"), claims))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// 密钥轮换：不认识的 kid 在限制的频率内重新加载
+	setKeys(append(keys, rsaJWK("rsa-2", &rotated.PublicKey)))
+	token := signJWT(t, AlgRS256, "rsa-2", rotated, claims)
+	_, err = ja.Verify(context.Background(), token)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+	clock = clock.Add(2 * minJWKSRefetch)
+	_, err = ja.Verify(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+
+	// 缓存过期之后重新加载，加载失败的时候继续使用旧的密钥
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	clock = clock.Add(2 * defaultJWKSRefresh)
+	_, err = ja.Verify(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&fetches))
+
+	// 从文件加载
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, current.Load().([]byte), 0o600))
+	fileJWKS, err := NewJWKSFromFile(path)
+	require.NoError(t, err)
+	_, err = NewJWTAuth(fileJWKS, WithJWTClock(func() time.Time { return now })).Verify(context.Background(), token)
+	require.NoError(t, err)
+	_, err = NewJWKSFromFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicAuth HTTP Basic 认证，密码校验交给 verify
+type BasicAuth struct {
+	realm  string
+	verify func(user, password string) bool
+}
+
+// NewBasicAuth verify 必须自己保证常量时间比较，一般使用 BasicUsers 或者 Htpasswd
+func NewBasicAuth(realm string, verify func(user, password string) bool) *BasicAuth {
+	return &BasicAuth{realm: realm, verify: verify}
+}
+
+func (b *BasicAuth) Authenticate(r *http.Request) (*Principal, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	if !b.verify(user, password) {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Subject: user, Method: "basic"}, nil
+}
+
+func (b *BasicAuth) Challenge() string {
+	return `Basic realm="` + strings.ReplaceAll(b.realm, `"`, `'`) + `", charset="UTF-8"`
+}
+
+// BasicUsers 用户名到明文密码的映射，只适合测试或者内部工具。
+// 先做 sha256 再比较，这样比较的时间和密码的长度无关
+func BasicUsers(users map[string]string) func(user, password string) bool {
+	hashed := make(map[string][32]byte, len(users))
+	for u, p := range users {
+		hashed[u] = sha256.Sum256([]byte(p))
+	}
+	return func(user, password string) bool {
+		want, ok := hashed[user]
+		got := sha256.Sum256([]byte(password))
+		// 用户不存在的时候也做一次比较
+		return subtle.ConstantTimeCompare(want[:], got[:]) == 1 && ok
+	}
+}
+
+// Htpasswd 从 htpasswd 文件加载的用户，只支持 bcrypt（htpasswd -B）
+type Htpasswd struct {
+	path  string
+	mu    sync.RWMutex
+	users map[string][]byte
+}
+
+// dummyHash 用户不存在的时候用来比较，让响应时间和用户存在的时候一样。
+// 生成 bcrypt 很慢，第一次用到的时候再生成
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// LoadHtpasswd 加载 htpasswd 文件，不是 bcrypt 的行会返回错误
+func LoadHtpasswd(path string) (*Htpasswd, error) {
+	h := &Htpasswd{path: path}
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Reload 重新读取文件，失败的时候保留原来的用户
+func (h *Htpasswd) Reload() error {
+	f, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	users := map[string][]byte{}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(text, ":")
+		if !ok || user == "" {
+			return fmt.Errorf("auth: %s 第 %d 行格式错误", h.path, line)
+		}
+		if _, err = bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("auth: %s 第 %d 行不是 bcrypt 密码", h.path, line)
+		}
+		users[user] = []byte(hash)
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	h.users = users
+	h.mu.Unlock()
+	return nil
+}
+
+// Verify 校验用户名和密码，可以传给 NewBasicAuth
+func (h *Htpasswd) Verify(user, password string) bool {
+	h.mu.RLock()
+	hash, ok := h.users[user]
+	h.mu.RUnlock()
+	if !ok {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+		})
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJWKSRefresh = time.Hour
+	// minJWKSRefetch 找不到 kid 的时候最多这么久重新拉取一次，避免伪造的 kid 把密钥服务打垮
+	minJWKSRefetch = time.Minute
+	maxJWKSSize    = 1 << 20
+)
+
+// JWKS 从文件或者 URL 加载的一组公钥，按照 kid 查找。
+// 密钥会缓存一段时间，过期或者遇到不认识的 kid 的时候重新加载，加载失败的时候继续使用旧的密钥
+type JWKS struct {
+	load    func(ctx context.Context) ([]byte, error)
+	refresh time.Duration
+	now     func() time.Time
+
+	// loadMu 保证同时只有一个 goroutine 在加载
+	loadMu sync.Mutex
+	mu     sync.RWMutex
+	keys   map[string]jwk
+	// loadedAt 上次加载成功的时间，attemptAt 上次尝试加载的时间
+	loadedAt  time.Time
+	attemptAt time.Time
+}
+
+type jwk struct {
+	alg string
+	key any
+}
+
+type JWKSOption func(j *JWKS)
+
+// WithJWKSRefresh 缓存的时间，默认 1 小时
+func WithJWKSRefresh(d time.Duration) JWKSOption {
+	return func(j *JWKS) {
+		j.refresh = d
+	}
+}
+
+// WithJWKSClock 测试用
+func WithJWKSClock(now func() time.Time) JWKSOption {
+	return func(j *JWKS) {
+		j.now = now
+	}
+}
+
+// NewJWKSFromFile 立刻加载一次，文件不存在或者格式错误的时候返回错误
+func NewJWKSFromFile(path string, opts ...JWKSOption) (*JWKS, error) {
+	j := newJWKS(func(ctx context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}, opts)
+	if err := j.reload(context.Background()); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// NewJWKSFromURL 第一次校验 token 的时候才会加载，client 为 nil 的时候使用超时 10 秒的 http.Client
+func NewJWKSFromURL(url string, client *http.Client, opts ...JWKSOption) *JWKS {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return newJWKS(func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("auth: 加载 JWKS 失败 %s", resp.Status)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	}, opts)
+}
+
+func newJWKS(load func(ctx context.Context) ([]byte, error), opts []JWKSOption) *JWKS {
+	j := &JWKS{load: load, refresh: defaultJWKSRefresh, now: time.Now}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+func (j *JWKS) Key(ctx context.Context, kid, alg string) (any, error) {
+	j.mu.RLock()
+	stale := j.now().Sub(j.loadedAt) >= j.refresh
+	key, ok := j.lookup(kid)
+	j.mu.RUnlock()
+
+	if stale || !ok {
+		// 过期了但是加载失败的时候仍然使用旧的密钥
+		if err := j.reloadIfAllowed(ctx); err != nil && !ok {
+			return nil, err
+		}
+		j.mu.RLock()
+		key, ok = j.lookup(kid)
+		j.mu.RUnlock()
+	}
+	if !ok {
+		return nil, errKeyNotFound
+	}
+	if key.alg != "" && key.alg != alg {
+		return nil, fmt.Errorf("auth: 密钥 %s 只能用于 %s", kid, key.alg)
+	}
+	return key.key, nil
+}
+
+// lookup 没有 kid 的时候只有一个密钥才能确定使用哪个
+func (j *JWKS) lookup(kid string) (jwk, bool) {
+	if kid == "" {
+		if len(j.keys) != 1 {
+			return jwk{}, false
+		}
+		for _, k := range j.keys {
+			return k, true
+		}
+	}
+	k, ok := j.keys[kid]
+	return k, ok
+}
+
+// reloadIfAllowed 距离上次尝试加载不到 minJWKSRefetch 的时候不再加载，
+// 等锁的时候别的 goroutine 已经加载过了也会在这里返回
+func (j *JWKS) reloadIfAllowed(ctx context.Context) error {
+	j.loadMu.Lock()
+	defer j.loadMu.Unlock()
+	j.mu.RLock()
+	attemptAt := j.attemptAt
+	j.mu.RUnlock()
+	if !attemptAt.IsZero() && j.now().Sub(attemptAt) < minJWKSRefetch {
+		return nil
+	}
+	return j.reload(ctx)
+}
+
+func (j *JWKS) reload(ctx context.Context) error {
+	j.mu.Lock()
+	j.attemptAt = j.now()
+	j.mu.Unlock()
+	data, err := j.load(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	j.keys = keys
+	j.loadedAt = j.now()
+	j.mu.Unlock()
+	return nil
+}
+
+type jwkJSON struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS 只保留用于签名的 RSA 和 P-256 密钥，其它的忽略
+func parseJWKS(data []byte) (map[string]jwk, error) {
+	var set struct {
+		Keys []jwkJSON `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("auth: JWKS 格式错误 %w", err)
+	}
+	keys := make(map[string]jwk, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key any
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = parseRSAJWK(k)
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			key, err = parseECJWK(k)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("auth: JWKS 密钥 %s 格式错误 %w", k.Kid, err)
+		}
+		keys[k.Kid] = jwk{alg: k.Alg, key: key}
+	}
+	return keys, nil
+}
+
+func parseRSAJWK(k jwkJSON) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("非法的指数")
+	}
+	exp := 0
+	for _, b := range e {
+		exp = exp<<8 | int(b)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, nil
+}
+
+func parseECJWK(k jwkJSON) (*ecdsa.PublicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	curve := elliptic.P256()
+	pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, fmt.Errorf("点不在曲线上")
+	}
+	return pub, nil
+}
@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+var (
+	ErrMalformedToken   = fmt.Errorf("%w: token 格式错误", ErrInvalidCredentials)
+	ErrUnsupportedAlg   = fmt.Errorf("%w: 不支持的签名算法", ErrInvalidCredentials)
+	ErrInvalidSignature = fmt.Errorf("%w: 签名错误", ErrInvalidCredentials)
+	ErrTokenExpired     = fmt.Errorf("%w: token 已经过期", ErrInvalidCredentials)
+	ErrTokenNotYetValid = fmt.Errorf("%w: token 还没有生效", ErrInvalidCredentials)
+	ErrInvalidIssuer    = fmt.Errorf("%w: iss 不匹配", ErrInvalidCredentials)
+	ErrInvalidAudience  = fmt.Errorf("%w: aud 不匹配", ErrInvalidCredentials)
+)
+
+// KeySource 根据 JWT 头部的 kid 和 alg 返回校验签名的密钥，
+// HS256 是 []byte，RS256 是 *rsa.PublicKey，ES256 是 *ecdsa.PublicKey
+type KeySource interface {
+	Key(ctx context.Context, kid, alg string) (any, error)
+}
+
+type KeySourceFunc func(ctx context.Context, kid, alg string) (any, error)
+
+func (f KeySourceFunc) Key(ctx context.Context, kid, alg string) (any, error) {
+	return f(ctx, kid, alg)
+}
+
+// HMACSecret HS256 使用的共享密钥
+func HMACSecret(secret []byte) KeySource {
+	return KeySourceFunc(func(ctx context.Context, kid, alg string) (any, error) {
+		return secret, nil
+	})
+}
+
+// PublicKey 固定的公钥，*rsa.PublicKey 或者 *ecdsa.PublicKey
+func PublicKey(key crypto.PublicKey) KeySource {
+	return KeySourceFunc(func(ctx context.Context, kid, alg string) (any, error) {
+		return key, nil
+	})
+}
+
+// JWTAuth 校验 Authorization: Bearer 里面的 JWT
+type JWTAuth struct {
+	keys     KeySource
+	algs     map[string]bool
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+type JWTOption func(j *JWTAuth)
+
+// WithJWTAlgorithms 允许的签名算法，默认 HS256、RS256、ES256。
+// 不管怎么设置，算法都必须和 KeySource 返回的密钥类型匹配
+func WithJWTAlgorithms(algs ...string) JWTOption {
+	return func(j *JWTAuth) {
+		j.algs = make(map[string]bool, len(algs))
+		for _, alg := range algs {
+			j.algs[alg] = true
+		}
+	}
+}
+
+// WithJWTIssuer 要求 iss 等于 issuer
+func WithJWTIssuer(issuer string) JWTOption {
+	return func(j *JWTAuth) {
+		j.issuer = issuer
+	}
+}
+
+// WithJWTAudience 要求 aud 包含 audience
+func WithJWTAudience(audience string) JWTOption {
+	return func(j *JWTAuth) {
+		j.audience = audience
+	}
+}
+
+// WithJWTLeeway 校验 exp 和 nbf 时允许的时钟误差，默认 30 秒
+func WithJWTLeeway(d time.Duration) JWTOption {
+	return func(j *JWTAuth) {
+		j.leeway = d
+	}
+}
+
+// WithJWTClock 测试用
+func WithJWTClock(now func() time.Time) JWTOption {
+	return func(j *JWTAuth) {
+		j.now = now
+	}
+}
+
+func NewJWTAuth(keys KeySource, opts ...JWTOption) *JWTAuth {
+	j := &JWTAuth{
+		keys:   keys,
+		algs:   map[string]bool{AlgHS256: true, AlgRS256: true, AlgES256: true},
+		leeway: 30 * time.Second,
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+func (j *JWTAuth) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	return j.Verify(r.Context(), token)
+}
+
+func (j *JWTAuth) Challenge() string {
+	return "Bearer"
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify 校验签名以及 exp、nbf、iss、aud，exp 是必须的
+func (j *JWTAuth) Verify(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	var header jwtHeader
+	if err = json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrMalformedToken
+	}
+	// alg 为 none 或者没有允许的算法一律拒绝
+	if !j.algs[header.Alg] {
+		return nil, ErrUnsupportedAlg
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	key, err := j.keys.Key(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var claims map[string]any
+	if err = dec.Decode(&claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+	if err = j.validate(claims); err != nil {
+		return nil, err
+	}
+	return principalFromClaims(claims), nil
+}
+
+func verifySignature(alg string, key any, signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+	switch alg {
+	case AlgHS256:
+		secret, ok := key.([]byte)
+		if !ok || len(secret) == 0 {
+			return ErrUnsupportedAlg
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return ErrInvalidSignature
+		}
+	case AlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok || pub.N.BitLen() < 2048 {
+			return ErrUnsupportedAlg
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return ErrInvalidSignature
+		}
+	case AlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return ErrUnsupportedAlg
+		}
+		// JWS 的 ECDSA 签名是定长的 r||s，不是 ASN.1
+		if len(sig) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnsupportedAlg
+	}
+	return nil
+}
+
+func (j *JWTAuth) validate(claims map[string]any) error {
+	now := j.now()
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return fmt.Errorf("%w: 缺少 exp", ErrInvalidCredentials)
+	}
+	if !now.Before(exp.Add(j.leeway)) {
+		return ErrTokenExpired
+	}
+	if _, present := claims["nbf"]; present {
+		nbf, ok := numericDate(claims["nbf"])
+		if !ok {
+			return ErrMalformedToken
+		}
+		if now.Add(j.leeway).Before(nbf) {
+			return ErrTokenNotYetValid
+		}
+	}
+	if j.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != j.issuer {
+			return ErrInvalidIssuer
+		}
+	}
+	if j.audience != "" && !contains(stringList(claims["aud"]), j.audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+func numericDate(v any) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+}
+
+// stringList 声明可以是单个字符串，也可以是字符串数组
+func stringList(v any) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []any:
+		res := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// principalFromClaims scope 是空格分隔的字符串（RFC 8693），scp 和 roles 可以是字符串或者数组
+func principalFromClaims(claims map[string]any) *Principal {
+	p := &Principal{Method: "jwt", Claims: claims}
+	p.Subject, _ = claims["sub"].(string)
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	} else if scp, ok := claims["scp"].(string); ok {
+		p.Scopes = strings.Fields(scp)
+	} else {
+		p.Scopes = stringList(claims["scp"])
+	}
+	p.Roles = stringList(claims["roles"])
+	return p
+}
+
+// errKeyNotFound JWKS 里面找不到 kid 对应的密钥
+var errKeyNotFound = errors.New("auth: 找不到签名密钥")
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets 和 Prometheus 客户端默认的桶一样，单位是秒
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricType string
+
+const (
+	typeCounter   metricType = "counter"
+	typeGauge     metricType = "gauge"
+	typeHistogram metricType = "histogram"
+)
+
+// labelSep 拼接标签值作为 map 的 key，正常的标签值里面不会出现
+const labelSep = "\xff"
+
+// family 同一个名字、不同标签值的一组时间序列
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	labels  []string
+	buckets []float64
+
+	mu     sync.RWMutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	// value counter 和 gauge 的值，float64 的二进制表示
+	value uint64
+	// 下面是 histogram 的数据，buckets 不是累加的，输出的时候再累加
+	buckets []uint64
+	count   uint64
+	sum     uint64
+}
+
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s 需要 %d 个标签值，传入了 %d 个", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, labelSep)
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok = f.series[key]; ok {
+		return s
+	}
+	s = &series{labelValues: append([]string(nil), values...)}
+	if f.typ == typeHistogram {
+		s.buckets = make([]uint64, len(f.buckets))
+	}
+	f.series[key] = s
+	return s
+}
+
+func addFloat(addr *uint64, delta float64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		val := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(addr, old, val) {
+			return
+		}
+	}
+}
+
+func loadFloat(addr *uint64) float64 {
+	return math.Float64frombits(atomic.LoadUint64(addr))
+}
+
+// Counter 只增不减的计数器
+//
+//	requests := registry.Counter("http_requests_total", "请求总数", "method", "code")
+//	requests.With("GET", "200").Inc()
+type Counter struct {
+	f *family
+}
+
+// With 按照注册时候标签的顺序传入标签值
+func (c *Counter) With(labelValues ...string) CounterSeries {
+	return CounterSeries{s: c.f.with(labelValues)}
+}
+
+type CounterSeries struct {
+	s *series
+}
+
+func (c CounterSeries) Inc() {
+	addFloat(&c.s.value, 1)
+}
+
+// Add delta 不能是负数
+func (c CounterSeries) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counter 不能减少")
+	}
+	addFloat(&c.s.value, delta)
+}
+
+func (c CounterSeries) Value() float64 {
+	return loadFloat(&c.s.value)
+}
+
+// Gauge 可以任意变化的值，例如正在处理的请求数
+type Gauge struct {
+	f *family
+}
+
+func (g *Gauge) With(labelValues ...string) GaugeSeries {
+	return GaugeSeries{s: g.f.with(labelValues)}
+}
+
+type GaugeSeries struct {
+	s *series
+}
+
+func (g GaugeSeries) Set(val float64) {
+	atomic.StoreUint64(&g.s.value, math.Float64bits(val))
+}
+
+func (g GaugeSeries) Inc() {
+	addFloat(&g.s.value, 1)
+}
+
+func (g GaugeSeries) Dec() {
+	addFloat(&g.s.value, -1)
+}
+
+func (g GaugeSeries) Add(delta float64) {
+	addFloat(&g.s.value, delta)
+}
+
+func (g GaugeSeries) Value() float64 {
+	return loadFloat(&g.s.value)
+}
+
+// Histogram 统计分布，例如请求耗时
+type Histogram struct {
+	f *family
+}
+
+func (h *Histogram) With(labelValues ...string) HistogramSeries {
+	return HistogramSeries{s: h.f.with(labelValues), buckets: h.f.buckets}
+}
+
+type HistogramSeries struct {
+	s       *series
+	buckets []float64
+}
+
+func (h HistogramSeries) Observe(val float64) {
+	// 落在第一个上界大于等于 val 的桶里面，比所有上界都大的只算进 +Inf
+	i := sort.SearchFloat64s(h.buckets, val)
+	if i < len(h.buckets) {
+		atomic.AddUint64(&h.s.buckets[i], 1)
+	}
+	addFloat(&h.s.sum, val)
+	atomic.AddUint64(&h.s.count, 1)
+}
+
+// Count 观察到的次数
+func (h HistogramSeries) Count() uint64 {
+	return atomic.LoadUint64(&h.s.count)
+}
+
+func (h HistogramSeries) Sum() float64 {
+	return loadFloat(&h.s.sum)
+}
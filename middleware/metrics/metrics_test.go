@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("http_requests_total", "请求数\n第二行", "method", "path")
+	requests.With("GET", "/b").Inc()
+	requests.With("GET", `/a"\`).Add(2.5)
+	temp := r.Gauge("temperature", "")
+	temp.With().Set(-1.5)
+	latency := r.Histogram("latency_seconds", "耗时", []float64{0.1, 1}, "op")
+	h := latency.With("read")
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(0.5)
+	h.Observe(3)
+	// 没有数据的指标不输出
+	r.Counter("empty_total", "空的")
+
+	buf := &bytes.Buffer{}
+	n, err := r.WriteTo(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	assert.Equal(t, `# HELP http_requests_total 请求数\n第二行
+# TYPE http_requests_total counter
+http_requests_total{method="GET",path="/a\"\\"} 2.5
+http_requests_total{method="GET",path="/b"} 1
+# HELP latency_seconds 耗时
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="read",le="0.1"} 2
+latency_seconds_bucket{op="read",le="1"} 3
+latency_seconds_bucket{op="read",le="+Inf"} 4
+latency_seconds_sum{op="read"} 3.65
+latency_seconds_count{op="read"} 4
+# TYPE temperature gauge
+temperature -1.5
+`, buf.String())
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("a_total", "", "x")
+	// 同样的定义返回同一个指标
+	r.Counter("a_total", "", "x").With("1").Inc()
+	assert.Equal(t, float64(1), c.With("1").Value())
+
+	testCases := []struct {
+		name string
+		fn   func()
+	}{
+		{name: "different type", fn: func() { r.Gauge("a_total", "", "x") }},
+		{name: "different labels", fn: func() { r.Counter("a_total", "", "y") }},
+		{name: "invalid name", fn: func() { r.Counter("1abc", "") }},
+		{name: "invalid label", fn: func() { r.Counter("b_total", "", "a-b") }},
+		{name: "reserved label", fn: func() { r.Counter("b_total", "", "__name") }},
+		{name: "le label", fn: func() { r.Histogram("h", "", nil, "le") }},
+		{name: "unsorted buckets", fn: func() { r.Histogram("h", "", []float64{1, 0.5}) }},
+		{name: "wrong label count", fn: func() { c.With("1", "2") }},
+		{name: "negative counter", fn: func() { c.With("1").Add(-1) }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Panics(t, tc.fn)
+		})
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("c_total", "", "worker")
+	g := r.Gauge("g", "")
+	h := r.Histogram("h", "", nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.With("w").Inc()
+				g.With().Inc()
+				g.With().Dec()
+				h.With().Observe(0.01)
+				if j%100 == 0 {
+					_, _ = r.WriteTo(&bytes.Buffer{})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, float64(8000), c.With("w").Value())
+	assert.Equal(t, float64(0), g.With().Value())
+	assert.Equal(t, uint64(8000), h.With().Count())
+	assert.InDelta(t, 80, h.With().Sum(), 1e-6)
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.Gauge("up", "").With().Set(math.Inf(1))
+	recorder := httptest.NewRecorder()
+	r.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, ContentType, recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE up gauge\nup +Inf\n", recorder.Body.String())
+}
@@ -36,9 +36,19 @@ type TokenBucket struct {
 
 	// 上次填充的时间戳
 	latestTick int64
+
+	// waitObserver 每次 Wait 之后回调等待的时间，用于统计限流的影响
+	waitObserver func(d time.Duration)
 }
 type TbOption func(bucket *TokenBucket)
 
+// WithWaitObserver Wait 和 WaitMaxDuration 拿到令牌之后回调实际等待的时间，没有等待的时候是 0
+func WithWaitObserver(fn func(d time.Duration)) TbOption {
+	return func(bucket *TokenBucket) {
+		bucket.waitObserver = fn
+	}
+}
+
 func WithQuantum(quantum int64) TbOption {
 	return func(bucket *TokenBucket) {
 		bucket.quantum = quantum
@@ -109,6 +119,9 @@ func (tb *TokenBucket) WaitMaxDuration(count int64, maxWait time.Duration) bool
 	if d > 0 {
 		time.Sleep(d)
 	}
+	if ok {
+		tb.observeWait(d)
+	}
 	return ok
 }
 
@@ -149,15 +162,23 @@ func (tb *TokenBucket) take(now time.Time, count int64, maxWait time.Duration) (
 
 // Wait 一直等待到可用
 func (tb *TokenBucket) Wait(count int64) {
-	if d := tb.Take(count); d > 0 {
+	d := tb.Take(count)
+	if d > 0 {
 		time.Sleep(d)
 	}
+	tb.observeWait(d)
+}
+
+func (tb *TokenBucket) observeWait(d time.Duration) {
+	if tb.waitObserver != nil {
+		tb.waitObserver(d)
+	}
 }
 
 // Take 返回拿 count 个需要的时间
 func (tb *TokenBucket) Take(count int64) time.Duration {
 	tb.mu.Lock()
-	tb.mu.Unlock()
+	defer tb.mu.Unlock()
 	d, _ := tb.take(time.Now(), count, infinityDuration)
 	return d
 }
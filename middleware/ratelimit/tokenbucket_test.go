@@ -3,6 +3,7 @@ package ratelimit
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"sync"
 	"testing"
 	"time"
 )
@@ -416,6 +417,51 @@ func (r *rateLimitSuite) TestNoBonusTokenAfterBucketIsFull() {
 	}
 }
 
+func (r *rateLimitSuite) TestWaitObserver() {
+	t := r.T()
+	var waits []time.Duration
+	tb, err := NewBucket(50*time.Millisecond, 1, WithWaitObserver(func(d time.Duration) {
+		waits = append(waits, d)
+	}))
+	assert.Nil(t, err)
+
+	tb.Wait(1)
+	tb.Wait(1)
+	assert.True(t, tb.WaitMaxDuration(1, time.Second))
+	// 拿不到令牌的时候不回调
+	assert.False(t, tb.WaitMaxDuration(10, 0))
+
+	assert.Len(t, waits, 3)
+	assert.Equal(t, time.Duration(0), waits[0])
+	assert.True(t, waits[1] > 0 && waits[1] <= 50*time.Millisecond)
+	assert.True(t, waits[2] > 0 && waits[2] <= 50*time.Millisecond)
+}
+
+// 并发调用 Take 的时候令牌不能被重复发放，配合 -race 检查数据竞争
+func (r *rateLimitSuite) TestTakeConcurrent() {
+	t := r.T()
+	tb, err := NewBucket(time.Hour, 100)
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var waited int
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tb.Take(1) > 0 {
+				mu.Lock()
+				waited++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 100, waited)
+	assert.Equal(t, int64(-100), tb.Available())
+}
+
 func BenchmarkWait(b *testing.B) {
 	tb, _ := NewBucket(1, 16*1024)
 
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// maxTokenSize 浏览器一般只保证 4096 字节以内的 cookie 能够保存下来，留一些给名字和属性
+const maxTokenSize = 3800
+
+var ErrTooLarge = errors.New("session: 会话数据太大，无法保存到 cookie")
+
+// CookieStore 把会话数据签名之后整个放在 cookie 里面，服务端不保存任何状态。
+// 客户端可以看到数据，所以不要放敏感信息；Delete 无法让已经签发的 cookie 失效，只能等它过期
+type CookieStore struct {
+	keys [][]byte
+	now  func() time.Time
+}
+
+// NewCookieStore 第一个密钥用于签名，其余的只用于校验，方便轮换密钥
+func NewCookieStore(keys ...[]byte) *CookieStore {
+	if len(keys) == 0 {
+		panic("session: 至少需要一个密钥")
+	}
+	for _, key := range keys {
+		if len(key) < 32 {
+			panic("session: 密钥至少 32 字节")
+		}
+	}
+	return &CookieStore{keys: keys, now: time.Now}
+}
+
+func (c *CookieStore) Load(ctx context.Context, token string) ([]byte, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrNotFound
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	valid := false
+	for _, key := range c.keys {
+		if hmac.Equal(mac, sign(key, payload)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrNotFound
+	}
+	content, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(content) < 8 || !c.now().Before(expiryOf(content)) {
+		return nil, ErrNotFound
+	}
+	return content[8:], nil
+}
+
+func (c *CookieStore) Save(ctx context.Context, id string, data []byte, expiry time.Time) (string, error) {
+	content := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(data)), uint64(expiry.UnixNano()))
+	content = append(content, data...)
+	payload := base64.RawURLEncoding.EncodeToString(content)
+	token := payload + "." + base64.RawURLEncoding.EncodeToString(sign(c.keys[0], payload))
+	if len(token) > maxTokenSize {
+		return "", ErrTooLarge
+	}
+	return token, nil
+}
+
+func (c *CookieStore) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+func sign(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,152 @@
+package session
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const filePrefix = "sess_"
+
+// FileStore 每个会话保存成一个文件，文件的前 8 个字节是过期时间
+type FileStore struct {
+	dir  string
+	now  func() time.Time
+	stop chan struct{}
+}
+
+// NewFileStore dir 不存在的时候会被创建，gcInterval 小于等于 0 的时候不在后台清理
+func NewFileStore(dir string, gcInterval time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	f := &FileStore{dir: dir, now: time.Now, stop: make(chan struct{})}
+	if gcInterval > 0 {
+		go f.gcLoop(gcInterval)
+	}
+	return f, nil
+}
+
+func (f *FileStore) Load(ctx context.Context, token string) ([]byte, error) {
+	path, ok := f.path(token)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < 8 || !f.now().Before(expiryOf(content)) {
+		return nil, ErrNotFound
+	}
+	return content[8:], nil
+}
+
+func (f *FileStore) Save(ctx context.Context, id string, data []byte, expiry time.Time) (string, error) {
+	path, ok := f.path(id)
+	if !ok {
+		return "", errors.New("session: 非法的会话 ID")
+	}
+	content := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(data)), uint64(expiry.UnixNano()))
+	content = append(content, data...)
+	// 先写临时文件再重命名，避免并发读到写了一半的文件
+	tmp, err := os.CreateTemp(f.dir, "tmp_")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return id, nil
+}
+
+func (f *FileStore) Delete(ctx context.Context, id string) error {
+	path, ok := f.path(id)
+	if !ok {
+		return nil
+	}
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// GC 删除过期的会话文件
+func (f *FileStore) GC() error {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return err
+	}
+	now := f.now()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), filePrefix) {
+			continue
+		}
+		path := filepath.Join(f.dir, entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if len(content) < 8 || !now.Before(expiryOf(content)) {
+			_ = os.Remove(path)
+		}
+	}
+	return nil
+}
+
+// Close 停止后台清理
+func (f *FileStore) Close() error {
+	select {
+	case <-f.stop:
+	default:
+		close(f.stop)
+	}
+	return nil
+}
+
+func (f *FileStore) gcLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = f.GC()
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// path 会话 ID 来自客户端，只允许 base64url 的字符，防止路径穿越
+func (f *FileStore) path(id string) (string, bool) {
+	if id == "" || len(id) > 128 {
+		return "", false
+	}
+	for i := 0; i < len(id); i++ {
+		b := id[i]
+		if !(b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '-' || b == '_') {
+			return "", false
+		}
+	}
+	return filepath.Join(f.dir, filePrefix+id), true
+}
+
+func expiryOf(content []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(content)))
+}
@@ -0,0 +1,247 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultIdleTimeout     = 30 * time.Minute
+	defaultAbsoluteTimeout = 12 * time.Hour
+)
+
+// Manager 负责从请求里面读取会话、把会话写回 Store 和 cookie
+type Manager struct {
+	store  Store
+	cookie http.Cookie
+	// idleTimeout 多久没有请求就过期，absoluteTimeout 从创建开始多久之后无论如何都过期
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+	now             func() time.Time
+
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type Option func(m *Manager)
+
+// WithCookie cookie 的模板，Value、Expires、MaxAge 会被忽略
+func WithCookie(cookie http.Cookie) Option {
+	return func(m *Manager) {
+		m.cookie = cookie
+	}
+}
+
+// WithIdleTimeout 空闲过期时间，默认 30 分钟，0 表示只使用绝对过期时间
+func WithIdleTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		m.idleTimeout = d
+	}
+}
+
+// WithAbsoluteTimeout 绝对过期时间，默认 12 小时，0 表示只使用空闲过期时间
+func WithAbsoluteTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		m.absoluteTimeout = d
+	}
+}
+
+func NewManager(store Store, opts ...Option) *Manager {
+	m := &Manager{
+		store: store,
+		cookie: http.Cookie{
+			Name:     "session_id",
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		idleTimeout:     defaultIdleTimeout,
+		absoluteTimeout: defaultAbsoluteTimeout,
+		now:             time.Now,
+		locks:           make(map[string]*keyLock),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.idleTimeout <= 0 && m.absoluteTimeout <= 0 {
+		panic("session: 空闲过期时间和绝对过期时间不能都为 0")
+	}
+	return m
+}
+
+// Start 读取请求里面的会话，没有或者已经过期的时候创建一个新的会话。
+// 同一个会话的请求会被串行化，直到调用返回的 release，这样并发请求不会互相覆盖数据
+func (m *Manager) Start(r *http.Request) (*Session, func()) {
+	var token string
+	if cookie, err := r.Cookie(m.cookie.Name); err == nil {
+		token = cookie.Value
+	}
+	release := func() {}
+	if token != "" {
+		release = m.lock(token)
+	}
+	return m.load(r.Context(), token), release
+}
+
+func (m *Manager) load(ctx context.Context, token string) *Session {
+	if token == "" {
+		return m.newSession()
+	}
+	data, err := m.store.Load(ctx, token)
+	if err != nil {
+		return m.newSession()
+	}
+	var rec record
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(&rec); err != nil || rec.ID == "" {
+		return m.newSession()
+	}
+	if m.absoluteTimeout > 0 && !m.now().Before(rec.CreatedAt.Add(m.absoluteTimeout)) {
+		_ = m.store.Delete(ctx, rec.ID)
+		return m.newSession()
+	}
+	if rec.Values == nil {
+		rec.Values = map[string]any{}
+	}
+	return &Session{
+		id:        rec.ID,
+		token:     token,
+		values:    rec.Values,
+		flashes:   rec.Flashes,
+		createdAt: rec.CreatedAt,
+	}
+}
+
+func (m *Manager) newSession() *Session {
+	return &Session{
+		id:        newID(),
+		values:    map[string]any{},
+		createdAt: m.now(),
+		isNew:     true,
+	}
+}
+
+// Save 保存会话并设置 cookie，必须在响应头发送之前调用。
+// 新会话没有写入任何数据的时候不会保存，也不会设置 cookie
+func (m *Manager) Save(ctx context.Context, w http.ResponseWriter, s *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.destroyed {
+		if s.oldID != "" {
+			_ = m.store.Delete(ctx, s.oldID)
+		}
+		if !s.isNew {
+			if err := m.store.Delete(ctx, s.id); err != nil {
+				return err
+			}
+		}
+		if s.token != "" {
+			m.setCookie(w, "", -1)
+		}
+		return nil
+	}
+	if s.isNew && !s.modified {
+		return nil
+	}
+	if s.oldID != "" {
+		if err := m.store.Delete(ctx, s.oldID); err != nil {
+			return err
+		}
+		s.oldID = ""
+	}
+
+	now := m.now()
+	if s.createdAt.IsZero() {
+		s.createdAt = now
+	}
+	var expiry time.Time
+	if m.idleTimeout > 0 {
+		expiry = now.Add(m.idleTimeout)
+	}
+	if m.absoluteTimeout > 0 {
+		if abs := s.createdAt.Add(m.absoluteTimeout); expiry.IsZero() || abs.Before(expiry) {
+			expiry = abs
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(record{
+		ID:        s.id,
+		Values:    s.values,
+		Flashes:   s.flashes,
+		CreatedAt: s.createdAt,
+	})
+	if err != nil {
+		return err
+	}
+	token, err := m.store.Save(ctx, s.id, buf.Bytes(), expiry)
+	if err != nil {
+		return err
+	}
+	s.token = token
+	// 每次都重新设置 cookie，让浏览器里面的过期时间和空闲过期时间保持一致
+	m.setCookie(w, token, int(expiry.Sub(now)/time.Second))
+	return nil
+}
+
+func (m *Manager) setCookie(w http.ResponseWriter, value string, maxAge int) {
+	cookie := m.cookie
+	cookie.Value = value
+	cookie.Expires = time.Time{}
+	cookie.MaxAge = maxAge
+	if maxAge == 0 {
+		// MaxAge 为 0 表示没有设置，不足一秒的按照已经过期处理
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, &cookie)
+}
+
+// keyLock 同一个会话的锁，refs 为 0 的时候从 map 里面删除
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func (m *Manager) lock(key string) func() {
+	m.mu.Lock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		m.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// record 保存到 Store 里面的数据
+type record struct {
+	ID        string
+	Values    map[string]any
+	Flashes   []any
+	CreatedAt time.Time
+}
+
+func newID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
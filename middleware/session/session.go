@@ -0,0 +1,117 @@
+// Package session 会话管理，会话数据保存在可替换的 Store 里面，
+// 内置了内存、签名 cookie 和文件系统三种实现
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// Session 一个会话，并发安全。值使用 gob 编码，自定义类型需要先调用 gob.Register
+type Session struct {
+	mu sync.Mutex
+
+	id        string
+	token     string
+	values    map[string]any
+	flashes   []any
+	createdAt time.Time
+
+	isNew     bool
+	modified  bool
+	destroyed bool
+	// oldID Regenerate 之前的 ID，保存的时候需要删除
+	oldID string
+}
+
+// ID 会话 ID
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// IsNew 本次请求新创建的会话
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isNew
+}
+
+// CreatedAt 会话创建的时间，绝对过期时间从这里开始计算
+func (s *Session) CreatedAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createdAt
+}
+
+func (s *Session) Get(key string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	val, ok := s.values[key]
+	return val, ok
+}
+
+// GetString 值不存在或者不是 string 的时候返回空字符串
+func (s *Session) GetString(key string) string {
+	val, _ := s.Get(key)
+	str, _ := val.(string)
+	return str
+}
+
+func (s *Session) Set(key string, val any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = val
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.modified = true
+	}
+}
+
+// AddFlash 添加一条闪现消息，读取一次之后就会被删除，一般用在重定向之后展示提示
+func (s *Session) AddFlash(val any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flashes = append(s.flashes, val)
+	s.modified = true
+}
+
+// Flashes 取出所有的闪现消息并清空
+func (s *Session) Flashes() []any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.flashes
+	if len(res) > 0 {
+		s.flashes = nil
+		s.modified = true
+	}
+	return res
+}
+
+// Regenerate 更换会话 ID，数据保留。登录、提升权限之后必须调用，防止会话固定攻击
+func (s *Session) Regenerate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.oldID == "" && !s.isNew {
+		s.oldID = s.id
+	}
+	s.id = newID()
+	s.createdAt = time.Time{}
+	s.modified = true
+}
+
+// Destroy 销毁会话，退出登录的时候调用
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = map[string]any{}
+	s.flashes = nil
+	s.destroyed = true
+}
@@ -0,0 +1,251 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock 测试过期用的时钟
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Add(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// roundTrip 模拟一次请求，返回响应里面的会话 cookie
+func roundTrip(t *testing.T, m *Manager, cookie *http.Cookie, fn func(s *Session)) *http.Cookie {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	s, release := m.Start(req)
+	defer release()
+	fn(s)
+	recorder := httptest.NewRecorder()
+	require.NoError(t, m.Save(context.Background(), recorder, s))
+	for _, c := range recorder.Result().Cookies() {
+		if c.Name == m.cookie.Name {
+			return c
+		}
+	}
+	return nil
+}
+
+func newTestManager(store Store, clock *fakeClock, opts ...Option) *Manager {
+	m := NewManager(store, opts...)
+	m.now = clock.Now
+	return m
+}
+
+func TestManager(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	store := NewMemoryStore(0)
+	store.now = clock.Now
+	m := newTestManager(store, clock, WithIdleTimeout(10*time.Minute), WithAbsoluteTimeout(time.Hour))
+
+	// 新会话没有写数据的时候不保存
+	cookie := roundTrip(t, m, nil, func(s *Session) {
+		assert.True(t, s.IsNew())
+	})
+	assert.Nil(t, cookie)
+	assert.Equal(t, 0, store.Len())
+
+	cookie = roundTrip(t, m, nil, func(s *Session) {
+		s.Set("uid", "123")
+		s.AddFlash("欢迎")
+	})
+	require.NotNil(t, cookie)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, 600, cookie.MaxAge)
+	firstID := cookie.Value
+
+	// 闪现消息只能读取一次
+	cookie = roundTrip(t, m, cookie, func(s *Session) {
+		assert.False(t, s.IsNew())
+		assert.Equal(t, "123", s.GetString("uid"))
+		assert.Equal(t, []any{"欢迎"}, s.Flashes())
+	})
+	roundTrip(t, m, cookie, func(s *Session) {
+		assert.Empty(t, s.Flashes())
+	})
+
+	// 登录之后更换 ID，旧 ID 失效，数据保留
+	cookie = roundTrip(t, m, cookie, func(s *Session) {
+		s.Regenerate()
+	})
+	assert.NotEqual(t, firstID, cookie.Value)
+	_, err := store.Load(context.Background(), firstID)
+	assert.Equal(t, ErrNotFound, err)
+	roundTrip(t, m, cookie, func(s *Session) {
+		assert.Equal(t, "123", s.GetString("uid"))
+	})
+
+	// 空闲过期
+	clock.Add(11 * time.Minute)
+	roundTrip(t, m, cookie, func(s *Session) {
+		assert.True(t, s.IsNew())
+	})
+
+	// 绝对过期：一直有请求也会过期
+	cookie = roundTrip(t, m, nil, func(s *Session) {
+		s.Set("uid", "456")
+	})
+	for i := 0; i < 6; i++ {
+		clock.Add(9 * time.Minute)
+		cookie = roundTrip(t, m, cookie, func(s *Session) {
+			assert.Equal(t, "456", s.GetString("uid"))
+		})
+	}
+	// 离绝对过期只剩 6 分钟，cookie 的有效期也跟着缩短
+	assert.Equal(t, 360, cookie.MaxAge)
+	clock.Add(7 * time.Minute)
+	roundTrip(t, m, cookie, func(s *Session) {
+		assert.True(t, s.IsNew())
+	})
+
+	// 销毁会话
+	cookie = roundTrip(t, m, nil, func(s *Session) {
+		s.Set("uid", "789")
+	})
+	id := cookie.Value
+	cookie = roundTrip(t, m, cookie, func(s *Session) {
+		s.Destroy()
+	})
+	assert.Equal(t, -1, cookie.MaxAge)
+	_, err = store.Load(context.Background(), id)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestManager_ConcurrentRequests(t *testing.T) {
+	m := NewManager(NewMemoryStore(0))
+	cookie := roundTrip(t, m, nil, func(s *Session) {
+		s.Set("count", 0)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			roundTrip(t, m, cookie, func(s *Session) {
+				val, _ := s.Get("count")
+				s.Set("count", val.(int)+1)
+			})
+		}()
+	}
+	wg.Wait()
+	roundTrip(t, m, cookie, func(s *Session) {
+		val, _ := s.Get("count")
+		assert.Equal(t, 20, val)
+	})
+	assert.Empty(t, m.locks)
+}
+
+func TestMemoryStore_GC(t *testing.T) {
+	store := NewMemoryStore(time.Millisecond)
+	defer store.Close()
+	_, err := store.Save(context.Background(), "a", []byte("a"), time.Now().Add(time.Millisecond))
+	require.NoError(t, err)
+	_, err = store.Save(context.Background(), "b", []byte("b"), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return store.Len() == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	token, err := store.Save(ctx, "abc_-1", []byte("data"), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "abc_-1", token)
+	data, err := store.Load(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), data)
+
+	// 防止路径穿越
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret"), []byte("12345678secret"), 0o600))
+	_, err = store.Load(ctx, "../"+filepath.Base(dir)+"/secret")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = store.Save(ctx, "../x", nil, time.Now().Add(time.Hour))
+	assert.Error(t, err)
+
+	_, err = store.Save(ctx, "expired", []byte("data"), time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	_, err = store.Load(ctx, "expired")
+	assert.Equal(t, ErrNotFound, err)
+	require.NoError(t, store.GC())
+	_, err = os.Stat(filepath.Join(dir, filePrefix+"expired"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "secret"))
+	assert.NoError(t, err)
+
+	require.NoError(t, store.Delete(ctx, token))
+	require.NoError(t, store.Delete(ctx, token))
+	_, err = store.Load(ctx, token)
+	assert.Equal(t, ErrNotFound, err)
+	require.NoError(t, store.Close())
+}
+
+func TestCookieStore(t *testing.T) {
+	oldKey := bytes.Repeat([]byte("o"), 32)
+	newKey := bytes.Repeat([]byte("n"), 32)
+	ctx := context.Background()
+
+	old := NewCookieStore(oldKey)
+	token, err := old.Save(ctx, "id", []byte("data"), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	data, err := old.Load(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), data)
+
+	// 轮换密钥
+	_, err = NewCookieStore(newKey, oldKey).Load(ctx, token)
+	assert.NoError(t, err)
+	_, err = NewCookieStore(newKey).Load(ctx, token)
+	assert.Equal(t, ErrNotFound, err)
+
+	_, err = old.Load(ctx, "A"+token)
+	assert.Equal(t, ErrNotFound, err)
+
+	expired, err := old.Save(ctx, "id", []byte("data"), time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	_, err = old.Load(ctx, expired)
+	assert.Equal(t, ErrNotFound, err)
+
+	_, err = old.Save(ctx, "id", make([]byte, 4096), time.Now().Add(time.Hour))
+	assert.Equal(t, ErrTooLarge, err)
+
+	// 通过 Manager 使用
+	m := NewManager(old)
+	cookie := roundTrip(t, m, nil, func(s *Session) {
+		s.Set("uid", "123")
+	})
+	roundTrip(t, m, cookie, func(s *Session) {
+		assert.Equal(t, "123", s.GetString("uid"))
+	})
+}
@@ -0,0 +1,114 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("session: 会话不存在或者已经过期")
+
+// Store 保存会话数据
+//
+// token 是写在 cookie 里面的值。服务端保存数据的实现里面 token 就是会话 ID；
+// 签名 cookie 这种把数据放在客户端的实现里面 token 是编码之后的数据
+type Store interface {
+	// Load 找不到、过期或者 token 非法的时候返回 ErrNotFound
+	Load(ctx context.Context, token string) ([]byte, error)
+	// Save 保存数据直到 expiry，返回新的 token
+	Save(ctx context.Context, id string, data []byte, expiry time.Time) (string, error)
+	// Delete 删除会话，会话不存在的时候不返回错误
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryStore 内存实现，后台定期清理过期的会话，只适合单实例部署
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]memoryEntry
+	now      func() time.Time
+	stop     chan struct{}
+	once     sync.Once
+}
+
+type memoryEntry struct {
+	data   []byte
+	expiry time.Time
+}
+
+// NewMemoryStore gcInterval 是清理过期会话的间隔，小于等于 0 的时候不清理，只在读取的时候检查过期
+func NewMemoryStore(gcInterval time.Duration) *MemoryStore {
+	m := &MemoryStore{
+		sessions: make(map[string]memoryEntry),
+		now:      time.Now,
+		stop:     make(chan struct{}),
+	}
+	if gcInterval > 0 {
+		go m.gcLoop(gcInterval)
+	}
+	return m
+}
+
+func (m *MemoryStore) Load(ctx context.Context, token string) ([]byte, error) {
+	m.mu.RLock()
+	entry, ok := m.sessions[token]
+	m.mu.RUnlock()
+	if !ok || !m.now().Before(entry.expiry) {
+		return nil, ErrNotFound
+	}
+	return entry.data, nil
+}
+
+func (m *MemoryStore) Save(ctx context.Context, id string, data []byte, expiry time.Time) (string, error) {
+	m.mu.Lock()
+	m.sessions[id] = memoryEntry{data: data, expiry: expiry}
+	m.mu.Unlock()
+	return id, nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	delete(m.sessions, id)
+	m.mu.Unlock()
+	return nil
+}
+
+// GC 删除过期的会话
+func (m *MemoryStore) GC() {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, entry := range m.sessions {
+		if !now.Before(entry.expiry) {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// Len 会话的数量，包括还没有被清理的过期会话
+func (m *MemoryStore) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.sessions)
+}
+
+// Close 停止后台清理
+func (m *MemoryStore) Close() error {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+	return nil
+}
+
+func (m *MemoryStore) gcLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.GC()
+		case <-m.stop:
+			return
+		}
+	}
+}
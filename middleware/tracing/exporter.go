@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// WriterExporter 把 span 按照一行一个 JSON 写到 io.Writer，
+// 用于开发环境输出到 stdout 或者写到文件里面再由其它程序收集
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// closer 文件导出器在 Shutdown 的时候需要关闭文件
+	closer io.Closer
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// NewStdoutExporter 输出到标准输出
+func NewStdoutExporter() *WriterExporter {
+	return NewWriterExporter(os.Stdout)
+}
+
+// NewFileExporter 追加写到 path，文件不存在的时候创建
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterExporter{w: f, closer: f}, nil
+}
+
+type spanJSON struct {
+	Service      string         `json:"service"`
+	Name         string         `json:"name"`
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Kind         string         `json:"kind"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	DurationMs   float64        `json:"duration_ms"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Events       []eventJSON    `json:"events,omitempty"`
+	Status       string         `json:"status"`
+	StatusMsg    string         `json:"status_message,omitempty"`
+}
+
+type eventJSON struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+func (e *WriterExporter) ExportSpans(ctx context.Context, spans []*SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		sj := spanJSON{
+			Service:    s.Service,
+			Name:       s.Name,
+			TraceID:    s.SpanContext.TraceID.String(),
+			SpanID:     s.SpanContext.SpanID.String(),
+			Kind:       s.Kind.String(),
+			Start:      s.StartTime,
+			End:        s.EndTime,
+			DurationMs: float64(s.EndTime.Sub(s.StartTime)) / float64(time.Millisecond),
+			Attributes: attrMap(s.Attributes),
+			Status:     statusString(s.Status.Code),
+			StatusMsg:  s.Status.Message,
+		}
+		if s.ParentSpanID.IsValid() {
+			sj.ParentSpanID = s.ParentSpanID.String()
+		}
+		for _, ev := range s.Events {
+			sj.Events = append(sj.Events, eventJSON{Name: ev.Name, Time: ev.Time, Attributes: attrMap(ev.Attributes)})
+		}
+		if err := enc.Encode(sj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	if e.closer == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.closer.Close()
+}
+
+func attrMap(attrs []Attribute) map[string]any {
+	if len(attrs) == 0 {
+		return nil
+	}
+	res := make(map[string]any, len(attrs))
+	for _, a := range attrs {
+		switch a.Value.(type) {
+		case string, bool, int, int64, int32, uint, uint32, uint64, float64, float32:
+			res[a.Key] = a.Value
+		default:
+			res[a.Key] = fmt.Sprint(a.Value)
+		}
+	}
+	return res
+}
+
+func statusString(code StatusCode) string {
+	switch code {
+	case StatusOK:
+		return "ok"
+	case StatusError:
+		return "error"
+	default:
+		return "unset"
+	}
+}
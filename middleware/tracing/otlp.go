@@ -0,0 +1,238 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const scopeName = "github.com/gofaquan/go-http"
+
+// OTLPExporter 使用 OTLP/HTTP 的 JSON 编码把 span 发送给收集器，
+// endpoint 是完整的地址，例如 http://localhost:4318/v1/traces
+type OTLPExporter struct {
+	endpoint string
+	client   *http.Client
+	headers  map[string]string
+}
+
+type OTLPOption func(e *OTLPExporter)
+
+// WithOTLPHeaders 额外的请求头，例如认证信息
+func WithOTLPHeaders(headers map[string]string) OTLPOption {
+	return func(e *OTLPExporter) {
+		for k, v := range headers {
+			e.headers[k] = v
+		}
+	}
+}
+
+// WithOTLPClient 默认使用超时 10 秒的 http.Client
+func WithOTLPClient(client *http.Client) OTLPOption {
+	return func(e *OTLPExporter) {
+		e.client = client
+	}
+}
+
+func NewOTLPExporter(endpoint string, opts ...OTLPOption) *OTLPExporter {
+	e := &OTLPExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		headers:  map[string]string{},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []*SpanData) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(toOTLP(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("tracing: 收集器返回 %s %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// 下面是 OTLP JSON 编码需要的结构，traceId 和 spanId 使用十六进制，64 位整数使用字符串
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	TraceState        string         `json:"traceState,omitempty"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// toOTLP 按照服务名分组
+func toOTLP(spans []*SpanData) *otlpRequest {
+	req := &otlpRequest{}
+	index := map[string]int{}
+	for _, s := range spans {
+		i, ok := index[s.Service]
+		if !ok {
+			i = len(req.ResourceSpans)
+			index[s.Service] = i
+			req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+				Resource: otlpResource{Attributes: otlpAttributes([]Attribute{Attr("service.name", s.Service)})},
+				ScopeSpans: []otlpScopeSpans{{
+					Scope: otlpScope{Name: scopeName},
+				}},
+			})
+		}
+		span := otlpSpan{
+			TraceID:           s.SpanContext.TraceID.String(),
+			SpanID:            s.SpanContext.SpanID.String(),
+			TraceState:        s.SpanContext.TraceState,
+			Name:              s.Name,
+			Kind:              otlpKind(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: int(s.Status.Code), Message: s.Status.Message},
+		}
+		if s.ParentSpanID.IsValid() {
+			span.ParentSpanID = s.ParentSpanID.String()
+		}
+		for _, ev := range s.Events {
+			span.Events = append(span.Events, otlpEvent{
+				TimeUnixNano: strconv.FormatInt(ev.Time.UnixNano(), 10),
+				Name:         ev.Name,
+				Attributes:   otlpAttributes(ev.Attributes),
+			})
+		}
+		scope := &req.ResourceSpans[i].ScopeSpans[0]
+		scope.Spans = append(scope.Spans, span)
+	}
+	return req
+}
+
+// otlpKind OTLP 里面 0 是未指定，1 internal，2 server，3 client
+func otlpKind(kind SpanKind) int {
+	switch kind {
+	case SpanKindServer:
+		return 2
+	case SpanKindClient:
+		return 3
+	default:
+		return 1
+	}
+}
+
+func otlpAttributes(attrs []Attribute) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	res := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpValue
+		switch val := a.Value.(type) {
+		case string:
+			v.StringValue = &val
+		case bool:
+			v.BoolValue = &val
+		case int:
+			s := strconv.FormatInt(int64(val), 10)
+			v.IntValue = &s
+		case int32:
+			s := strconv.FormatInt(int64(val), 10)
+			v.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(val, 10)
+			v.IntValue = &s
+		case uint32:
+			s := strconv.FormatUint(uint64(val), 10)
+			v.IntValue = &s
+		case float32:
+			f := float64(val)
+			v.DoubleValue = &f
+		case float64:
+			v.DoubleValue = &val
+		default:
+			s := fmt.Sprint(val)
+			v.StringValue = &s
+		}
+		res = append(res, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return res
+}
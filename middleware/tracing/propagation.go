@@ -0,0 +1,211 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderTraceparent = "Traceparent"
+	HeaderTracestate  = "Tracestate"
+
+	maxTraceStateMembers = 32
+)
+
+var ErrInvalidTraceparent = errors.New("tracing: 非法的 traceparent")
+
+// ParseTraceparent 解析 W3C traceparent，例如 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+// 高于 00 的版本只要前面四个字段合法就接受，方便以后的版本升级
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	s = strings.TrimSpace(s)
+	if len(s) < 55 || !isLowerHex(s[:2]) || s[:2] == "ff" {
+		return sc, ErrInvalidTraceparent
+	}
+	if s[:2] == "00" && len(s) != 55 {
+		return sc, ErrInvalidTraceparent
+	}
+	if len(s) > 55 && s[55] != '-' {
+		return sc, ErrInvalidTraceparent
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, ErrInvalidTraceparent
+	}
+	traceID, spanID, flags := s[3:35], s[36:52], s[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return sc, ErrInvalidTraceparent
+	}
+	_, _ = hex.Decode(sc.TraceID[:], []byte(traceID))
+	_, _ = hex.Decode(sc.SpanID[:], []byte(spanID))
+	var f [1]byte
+	_, _ = hex.Decode(f[:], []byte(flags))
+	sc.Flags = f[0]
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	sc.Remote = true
+	return sc, nil
+}
+
+// Traceparent 按照版本 00 生成 traceparent
+func Traceparent(sc SpanContext) string {
+	var b [55]byte
+	copy(b[:], "00-")
+	hex.Encode(b[3:35], sc.TraceID[:])
+	b[35] = '-'
+	hex.Encode(b[36:52], sc.SpanID[:])
+	b[52] = '-'
+	hex.Encode(b[53:55], []byte{sc.Flags & FlagsSampled})
+	return string(b[:])
+}
+
+// ParseTraceState 校验 tracestate，非法的时候整个丢弃，返回空字符串。
+// 多个头部会按照顺序合并，空的成员会被去掉
+func ParseTraceState(values []string) string {
+	members := make([]string, 0, 4)
+	seen := make(map[string]struct{}, 4)
+	for _, line := range values {
+		for _, member := range strings.Split(line, ",") {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+			key, val, ok := strings.Cut(member, "=")
+			if !ok || !validTraceStateKey(key) || !validTraceStateValue(val) {
+				return ""
+			}
+			if _, dup := seen[key]; dup {
+				return ""
+			}
+			seen[key] = struct{}{}
+			members = append(members, member)
+		}
+	}
+	if len(members) > maxTraceStateMembers {
+		return ""
+	}
+	return strings.Join(members, ",")
+}
+
+// Extract 从请求头里面解析上游的 SpanContext，没有或者非法的时候原样返回 ctx
+func Extract(ctx context.Context, header http.Header) context.Context {
+	values := header.Values(HeaderTraceparent)
+	// 多个 traceparent 的时候无法判断哪个是对的
+	if len(values) != 1 {
+		return ctx
+	}
+	sc, err := ParseTraceparent(values[0])
+	if err != nil {
+		return ctx
+	}
+	sc.TraceState = ParseTraceState(header.Values(HeaderTracestate))
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Inject 把 ctx 里面的 span 写到请求头里面，传递给下游服务
+func Inject(ctx context.Context, header http.Header) {
+	sc := parentSpanContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	header.Set(HeaderTraceparent, Traceparent(sc))
+	if sc.TraceState != "" {
+		header.Set(HeaderTracestate, sc.TraceState)
+	} else {
+		header.Del(HeaderTracestate)
+	}
+}
+
+// Transport 为每个请求创建一个 client span 并且把它传递给下游服务
+type Transport struct {
+	Tracer Tracer
+	// Base 为 nil 的时候使用 http.DefaultTransport
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, span := t.Tracer.Start(req.Context(), "HTTP "+req.Method,
+		WithSpanKind(SpanKindClient),
+		WithAttributes(
+			Attr("http.request.method", req.Method),
+			Attr("url.full", req.URL.Redacted()),
+			Attr("server.address", req.URL.Hostname()),
+		))
+	defer span.End()
+	// RoundTripper 不能修改传进来的请求
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(StatusError, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(Attr("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(StatusError, resp.Status)
+	}
+	return resp, nil
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// validTraceStateKey key 是小写字母开头的 simple-key，或者 tenant@system 形式的 multi-tenant-key
+func validTraceStateKey(key string) bool {
+	tenant, system, multi := strings.Cut(key, "@")
+	if !multi {
+		return len(key) <= 256 && len(key) > 0 && isLowerAlpha(key[0]) && validKeyChars(key)
+	}
+	if len(tenant) == 0 || len(tenant) > 241 || len(system) == 0 || len(system) > 14 {
+		return false
+	}
+	return (isLowerAlpha(tenant[0]) || isDigit(tenant[0])) && validKeyChars(tenant) &&
+		isLowerAlpha(system[0]) && validKeyChars(system)
+}
+
+func validKeyChars(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isLowerAlpha(c) && !isDigit(c) && c != '_' && c != '-' && c != '*' && c != '/' {
+			return false
+		}
+	}
+	return true
+}
+
+// validTraceStateValue 可打印的 ASCII，不包括逗号和等号，最后一个字符不能是空格
+func validTraceStateValue(val string) bool {
+	if len(val) == 0 || len(val) > 256 || val[len(val)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(val); i++ {
+		c := val[i]
+		if c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+func isLowerAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,201 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// TraceID 16 字节的链路 ID，全 0 是非法的
+type TraceID [16]byte
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID 8 字节的 span ID，全 0 是非法的
+type SpanID [8]byte
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+const FlagsSampled byte = 0x01
+
+// SpanContext 需要在进程之间传递的部分，对应 traceparent 和 tracestate
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	// Remote 从请求头里面解析出来的
+	Remote bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagsSampled != 0
+}
+
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindServer
+	SpanKindClient
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	default:
+		return "internal"
+	}
+}
+
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+// Attribute span 的属性，Value 支持 string、bool、整数和浮点数，其它类型导出的时候会转成字符串
+type Attribute struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+func Attr(key string, val any) Attribute {
+	return Attribute{Key: key, Value: val}
+}
+
+// Tracer 创建 span，ctx 里面有 span 的时候新的 span 是它的子 span
+type Tracer interface {
+	Start(ctx context.Context, name string, opts ...SpanStartOption) (context.Context, Span)
+}
+
+// Span 一次操作，End 之后再调用其它方法都不会生效
+type Span interface {
+	SpanContext() SpanContext
+	// IsRecording 没有被采样的 span 不会记录任何数据，可以用来跳过昂贵的属性计算
+	IsRecording() bool
+	SetName(name string)
+	SetAttributes(attrs ...Attribute)
+	AddEvent(name string, attrs ...Attribute)
+	SetStatus(code StatusCode, msg string)
+	// RecordError 记录一个 exception 事件，不会修改状态
+	RecordError(err error)
+	End()
+}
+
+type spanStartConfig struct {
+	kind  SpanKind
+	attrs []Attribute
+	start time.Time
+}
+
+type SpanStartOption func(cfg *spanStartConfig)
+
+func WithSpanKind(kind SpanKind) SpanStartOption {
+	return func(cfg *spanStartConfig) {
+		cfg.kind = kind
+	}
+}
+
+func WithAttributes(attrs ...Attribute) SpanStartOption {
+	return func(cfg *spanStartConfig) {
+		cfg.attrs = append(cfg.attrs, attrs...)
+	}
+}
+
+// WithStartTime 指定开始时间，默认是调用 Start 的时间
+func WithStartTime(t time.Time) SpanStartOption {
+	return func(cfg *spanStartConfig) {
+		cfg.start = t
+	}
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan 把 span 放进 ctx，之后在 ctx 上创建的 span 都是它的子 span
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext ctx 里面没有 span 的时候返回一个什么也不做的 span
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{sc: RemoteSpanContext(ctx)}
+}
+
+// ContextWithRemoteSpanContext 保存从上游解析出来的 SpanContext，作为本进程第一个 span 的父 span
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+func RemoteSpanContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// parentSpanContext 优先使用本进程的 span，其次是上游传过来的
+func parentSpanContext(ctx context.Context) SpanContext {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span.SpanContext()
+	}
+	return RemoteSpanContext(ctx)
+}
+
+// noopSpan 没有采样或者没有 Tracer 的时候使用，仍然携带 SpanContext 以便继续往下游传递
+type noopSpan struct {
+	sc SpanContext
+}
+
+func (n noopSpan) SpanContext() SpanContext      { return n.sc }
+func (n noopSpan) IsRecording() bool             { return false }
+func (n noopSpan) SetName(string)                {}
+func (n noopSpan) SetAttributes(...Attribute)    {}
+func (n noopSpan) AddEvent(string, ...Attribute) {}
+func (n noopSpan) SetStatus(StatusCode, string)  {}
+func (n noopSpan) RecordError(error)             {}
+func (n noopSpan) End()                          {}
+
+func newTraceID() TraceID {
+	var id TraceID
+	mustRandom(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	mustRandom(id[:])
+	return id
+}
+
+func mustRandom(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("tracing: 生成随机数失败 %v", err))
+	}
+}
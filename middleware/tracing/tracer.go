@@ -0,0 +1,366 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrShutdown Tracer 已经关闭
+var ErrShutdown = errors.New("tracing: Tracer 已经关闭")
+
+const (
+	defaultBatchSize    = 512
+	defaultBatchTimeout = 5 * time.Second
+	defaultQueueSize    = 2048
+)
+
+// SpanData 结束之后交给 Exporter 的 span 数据
+type SpanData struct {
+	Service      string
+	Name         string
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	Kind         SpanKind
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   []Attribute
+	Events       []Event
+	Status       Status
+}
+
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes []Attribute
+}
+
+type Status struct {
+	Code    StatusCode
+	Message string
+}
+
+// Exporter 把 span 发送到日志、文件或者收集器，ExportSpans 不会被并发调用
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []*SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// SDKTracer Tracer 的默认实现，结束的 span 先放进队列，由后台 goroutine 批量导出。
+// 队列满了的时候会丢弃新的 span，不会阻塞请求
+type SDKTracer struct {
+	service      string
+	exporter     Exporter
+	sampleRatio  float64
+	batchSize    int
+	batchTimeout time.Duration
+
+	queue     chan *SpanData
+	flushReqs chan chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	dropped int64
+}
+
+type Option func(t *SDKTracer)
+
+// WithSampleRatio 没有父 span 的时候按照 traceID 采样的比例，默认 1。
+// 有父 span 的时候跟随父 span 的采样结果
+func WithSampleRatio(ratio float64) Option {
+	return func(t *SDKTracer) {
+		t.sampleRatio = ratio
+	}
+}
+
+// WithBatchSize 攒够多少个 span 导出一次，默认 512
+func WithBatchSize(size int) Option {
+	return func(t *SDKTracer) {
+		t.batchSize = size
+	}
+}
+
+// WithBatchTimeout 最多等待多久导出一次，默认 5 秒
+func WithBatchTimeout(d time.Duration) Option {
+	return func(t *SDKTracer) {
+		t.batchTimeout = d
+	}
+}
+
+// WithQueueSize 等待导出的 span 的最大数量，默认 2048
+func WithQueueSize(size int) Option {
+	return func(t *SDKTracer) {
+		t.queue = make(chan *SpanData, size)
+	}
+}
+
+// NewTracer service 是服务名，导出的时候作为 service.name
+func NewTracer(service string, exporter Exporter, opts ...Option) *SDKTracer {
+	t := &SDKTracer{
+		service:      service,
+		exporter:     exporter,
+		sampleRatio:  1,
+		batchSize:    defaultBatchSize,
+		batchTimeout: defaultBatchTimeout,
+		queue:        make(chan *SpanData, defaultQueueSize),
+		flushReqs:    make(chan chan struct{}),
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	go t.loop()
+	return t
+}
+
+func (t *SDKTracer) Start(ctx context.Context, name string, opts ...SpanStartOption) (context.Context, Span) {
+	cfg := &spanStartConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	parent := parentSpanContext(ctx)
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.TraceState = parent.TraceState
+		sc.Flags = parent.Flags
+	} else {
+		sc.TraceID = newTraceID()
+		if t.shouldSample(sc.TraceID) {
+			sc.Flags = FlagsSampled
+		}
+	}
+
+	if !sc.IsSampled() {
+		span := noopSpan{sc: sc}
+		return ContextWithSpan(ctx, span), span
+	}
+	start := cfg.start
+	if start.IsZero() {
+		start = time.Now()
+	}
+	span := &recordingSpan{
+		tracer: t,
+		data: &SpanData{
+			Service:      t.service,
+			Name:         name,
+			SpanContext:  sc,
+			ParentSpanID: parent.SpanID,
+			Kind:         cfg.kind,
+			StartTime:    start,
+			Attributes:   cfg.attrs,
+		},
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// shouldSample 使用 traceID 的后 8 个字节，同一条链路在不同的服务里面采样结果一样
+func (t *SDKTracer) shouldSample(id TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	if t.sampleRatio <= 0 {
+		return false
+	}
+	bound := uint64(t.sampleRatio * (1 << 63))
+	return binary.BigEndian.Uint64(id[8:])>>1 < bound
+}
+
+func (t *SDKTracer) enqueue(data *SpanData) {
+	select {
+	case <-t.done:
+		return
+	default:
+	}
+	select {
+	case t.queue <- data:
+	default:
+		t.mu.Lock()
+		t.dropped++
+		t.mu.Unlock()
+	}
+}
+
+// Dropped 因为队列满了被丢弃的 span 数量
+func (t *SDKTracer) Dropped() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+func (t *SDKTracer) loop() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(t.batchTimeout)
+	defer ticker.Stop()
+	batch := make([]*SpanData, 0, t.batchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := t.exporter.ExportSpans(ctx, batch); err != nil {
+			log.Printf("tracing: 导出 %d 个 span 失败 %v", len(batch), err)
+		}
+		cancel()
+		batch = make([]*SpanData, 0, t.batchSize)
+	}
+	drain := func() {
+		for {
+			select {
+			case data := <-t.queue:
+				batch = append(batch, data)
+				if len(batch) >= t.batchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case data := <-t.queue:
+			batch = append(batch, data)
+			if len(batch) >= t.batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case reply := <-t.flushReqs:
+			drain()
+			close(reply)
+		case <-t.done:
+			drain()
+			return
+		}
+	}
+}
+
+// ForceFlush 立刻导出已经结束的 span
+func (t *SDKTracer) ForceFlush(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case t.flushReqs <- reply:
+	case <-t.stopped:
+		return ErrShutdown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown 导出剩下的 span 并关闭 Exporter，之后结束的 span 会被丢弃
+func (t *SDKTracer) Shutdown(ctx context.Context) error {
+	first := false
+	t.closeOnce.Do(func() {
+		first = true
+		close(t.done)
+	})
+	if !first {
+		return ErrShutdown
+	}
+	select {
+	case <-t.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+// recordingSpan 被采样的 span，End 之后交给 SDKTracer 导出
+type recordingSpan struct {
+	tracer *SDKTracer
+	mu     sync.Mutex
+	data   *SpanData
+	ended  bool
+}
+
+func (s *recordingSpan) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *recordingSpan) IsRecording() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.ended
+}
+
+func (s *recordingSpan) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Name = name
+	}
+}
+
+// SetAttributes 同名的属性会被覆盖
+func (s *recordingSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+outer:
+	for _, attr := range attrs {
+		for i := range s.data.Attributes {
+			if s.data.Attributes[i].Key == attr.Key {
+				s.data.Attributes[i] = attr
+				continue outer
+			}
+		}
+		s.data.Attributes = append(s.data.Attributes, attr)
+	}
+}
+
+func (s *recordingSpan) AddEvent(name string, attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Events = append(s.data.Events, Event{Name: name, Time: time.Now(), Attributes: attrs})
+	}
+}
+
+// SetStatus Error 之后不能再改成 Unset，OK 之后不能再修改
+func (s *recordingSpan) SetStatus(code StatusCode, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended || s.data.Status.Code == StatusOK || code < s.data.Status.Code {
+		return
+	}
+	if code != StatusError {
+		msg = ""
+	}
+	s.data.Status = Status{Code: code, Message: msg}
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.AddEvent("exception", Attr("exception.message", err.Error()))
+}
+
+func (s *recordingSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	s.mu.Unlock()
+	s.tracer.enqueue(s.data)
+}
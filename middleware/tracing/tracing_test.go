@@ -0,0 +1,324 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryExporter 测试用，保存导出的 span
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+func (m *memoryExporter) ExportSpans(ctx context.Context, spans []*SpanData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = append(m.spans, spans...)
+	return nil
+}
+
+func (m *memoryExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (m *memoryExporter) Spans() []*SpanData {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*SpanData(nil), m.spans...)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	testCases := []struct {
+		name    string
+		val     string
+		wantErr error
+		wantSC  SpanContext
+	}{
+		{
+			name: "valid",
+			val:  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantSC: SpanContext{
+				TraceID: TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+				SpanID:  SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+				Flags:   FlagsSampled,
+				Remote:  true,
+			},
+		},
+		{
+			name: "future version with extra fields",
+			val:  "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-what-the-future-holds",
+			wantSC: SpanContext{
+				TraceID: TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+				SpanID:  SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+				Remote:  true,
+			},
+		},
+		{name: "version 00 with extra fields", val: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-x", wantErr: ErrInvalidTraceparent},
+		{name: "version ff", val: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: ErrInvalidTraceparent},
+		{name: "upper case", val: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: ErrInvalidTraceparent},
+		{name: "zero trace id", val: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: ErrInvalidTraceparent},
+		{name: "zero span id", val: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", wantErr: ErrInvalidTraceparent},
+		{name: "short", val: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", wantErr: ErrInvalidTraceparent},
+		{name: "bad separator", val: "00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: ErrInvalidTraceparent},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tc.val)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantSC, sc)
+		})
+	}
+
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Traceparent(sc))
+}
+
+func TestParseTraceState(t *testing.T) {
+	testCases := []struct {
+		name   string
+		values []string
+		want   string
+	}{
+		{name: "empty"},
+		{name: "single", values: []string{"congo=t61rcWkgMzE"}, want: "congo=t61rcWkgMzE"},
+		{name: "multi headers", values: []string{"rojo=00f067aa0ba902b7", " ,congo=t61rcWkgMzE"}, want: "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"},
+		{name: "multi tenant", values: []string{"tenant1@vendor=v"}, want: "tenant1@vendor=v"},
+		{name: "upper key", values: []string{"Rojo=1"}},
+		{name: "duplicate key", values: []string{"a=1,a=2"}},
+		{name: "bad value", values: []string{"a=b=c"}},
+		{name: "too many", values: []string{manyMembers(33)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ParseTraceState(tc.values))
+		})
+	}
+}
+
+func manyMembers(n int) string {
+	members := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		members = append(members, "k"+strings.Repeat("x", i)+"=v")
+	}
+	return strings.Join(members, ",")
+}
+
+func TestExtractInject(t *testing.T) {
+	header := http.Header{}
+	header.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set(HeaderTracestate, "congo=t61rcWkgMzE")
+	exporter := &memoryExporter{}
+	tracer := NewTracer("svc", exporter)
+	defer func() {
+		_ = tracer.Shutdown(context.Background())
+	}()
+
+	ctx := Extract(context.Background(), header)
+	ctx, span := tracer.Start(ctx, "server", WithSpanKind(SpanKindServer))
+	sc := span.SpanContext()
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.NotEqual(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.IsSampled())
+
+	out := http.Header{}
+	Inject(ctx, out)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+sc.SpanID.String()+"-01", out.Get(HeaderTraceparent))
+	assert.Equal(t, "congo=t61rcWkgMzE", out.Get(HeaderTracestate))
+	span.End()
+
+	require.NoError(t, tracer.ForceFlush(context.Background()))
+	spans := exporter.Spans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].ParentSpanID.String())
+
+	// 多个 traceparent 的时候忽略
+	header.Add(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b8-01")
+	assert.False(t, RemoteSpanContext(Extract(context.Background(), header)).IsValid())
+}
+
+func TestSDKTracer_Sampling(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := NewTracer("svc", exporter, WithSampleRatio(0))
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	assert.False(t, root.IsRecording())
+	assert.True(t, root.SpanContext().IsValid())
+	_, child := tracer.Start(ctx, "child")
+	assert.False(t, child.IsRecording())
+	assert.Equal(t, root.SpanContext().TraceID, child.SpanContext().TraceID)
+	child.End()
+	root.End()
+
+	// 上游已经采样的时候跟随上游
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	_, span := tracer.Start(ContextWithRemoteSpanContext(context.Background(), sc), "remote")
+	assert.True(t, span.IsRecording())
+	span.End()
+
+	require.NoError(t, tracer.Shutdown(context.Background()))
+	assert.Len(t, exporter.Spans(), 1)
+	assert.Equal(t, ErrShutdown, tracer.Shutdown(context.Background()))
+	assert.Equal(t, ErrShutdown, tracer.ForceFlush(context.Background()))
+}
+
+func TestRecordingSpan(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := NewTracer("svc", exporter, WithBatchSize(2), WithBatchTimeout(time.Hour))
+	ctx, parent := tracer.Start(context.Background(), "parent", WithAttributes(Attr("a", 1)))
+	_, span := tracer.Start(ctx, "child")
+	span.SetAttributes(Attr("k", "v1"), Attr("n", 2))
+	span.SetAttributes(Attr("k", "v2"))
+	span.RecordError(errors.New("oops"))
+	span.SetStatus(StatusError, "failed")
+	span.SetStatus(StatusUnset, "")
+	span.SetName("renamed")
+	span.End()
+	span.SetName("after end")
+	span.End()
+	parent.End()
+
+	// 攒够一批之后自动导出
+	require.Eventually(t, func() bool {
+		return len(exporter.Spans()) == 2
+	}, time.Second, time.Millisecond)
+	child := exporter.Spans()[0]
+	assert.Equal(t, "renamed", child.Name)
+	assert.Equal(t, []Attribute{Attr("k", "v2"), Attr("n", 2)}, child.Attributes)
+	assert.Equal(t, Status{Code: StatusError, Message: "failed"}, child.Status)
+	require.Len(t, child.Events, 1)
+	assert.Equal(t, "exception", child.Events[0].Name)
+	assert.Equal(t, parent.SpanContext().SpanID, child.ParentSpanID)
+	assert.False(t, exporter.Spans()[1].ParentSpanID.IsValid())
+	require.NoError(t, tracer.Shutdown(context.Background()))
+}
+
+func TestWriterExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exporter, err := NewFileExporter(path)
+	require.NoError(t, err)
+	tracer := NewTracer("svc", exporter)
+	_, span := tracer.Start(context.Background(), "op", WithAttributes(Attr("user", "tom"), Attr("ids", []int{1, 2})))
+	span.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(data), &got))
+	assert.Equal(t, "svc", got["service"])
+	assert.Equal(t, "op", got["name"])
+	assert.Equal(t, span.SpanContext().TraceID.String(), got["trace_id"])
+	assert.Equal(t, "internal", got["kind"])
+	assert.Equal(t, map[string]any{"user": "tom", "ids": "[1 2]"}, got["attributes"])
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []otlpRequest
+		auth     string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		auth = r.Header.Get("Authorization")
+		mu.Unlock()
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL+"/v1/traces", WithOTLPHeaders(map[string]string{"Authorization": "Bearer t"}))
+	tracer := NewTracer("order-service", exporter)
+	ctx, server := tracer.Start(context.Background(), "GET /order/:id", WithSpanKind(SpanKindServer),
+		WithAttributes(Attr("http.response.status_code", 200), Attr("ok", true), Attr("ratio", 0.5)))
+	_, client := tracer.Start(ctx, "HTTP GET", WithSpanKind(SpanKindClient))
+	client.SetStatus(StatusError, "timeout")
+	client.End()
+	server.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "Bearer t", auth)
+	require.Len(t, requests, 1)
+	require.Len(t, requests[0].ResourceSpans, 1)
+	rs := requests[0].ResourceSpans[0]
+	assert.Equal(t, "service.name", rs.Resource.Attributes[0].Key)
+	assert.Equal(t, "order-service", *rs.Resource.Attributes[0].Value.StringValue)
+	spans := rs.ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+	assert.Equal(t, 3, spans[0].Kind)
+	assert.Equal(t, server.SpanContext().SpanID.String(), spans[0].ParentSpanID)
+	assert.Equal(t, otlpStatus{Code: 2, Message: "timeout"}, spans[0].Status)
+	assert.Equal(t, 2, spans[1].Kind)
+	assert.Equal(t, "200", *spans[1].Attributes[0].Value.IntValue)
+	assert.True(t, *spans[1].Attributes[1].Value.BoolValue)
+	assert.Equal(t, 0.5, *spans[1].Attributes[2].Value.DoubleValue)
+	assert.Len(t, spans[1].TraceID, 32)
+	assert.Len(t, spans[1].SpanID, 16)
+
+	// 收集器返回错误
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	err := NewOTLPExporter(failing.URL).ExportSpans(context.Background(), []*SpanData{{Name: "x"}})
+	assert.ErrorContains(t, err, "503")
+}
+
+func TestTransport(t *testing.T) {
+	var got string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(HeaderTraceparent)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer downstream.Close()
+
+	exporter := &memoryExporter{}
+	tracer := NewTracer("svc", exporter)
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downstream.URL, nil)
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: &Transport{Tracer: tracer}}).Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	parent.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	assert.Empty(t, req.Header.Get(HeaderTraceparent))
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	client := spans[0]
+	assert.Equal(t, SpanKindClient, client.Kind)
+	assert.Equal(t, Traceparent(client.SpanContext), got)
+	assert.Equal(t, parent.SpanContext().SpanID, client.ParentSpanID)
+	assert.Equal(t, StatusError, client.Status.Code)
+}
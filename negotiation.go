@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// acceptRange Accept 头部里面的一项，例如 text/html;q=0.8
+type acceptRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+func (ar acceptRange) mediaType() string {
+	return ar.typ + "/" + ar.subtype
+}
+
+// match 判断媒体类型是否满足这一项，支持 */* 和 type/*
+func (ar acceptRange) match(mediaType string) bool {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	if ar.typ != "*" && ar.typ != typ {
+		return false
+	}
+	return ar.subtype == "*" || ar.subtype == subtype
+}
+
+// specificity */* 为 0，type/* 为 1，type/subtype 为 2。
+// match 不看参数，所以参数也不能让一项变得更具体，否则 application/json;charset=foo 会盖过 application/json;q=0
+func (ar acceptRange) specificity() int {
+	switch {
+	case ar.typ == "*":
+		return 0
+	case ar.subtype == "*":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// parseAccept 解析 Accept 头部，按照 q 值从高到低排序，q 值相同的时候越具体的越靠前
+// 非法的项会被忽略
+func parseAccept(header string) []acceptRange {
+	res := make([]acceptRange, 0, 4)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		segs := strings.Split(part, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(segs[0])), "/")
+		if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+			continue
+		}
+		ar := acceptRange{typ: typ, subtype: subtype, q: 1}
+		valid := true
+		for _, param := range segs[1:] {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+			if err != nil || q < 0 || q > 1 {
+				valid = false
+				break
+			}
+			ar.q = q
+		}
+		if valid {
+			res = append(res, ar)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].q != res[j].q {
+			return res[i].q > res[j].q
+		}
+		return res[i].specificity() > res[j].specificity()
+	})
+	return res
+}
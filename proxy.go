@@ -0,0 +1,260 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// ForwardedHeader 信任的代理通过哪一种请求头传递客户端的信息
+type ForwardedHeader int
+
+const (
+	// XForwardedFor 使用 X-Forwarded-For、X-Forwarded-Proto、X-Forwarded-Host 和 X-Real-IP，默认值
+	XForwardedFor ForwardedHeader = iota
+	// Forwarded 使用 RFC 7239 的 Forwarded
+	Forwarded
+)
+
+// WithForwardedHeader 设置代理使用的请求头，两种请求头只会读取其中一种。
+// 代理一般只会追加自己使用的那一种，另外一种原样透传，读取它等于信任客户端伪造的内容
+func WithForwardedHeader(header ForwardedHeader) ServerOption {
+	return func(server *HTTPServer) {
+		server.forwardedHeader = header
+	}
+}
+
+// WithTrustedProxies 信任的代理，支持 CIDR 和单个 IP，例如 10.0.0.0/8、127.0.0.1。
+// 只有直接连接的对端在这里面的时候，才会使用 WithForwardedHeader 指定的请求头
+func WithTrustedProxies(proxies ...string) ServerOption {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, p := range proxies {
+		prefix, err := parsePrefix(p)
+		if err != nil {
+			panic("web: 非法的代理地址 " + p)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return func(server *HTTPServer) {
+		server.trustedProxies = append(server.trustedProxies, prefixes...)
+	}
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func (c *Context) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range c.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteAddr 直接连接的对端地址
+func (c *Context) remoteAddr() (netip.Addr, bool) {
+	return parseIP(c.Request.RemoteAddr)
+}
+
+// fromTrustedProxy 请求是不是来自信任的代理
+func (c *Context) fromTrustedProxy() bool {
+	remote, ok := c.remoteAddr()
+	return ok && c.trusted(remote)
+}
+
+// ClientIP 客户端的真实 IP。
+// 请求来自信任的代理时，从右往左查找 Forwarded 或者 X-Forwarded-For 里面第一个不被信任的地址，
+// 遇到无法解析的地址时返回离我们最近的信任代理；使用 X-Forwarded-For 而它又不存在的时候使用 X-Real-IP。
+// 请求不是来自信任的代理时直接使用对端地址，客户端伪造的请求头会被忽略
+func (c *Context) ClientIP() string {
+	remote, ok := c.remoteAddr()
+	if !ok {
+		host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+		if err != nil {
+			return c.Request.RemoteAddr
+		}
+		return host
+	}
+	if !c.trusted(remote) {
+		return remote.String()
+	}
+
+	chain := c.forwardedFor()
+	nearest := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseIP(chain[i])
+		if !ok {
+			// unknown 或者混淆过的标识符，再往左的内容都不可信
+			return nearest.String()
+		}
+		if !c.trusted(addr) || i == 0 {
+			return addr.String()
+		}
+		nearest = addr
+	}
+	if c.forwardedHeader == XForwardedFor {
+		if addr, ok := parseIP(c.Request.Header.Get("X-Real-IP")); ok {
+			return addr.String()
+		}
+	}
+	return remote.String()
+}
+
+// forwardedFor 代理记录的客户端地址链，从左到右依次离我们越来越近
+func (c *Context) forwardedFor() []string {
+	if c.forwardedHeader == Forwarded {
+		elems := parseForwarded(c.Request.Header.Values("Forwarded"))
+		res := make([]string, 0, len(elems))
+		for _, elem := range elems {
+			res = append(res, elem["for"])
+		}
+		return res
+	}
+	var res []string
+	for _, line := range c.Request.Header.Values("X-Forwarded-For") {
+		for _, v := range strings.Split(line, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				res = append(res, v)
+			}
+		}
+	}
+	return res
+}
+
+// Scheme 请求的协议，http 或者 https。
+// 请求来自信任的代理时使用 Forwarded 的 proto 或者 X-Forwarded-Proto（见 WithForwardedHeader），取离我们最近的代理设置的值
+func (c *Context) Scheme() string {
+	if c.fromTrustedProxy() {
+		proto := c.forwardedValue("proto", "X-Forwarded-Proto")
+		if proto = strings.ToLower(proto); proto == "http" || proto == "https" {
+			return proto
+		}
+	}
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Host 请求的 Host，请求来自信任的代理时使用 Forwarded 的 host 或者 X-Forwarded-Host
+func (c *Context) Host() string {
+	if c.fromTrustedProxy() {
+		if host := c.forwardedValue("host", "X-Forwarded-Host"); validHost(host) {
+			return host
+		}
+	}
+	return c.Request.Host
+}
+
+// forwardedValue 取最右边的值，也就是离我们最近的信任代理设置的值
+func (c *Context) forwardedValue(param, header string) string {
+	if c.forwardedHeader == Forwarded {
+		elems := parseForwarded(c.Request.Header.Values("Forwarded"))
+		for i := len(elems) - 1; i >= 0; i-- {
+			if v, ok := elems[i][param]; ok {
+				return v
+			}
+		}
+		return ""
+	}
+	values := c.Request.Header.Values(header)
+	if len(values) == 0 {
+		return ""
+	}
+	last := values[len(values)-1]
+	if idx := strings.LastIndexByte(last, ','); idx >= 0 {
+		last = last[idx+1:]
+	}
+	return strings.TrimSpace(last)
+}
+
+// parseForwarded 解析 RFC 7239 的 Forwarded，每个元素是一个参数名（小写）到值的映射
+//
+//	Forwarded: for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"
+func parseForwarded(lines []string) []map[string]string {
+	var res []map[string]string
+	for _, line := range lines {
+		for _, elem := range splitQuoted(line, ',') {
+			pairs := make(map[string]string, 4)
+			for _, pair := range splitQuoted(elem, ';') {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				val = strings.TrimSpace(val)
+				if len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"' {
+					val = strings.ReplaceAll(val[1:len(val)-1], `\"`, `"`)
+				}
+				pairs[strings.ToLower(strings.TrimSpace(key))] = val
+			}
+			if len(pairs) > 0 {
+				res = append(res, pairs)
+			}
+		}
+	}
+	return res
+}
+
+// splitQuoted 按照 sep 切分，忽略引号里面的 sep
+func splitQuoted(s string, sep byte) []string {
+	var res []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				res = append(res, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(res, s[start:])
+}
+
+// parseIP 支持 1.2.3.4、1.2.3.4:80、[::1]:80、[::1] 和 ::1
+func parseIP(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return netip.Addr{}, false
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), true
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	} else {
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// validHost 防止代理透传过来的 Host 里面带着路径之类的东西
+func validHost(host string) bool {
+	if host == "" || len(host) > 255 {
+		return false
+	}
+	return !strings.ContainsAny(host, "/\\?#@ \t\r\n")
+}
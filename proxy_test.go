@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext_ClientIP(t *testing.T) {
+	testCases := []struct {
+		name      string
+		remote    string
+		trusted   []string
+		forwarded bool
+		header    http.Header
+		want      string
+	}{
+		{
+			name:   "no proxy",
+			remote: "1.2.3.4:5678",
+			header: http.Header{"X-Forwarded-For": {"9.9.9.9"}},
+			want:   "1.2.3.4",
+		},
+		{
+			name:    "untrusted remote ignores headers",
+			remote:  "1.2.3.4:5678",
+			trusted: []string{"10.0.0.0/8"},
+			header:  http.Header{"X-Forwarded-For": {"9.9.9.9"}, "X-Real-Ip": {"8.8.8.8"}},
+			want:    "1.2.3.4",
+		},
+		{
+			name:    "x-forwarded-for",
+			remote:  "10.0.0.1:5678",
+			trusted: []string{"10.0.0.0/8"},
+			header:  http.Header{"X-Forwarded-For": {"9.9.9.9, 1.2.3.4, 10.0.0.2"}},
+			want:    "1.2.3.4",
+		},
+		{
+			name:    "x-forwarded-for multiple lines",
+			remote:  "10.0.0.1:5678",
+			trusted: []string{"10.0.0.0/8"},
+			header:  http.Header{"X-Forwarded-For": {"9.9.9.9", "1.2.3.4"}},
+			want:    "1.2.3.4",
+		},
+		{
+			name:    "all trusted",
+			remote:  "10.0.0.1:5678",
+			trusted: []string{"10.0.0.0/8"},
+			header:  http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			want:    "10.0.0.3",
+		},
+		{
+			name:    "x-real-ip",
+			remote:  "127.0.0.1:5678",
+			trusted: []string{"127.0.0.1"},
+			header:  http.Header{"X-Real-Ip": {"1.2.3.4"}},
+			want:    "1.2.3.4",
+		},
+		{
+			name:      "forwarded ignores x-forwarded-for",
+			remote:    "[::1]:5678",
+			trusted:   []string{"::1", "10.0.0.0/8"},
+			forwarded: true,
+			header: http.Header{
+				"Forwarded":       {`for=9.9.9.9, for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.2`},
+				"X-Forwarded-For": {"8.8.8.8"},
+				"X-Real-Ip":       {"8.8.8.8"},
+			},
+			want: "2001:db8:cafe::17",
+		},
+		{
+			// 代理只追加 X-Forwarded-For 的时候，客户端伪造的 Forwarded 不会被使用
+			name:    "x-forwarded-for ignores forwarded",
+			remote:  "10.0.0.1:5678",
+			trusted: []string{"10.0.0.0/8"},
+			header: http.Header{
+				"Forwarded":       {"for=9.9.9.9"},
+				"X-Forwarded-For": {"1.2.3.4"},
+			},
+			want: "1.2.3.4",
+		},
+		{
+			name:      "forwarded unknown",
+			remote:    "10.0.0.1:5678",
+			trusted:   []string{"10.0.0.0/8"},
+			forwarded: true,
+			header:    http.Header{"Forwarded": {`for=9.9.9.9, for=unknown`}},
+			want:      "10.0.0.1",
+		},
+		{
+			// 无法解析的地址左边都不可信，返回离我们最近的信任代理，不会使用 X-Real-IP
+			name:    "unparsable returns nearest trusted hop",
+			remote:  "10.0.0.1:5678",
+			trusted: []string{"10.0.0.0/8"},
+			header: http.Header{
+				"X-Forwarded-For": {"9.9.9.9, garbage, 10.0.0.2"},
+				"X-Real-Ip":       {"8.8.8.8"},
+			},
+			want: "10.0.0.2",
+		},
+		{
+			name:    "ipv4 mapped remote",
+			remote:  "[::ffff:10.0.0.1]:5678",
+			trusted: []string{"10.0.0.0/8"},
+			header:  http.Header{"X-Forwarded-For": {"1.2.3.4"}},
+			want:    "1.2.3.4",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts []ServerOption
+			if len(tc.trusted) > 0 {
+				opts = append(opts, WithTrustedProxies(tc.trusted...))
+			}
+			if tc.forwarded {
+				opts = append(opts, WithForwardedHeader(Forwarded))
+			}
+			s := NewHTTPServer("test", "", opts...)
+			s.Get("/ip", func(ctx *Context) {
+				_ = ctx.StatusOK(ctx.ClientIP())
+			})
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = tc.remote
+			for k, vs := range tc.header {
+				req.Header[k] = vs
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.want, recorder.Body.String())
+		})
+	}
+}
+
+func TestContext_SchemeAndHost(t *testing.T) {
+	testCases := []struct {
+		name       string
+		remote     string
+		tls        bool
+		forwarded  bool
+		header     http.Header
+		wantScheme string
+		wantHost   string
+	}{
+		{
+			name:       "direct",
+			remote:     "1.2.3.4:5678",
+			header:     http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"evil.com"}},
+			wantScheme: "http",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "direct tls",
+			remote:     "1.2.3.4:5678",
+			tls:        true,
+			wantScheme: "https",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "x-forwarded",
+			remote:     "10.0.0.1:5678",
+			header:     http.Header{"X-Forwarded-Proto": {"http, https"}, "X-Forwarded-Host": {"api.example.com"}},
+			wantScheme: "https",
+			wantHost:   "api.example.com",
+		},
+		{
+			name:       "forwarded",
+			remote:     "10.0.0.1:5678",
+			forwarded:  true,
+			header:     http.Header{"Forwarded": {`for=1.2.3.4;proto=HTTPS;host="www.example.com:8443"`}, "X-Forwarded-Host": {"evil.com"}},
+			wantScheme: "https",
+			wantHost:   "www.example.com:8443",
+		},
+		{
+			name:       "forwarded not trusted by default",
+			remote:     "10.0.0.1:5678",
+			header:     http.Header{"Forwarded": {`proto=https;host=evil.com`}},
+			wantScheme: "http",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "invalid values",
+			remote:     "10.0.0.1:5678",
+			header:     http.Header{"X-Forwarded-Proto": {"javascript"}, "X-Forwarded-Host": {"evil.com/path"}},
+			wantScheme: "http",
+			wantHost:   "example.com",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := []ServerOption{WithTrustedProxies("10.0.0.0/8")}
+			if tc.forwarded {
+				opts = append(opts, WithForwardedHeader(Forwarded))
+			}
+			s := NewHTTPServer("test", "", opts...)
+			s.Get("/", func(ctx *Context) {
+				_ = ctx.StatusOK(ctx.Scheme() + "://" + ctx.Host())
+			})
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.RemoteAddr = tc.remote
+			if tc.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for k, vs := range tc.header {
+				req.Header[k] = vs
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantScheme+"://"+tc.wantHost, recorder.Body.String())
+		})
+	}
+}
+
+func TestWithTrustedProxies(t *testing.T) {
+	assert.Panics(t, func() {
+		WithTrustedProxies("not an ip")
+	})
+}
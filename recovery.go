@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// PanicError handler panic 之后转换成的错误
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("web: panic: %v", e.Value)
+}
+
+// Unwrap panic 的值本身是 error 的时候可以用 errors.Is 和 errors.As 判断
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// PanicHook 上报 panic，例如发送到错误监控系统
+type PanicHook func(ctx *Context, err *PanicError)
+
+type recoveryConfig struct {
+	logger *log.Logger
+	hooks  []PanicHook
+}
+
+type RecoveryOption func(cfg *recoveryConfig)
+
+// WithPanicHook 发生 panic 的时候调用，可以注册多个
+func WithPanicHook(hook PanicHook) RecoveryOption {
+	return func(cfg *recoveryConfig) {
+		cfg.hooks = append(cfg.hooks, hook)
+	}
+}
+
+// WithRecoveryLogger 打印 panic 和调用栈的日志，默认 log.Default()
+func WithRecoveryLogger(logger *log.Logger) RecoveryOption {
+	return func(cfg *recoveryConfig) {
+		cfg.logger = logger
+	}
+}
+
+// WithRecovery 替换默认的 Recovery 中间件，传 nil 表示不使用
+func WithRecovery(m Middleware) ServerOption {
+	return func(server *HTTPServer) {
+		server.recovery = m
+	}
+}
+
+// Recovery 把 panic 转换成 *PanicError 交给 ErrorHandler，默认返回 500。
+// HTTPServer 默认会在路由中间件的外层、Use 注册的中间件的内层使用它，所以访问日志之类的中间件能够看到 500；
+// 所有中间件的最外层还会再包一次，处理 Use 注册的中间件自己发生的 panic。
+// http.ErrAbortHandler 会继续往外抛，交给 net/http 中断连接
+func Recovery(opts ...RecoveryOption) Middleware {
+	cfg := &recoveryConfig{logger: log.Default()}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				err := &PanicError{Value: rec, Stack: debug.Stack()}
+				if ctx.requestID != "" {
+					cfg.logger.Printf("web: [%s] %s %s panic: %v\n%s", ctx.requestID, ctx.Request.Method, ctx.Request.URL.Path, rec, err.Stack)
+				} else {
+					cfg.logger.Printf("web: %s %s panic: %v\n%s", ctx.Request.Method, ctx.Request.URL.Path, rec, err.Stack)
+				}
+				for _, hook := range cfg.hooks {
+					hook(ctx, err)
+				}
+				ctx.Error(err)
+			}()
+			next(ctx)
+		}
+	}
+}
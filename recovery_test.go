@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecovery(t *testing.T) {
+	logs := &bytes.Buffer{}
+	var status int
+	s := NewHTTPServer("test", "")
+	s.log = log.New(logs, "", 0)
+	s.recovery = Recovery(WithRecoveryLogger(s.log))
+	s.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			status = ctx.responseStatus()
+		}
+	})
+	s.Get("/panic", func(ctx *Context) {
+		panic("boom")
+	})
+	s.Get("/stream", func(ctx *Context) {
+		_ = ctx.Stream(func(w io.Writer) error {
+			_, err := w.Write([]byte("partial"))
+			return err
+		})
+		panic("boom")
+	})
+	cleaned := 0
+	s.Get("/abort", func(ctx *Context) {
+		ctx.addCleanup(func() { cleaned++ })
+		panic(http.ErrAbortHandler)
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, "500 INTERNAL SERVER ERROR", recorder.Body.String())
+	assert.NotContains(t, recorder.Body.String(), "boom")
+	// Use 注册的中间件在 Recovery 外层，可以看到 500
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Contains(t, logs.String(), "panic: boom")
+	assert.Contains(t, logs.String(), "recovery_test.go")
+
+	// 响应已经提交，只能保留已经写出去的内容
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "partial", recorder.Body.String())
+
+	// 继续往外抛的 panic 也要执行清理
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+	})
+	assert.Equal(t, 1, cleaned)
+}
+
+// Use 注册的中间件自己 panic 的时候由最外层的 Recovery 返回 500，清理也会执行
+func TestRecovery_UseMiddlewarePanic(t *testing.T) {
+	logs := &bytes.Buffer{}
+	s := NewHTTPServer("test", "")
+	s.recovery = Recovery(WithRecoveryLogger(log.New(logs, "", 0)))
+	cleaned := 0
+	s.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			if ctx.Request.URL.Path == "/abort" {
+				panic(http.ErrAbortHandler)
+			}
+			panic("middleware boom")
+		}
+	})
+	s.Get("/", func(ctx *Context) {
+		ctx.addCleanup(func() { cleaned++ })
+		_ = ctx.StatusOK("ok")
+	})
+	s.Get("/abort", func(ctx *Context) {
+		ctx.addCleanup(func() { cleaned++ })
+		_ = ctx.StatusOK("ok")
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, "500 INTERNAL SERVER ERROR", recorder.Body.String())
+	assert.Contains(t, logs.String(), "panic: middleware boom")
+	assert.Equal(t, 1, cleaned)
+
+	// http.ErrAbortHandler 仍然交给 net/http
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+	})
+	assert.Equal(t, 2, cleaned)
+}
+
+func TestRecovery_HookAndErrorHandler(t *testing.T) {
+	var reported *PanicError
+	errBoom := errors.New("boom")
+	s := NewHTTPServer("test", "",
+		WithRecovery(Recovery(WithRecoveryLogger(log.New(io.Discard, "", 0)), WithPanicHook(func(ctx *Context, err *PanicError) {
+			reported = err
+		}))),
+		WithErrorHandler(func(ctx *Context, err error) {
+			var he *HTTPError
+			if errors.As(err, &he) {
+				_ = ctx.ResponseWithJSON(he.Code, map[string]string{"error": he.Message})
+				return
+			}
+			_ = ctx.ResponseWithJSON(http.StatusInternalServerError, map[string]string{"error": "internal"})
+		}))
+	s.Get("/panic", func(ctx *Context) {
+		panic(errBoom)
+	})
+	s.Get("/error", func(ctx *Context) {
+		ctx.Error(NewHTTPError(http.StatusForbidden, "forbidden"))
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, `{"error":"internal"}`, recorder.Body.String())
+	require.NotNil(t, reported)
+	assert.ErrorIs(t, reported, errBoom)
+	assert.NotEmpty(t, reported.Stack)
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/error", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, `{"error":"forbidden"}`, recorder.Body.String())
+}
+
+func TestDefaultErrorHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	ctx := &Context{ResponseWriter: recorder}
+	ctx.Error(&HTTPError{Code: http.StatusTeapot, Err: errors.New("detail")})
+	assert.Equal(t, http.StatusTeapot, ctx.StatusCode)
+	assert.Equal(t, "I'm a teapot", string(ctx.ResponseData))
+
+	ctx = &Context{ResponseWriter: recorder}
+	ctx.Error(errors.New("detail"))
+	assert.Equal(t, http.StatusInternalServerError, ctx.StatusCode)
+	assert.Equal(t, "500 INTERNAL SERVER ERROR", string(ctx.ResponseData))
+}
+
+// failingWriter 模拟客户端断开连接
+type failingWriter struct {
+	httptest.ResponseRecorder
+}
+
+func (f *failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestHTTPServer_flushResponseWriteError(t *testing.T) {
+	logs := &bytes.Buffer{}
+	s := NewHTTPServer("test", "")
+	s.log = log.New(logs, "", 0)
+	s.Get("/", func(ctx *Context) {
+		_ = ctx.StatusOK("hello")
+	})
+	w := &failingWriter{ResponseRecorder: *httptest.NewRecorder()}
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, logs.String(), "broken pipe")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net/http"
+	"time"
+)
+
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLen 客户端传过来的 ID 超过这个长度就重新生成，避免日志被塞进超长的内容
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+type requestIDConfig struct {
+	header        string
+	generator     func() string
+	trustIncoming bool
+}
+
+type RequestIDOption func(cfg *requestIDConfig)
+
+// WithRequestIDHeader 读写请求 ID 使用的头部，默认 X-Request-ID
+func WithRequestIDHeader(header string) RequestIDOption {
+	return func(cfg *requestIDConfig) {
+		cfg.header = http.CanonicalHeaderKey(header)
+	}
+}
+
+// WithRequestIDGenerator 生成请求 ID，默认 NewULID
+func WithRequestIDGenerator(fn func() string) RequestIDOption {
+	return func(cfg *requestIDConfig) {
+		cfg.generator = fn
+	}
+}
+
+// WithRequestIDTrustIncoming 是否沿用请求里面带过来的 ID，默认沿用。
+// 直接面对公网的服务可以关掉，每个请求都重新生成
+func WithRequestIDTrustIncoming(trust bool) RequestIDOption {
+	return func(cfg *requestIDConfig) {
+		cfg.trustIncoming = trust
+	}
+}
+
+// RequestID 读取或者生成请求 ID，放到 Context、请求的 context.Context 以及响应头里面。
+// 访问日志和 Recovery 的日志会带上它，调用下游服务的时候使用 ctx.RoundTripper 传递下去。
+// 一般通过 HTTPServer.Use 注册在访问日志的内层
+func RequestID(opts ...RequestIDOption) Middleware {
+	cfg := &requestIDConfig{
+		header:        HeaderRequestID,
+		generator:     NewULID,
+		trustIncoming: true,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			id := ""
+			if cfg.trustIncoming {
+				id = ctx.Request.Header.Get(cfg.header)
+			}
+			if !validRequestID(id) {
+				id = cfg.generator()
+			}
+			ctx.requestID = id
+			ctx.requestIDHeader = cfg.header
+			ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), requestIDKey{}, id))
+			ctx.ResponseWriter.Header().Set(cfg.header, id)
+			next(ctx)
+		}
+	}
+}
+
+// RequestID 当前请求的 ID，没有使用 RequestID 中间件的时候返回空字符串
+func (c *Context) RequestID() string {
+	return c.requestID
+}
+
+// RequestIDFromContext 从 context.Context 里面取出请求 ID，
+// 用于拿不到 *Context 的地方，例如 goroutine 或者 DAO 层的日志
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RoundTripper 调用下游服务时使用，把当前请求的 ID 放到请求头里面，base 为 nil 的时候使用 http.DefaultTransport。
+// 返回的 RoundTripper 只复制了 ID，不引用 ctx，所以 handler 返回之后仍然可以使用
+//
+//	client := &http.Client{Transport: ctx.RoundTripper(nil)}
+func (c *Context) RoundTripper(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	header := c.requestIDHeader
+	if header == "" {
+		header = HeaderRequestID
+	}
+	return &requestIDTransport{base: base, header: header, id: c.requestID}
+}
+
+type requestIDTransport struct {
+	base   http.RoundTripper
+	header string
+	id     string
+}
+
+// RoundTrip 不能修改传进来的请求，所以设置头部之前要复制一份
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := t.id
+	if id == "" {
+		id = RequestIDFromContext(req.Context())
+	}
+	if id == "" || req.Header.Get(t.header) != "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(t.header, id)
+	return t.base.RoundTrip(req)
+}
+
+// validRequestID 只允许可打印的 ASCII 字符，防止日志注入
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID 生成 ULID，前 48 位是毫秒时间戳，后 80 位是随机数，
+// 编码成 26 个字符的 Crockford Base32，字典序和生成时间一致
+func NewULID() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic("web: 生成随机数失败 " + err.Error())
+	}
+	return encodeULID(b)
+}
+
+// encodeULID 128 位按照 5 位一组编码，最前面补两个 0 凑够 130 位
+func encodeULID(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+	var res [26]byte
+	for i := 25; i >= 0; i-- {
+		res[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(res[:])
+}
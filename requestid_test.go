@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ulidRegexp = regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)
+
+func TestRequestID(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get(HeaderRequestID)))
+	}))
+	defer downstream.Close()
+
+	var logBuf bytes.Buffer
+	s := NewHTTPServer("test", "", WithRecovery(Recovery(WithRecoveryLogger(log.New(&logBuf, "", 0)))))
+	s.Use(RequestID())
+	s.Get("/call", func(ctx *Context) {
+		assert.Equal(t, ctx.RequestID(), RequestIDFromContext(ctx.Request.Context()))
+		client := &http.Client{Transport: ctx.RoundTripper(nil)}
+		resp, err := client.Get(downstream.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body bytes.Buffer
+		_, _ = body.ReadFrom(resp.Body)
+		_ = ctx.StatusOK(body.String())
+	})
+	s.Get("/panic", func(ctx *Context) {
+		panic("boom")
+	})
+
+	testCases := []struct {
+		name     string
+		incoming string
+		wantID   string
+	}{
+		{name: "generate"},
+		{name: "incoming", incoming: "abc-123", wantID: "abc-123"},
+		{name: "invalid incoming", incoming: "a b\tc"},
+		{name: "too long", incoming: strings.Repeat("a", maxRequestIDLen+1)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/call", nil)
+			if tc.incoming != "" {
+				req.Header.Set(HeaderRequestID, tc.incoming)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			id := recorder.Header().Get(HeaderRequestID)
+			if tc.wantID != "" {
+				assert.Equal(t, tc.wantID, id)
+			} else {
+				assert.Regexp(t, ulidRegexp, id)
+			}
+			// 下游服务收到的 ID 和响应头里面的一致
+			assert.Equal(t, id, recorder.Body.String())
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set(HeaderRequestID, "req-panic")
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, "req-panic", recorder.Header().Get(HeaderRequestID))
+	assert.Contains(t, logBuf.String(), "[req-panic]")
+}
+
+func TestRequestID_Options(t *testing.T) {
+	var entries []*AccessLogEntry
+	s := NewHTTPServer("test", "")
+	s.Use(AccessLog(WithAccessLogger(AccessLoggerFunc(func(entry *AccessLogEntry) {
+		entries = append(entries, entry)
+	}))), RequestID(
+		WithRequestIDHeader("x-correlation-id"),
+		WithRequestIDGenerator(func() string { return "fixed" }),
+		WithRequestIDTrustIncoming(false),
+	))
+	s.Get("/", func(ctx *Context) {
+		_ = ctx.StatusOK(ctx.RequestID())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Correlation-ID", "from-client")
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, "fixed", recorder.Body.String())
+	assert.Equal(t, "fixed", recorder.Header().Get("X-Correlation-ID"))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "fixed", entries[0].RequestID)
+}
+
+func TestContext_RoundTripper(t *testing.T) {
+	var got []string
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		got = append(got, req.Header.Get(HeaderRequestID))
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+
+	// 没有使用中间件的时候从请求的 context.Context 里面取
+	ctx := &Context{}
+	rt := ctx.RoundTripper(base)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	require.NoError(t, err)
+	_, err = rt.RoundTrip(req)
+	require.NoError(t, err)
+
+	ctx.requestID = "req-1"
+	rt = ctx.RoundTripper(base)
+	_, err = rt.RoundTrip(req)
+	require.NoError(t, err)
+	// 不会修改调用方的请求
+	assert.Empty(t, req.Header.Get(HeaderRequestID))
+
+	// 调用方已经设置了的时候不覆盖
+	req.Header.Set(HeaderRequestID, "explicit")
+	_, err = rt.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "req-1", "explicit"}, got)
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewULID(t *testing.T) {
+	a := NewULID()
+	assert.Regexp(t, ulidRegexp, a)
+	assert.NotEqual(t, a, NewULID())
+
+	var b [16]byte
+	assert.Equal(t, strings.Repeat("0", 26), encodeULID(b))
+	for i := range b {
+		b[i] = 0xff
+	}
+	assert.Equal(t, "7"+strings.Repeat("Z", 25), encodeULID(b))
+	b = [16]byte{0: 0x01, 15: 0x01}
+	assert.Equal(t, "01000000000000000000000001", encodeULID(b))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrUnsafeRedirect      = errors.New("web: 不允许重定向到其它站点")
+	ErrInvalidRedirectCode = errors.New("web: 重定向的状态码必须是 3xx")
+)
+
+// WithRedirectHosts 允许重定向到的其它站点，默认只允许本站的相对路径和同一个 Host
+func WithRedirectHosts(hosts ...string) ServerOption {
+	return func(server *HTTPServer) {
+		if server.redirectHosts == nil {
+			server.redirectHosts = make(map[string]struct{}, len(hosts))
+		}
+		for _, host := range hosts {
+			server.redirectHosts[strings.ToLower(host)] = struct{}{}
+		}
+	}
+}
+
+// Header 设置响应头，flushResponse 之前设置的都会生效，包括中间件在 handler 之后设置的
+func (c *Context) Header(key, value string) {
+	c.ResponseWriter.Header().Set(key, value)
+}
+
+// Redirect 重定向，为了防止开放重定向，只允许以下目标：
+//   - 本站的绝对路径，例如 /login?next=/home，但是不允许 //evil.com 这种协议相对地址
+//   - 和当前请求同一个 Host 的 http、https 地址
+//   - WithRedirectHosts 里面配置的 Host
+func (c *Context) Redirect(code int, location string) error {
+	if code < 300 || code > 399 {
+		return ErrInvalidRedirectCode
+	}
+	if !c.safeRedirect(location) {
+		return ErrUnsafeRedirect
+	}
+	c.Header("Location", location)
+	c.StatusCode = code
+	c.ResponseData = nil
+	return nil
+}
+
+func (c *Context) safeRedirect(location string) bool {
+	// 浏览器会把反斜杠当成斜杠，/\evil.com 等价于 //evil.com
+	if strings.ContainsAny(location, "\\\r\n\t") {
+		return false
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		return strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	if c.Request != nil && host == strings.ToLower(c.Request.Host) {
+		return true
+	}
+	_, ok := c.redirectHosts[host]
+	return ok
+}
+
+// NoContent 返回 204，没有响应体
+func (c *Context) NoContent() error {
+	c.StatusCode = http.StatusNoContent
+	c.ResponseData = nil
+	return nil
+}
+
+// Created 返回 201，location 是新建资源的地址，body 不为 nil 的时候按照 Accept 协商编码
+func (c *Context) Created(location string, body any) error {
+	if location != "" {
+		c.Header("Location", location)
+	}
+	if body == nil {
+		c.StatusCode = http.StatusCreated
+		c.ResponseData = nil
+		return nil
+	}
+	return c.Render(http.StatusCreated, body)
+}
+
+// bodyAllowedForStatus 1xx、204、304 不允许有响应体，也不应该有 Content-Length
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
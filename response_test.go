@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_Redirect(t *testing.T) {
+	testCases := []struct {
+		name     string
+		code     int
+		location string
+		wantErr  error
+	}{
+		{name: "relative", code: http.StatusFound, location: "/login?next=/home"},
+		{name: "same host", code: http.StatusSeeOther, location: "https://example.com/home"},
+		{name: "allowed host", code: http.StatusFound, location: "https://sso.example.org/auth"},
+		{name: "other host", code: http.StatusFound, location: "https://evil.com", wantErr: ErrUnsafeRedirect},
+		{name: "protocol relative", code: http.StatusFound, location: "//evil.com", wantErr: ErrUnsafeRedirect},
+		{name: "backslash", code: http.StatusFound, location: "/\\evil.com", wantErr: ErrUnsafeRedirect},
+		{name: "javascript", code: http.StatusFound, location: "javascript:alert(1)", wantErr: ErrUnsafeRedirect},
+		{name: "path without slash", code: http.StatusFound, location: "evil.com", wantErr: ErrUnsafeRedirect},
+		{name: "bad code", code: http.StatusOK, location: "/home", wantErr: ErrInvalidRedirectCode},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer("test", "", WithRedirectHosts("SSO.example.org"))
+			s.Get("/go", func(ctx *Context) {
+				assert.Equal(t, tc.wantErr, ctx.Redirect(tc.code, tc.location))
+			})
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://example.com/go", nil))
+			if tc.wantErr != nil {
+				assert.Empty(t, recorder.Header().Get("Location"))
+				return
+			}
+			assert.Equal(t, tc.code, recorder.Code)
+			assert.Equal(t, tc.location, recorder.Header().Get("Location"))
+		})
+	}
+}
+
+func TestContext_ResponseHelpers(t *testing.T) {
+	s := NewHTTPServer("test", "")
+	// 中间件在 handler 之后设置的响应头也要生效
+	afterHandler := func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			ctx.Header("X-After", "1")
+		}
+	}
+	s.Delete("/user", func(ctx *Context) {
+		require.NoError(t, ctx.NoContent())
+	}, afterHandler)
+	s.Post("/user", func(ctx *Context) {
+		require.NoError(t, ctx.Created("/user/12", map[string]int{"id": 12}))
+	}, afterHandler)
+	s.PUT("/user", func(ctx *Context) {
+		require.NoError(t, ctx.Created("/user/12", nil))
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/user", nil))
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("X-After"))
+	assert.Empty(t, recorder.Header().Get("Content-Length"))
+	assert.Empty(t, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/user", nil))
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "/user/12", recorder.Header().Get("Location"))
+	assert.Equal(t, "1", recorder.Header().Get("X-After"))
+	assert.Equal(t, `{"id":12}`, recorder.Body.String())
+	assert.Equal(t, "9", recorder.Header().Get("Content-Length"))
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/user", nil))
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "0", recorder.Header().Get("Content-Length"))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter 框架自己的 http.ResponseWriter，记录状态码、写入的字节数以及响应是否已经提交
+// 直接写 ctx.ResponseWriter 也会经过它，所以 flushResponse 能够知道响应已经被 handler 写过了
+type ResponseWriter struct {
+	http.ResponseWriter
+	status    int
+	size      int64
+	committed bool
+}
+
+// WriteHeader 只有第一次调用生效，1xx（101 除外）的中间响应不会提交响应
+func (w *ResponseWriter) WriteHeader(code int) {
+	if w.committed {
+		return
+	}
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+	w.committed = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if !w.committed {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Status 已经发送的状态码，还没有提交的时候返回 0
+func (w *ResponseWriter) Status() int {
+	return w.status
+}
+
+// Size 已经写入的响应体字节数
+func (w *ResponseWriter) Size() int64 {
+	return w.size
+}
+
+// Committed 响应头是否已经发送
+func (w *ResponseWriter) Committed() bool {
+	return w.committed
+}
+
+// Unwrap 返回底层的 http.ResponseWriter，http.ResponseController 会用到
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush 底层不支持 http.Flusher 的时候什么也不做
+func (w *ResponseWriter) Flush() {
+	f, ok := w.ResponseWriter.(http.Flusher)
+	if !ok {
+		return
+	}
+	if !w.committed {
+		w.WriteHeader(http.StatusOK)
+	}
+	f.Flush()
+}
+
+// Hijack 接管连接之后响应被视为已经提交
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("web: ResponseWriter 不支持 http.Hijacker")
+	}
+	conn, brw, err := h.Hijack()
+	if err == nil {
+		w.committed = true
+	}
+	return conn, brw, err
+}
+
+// Push HTTP/2 服务端推送，底层不支持的时候返回 http.ErrNotSupported
+func (w *ResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+func (w *ResponseWriter) canFlush() bool {
+	_, ok := w.ResponseWriter.(http.Flusher)
+	return ok
+}
+
+func (w *ResponseWriter) canHijack() bool {
+	_, ok := w.ResponseWriter.(http.Hijacker)
+	return ok
+}
+
+// response 返回框架的 ResponseWriter，没有的时候包装一下 ctx.ResponseWriter
+// 中间件可以再包装 ctx.ResponseWriter，但是最终都会写到这里
+func (c *Context) response() *ResponseWriter {
+	if c.resp == nil {
+		if rw, ok := c.ResponseWriter.(*ResponseWriter); ok {
+			c.resp = rw
+		} else {
+			c.resp = &ResponseWriter{ResponseWriter: c.ResponseWriter}
+			c.ResponseWriter = c.resp
+		}
+	}
+	return c.resp
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseWriter(t *testing.T) {
+	// 1xx 的中间响应不算提交
+	w := &ResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	w.WriteHeader(http.StatusEarlyHints)
+	assert.False(t, w.Committed())
+	assert.Equal(t, 0, w.Status())
+
+	recorder := httptest.NewRecorder()
+	w = &ResponseWriter{ResponseWriter: recorder}
+	_, _ = w.Write([]byte("hello"))
+	assert.True(t, w.Committed())
+	assert.Equal(t, http.StatusOK, w.Status())
+	assert.Equal(t, int64(5), w.Size())
+
+	// 重复的 WriteHeader 被忽略
+	w.WriteHeader(http.StatusInternalServerError)
+	assert.Equal(t, http.StatusOK, w.Status())
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	w.Flush()
+	assert.True(t, recorder.Flushed)
+	assert.True(t, w.canFlush())
+	assert.False(t, w.canHijack())
+	_, _, err := w.Hijack()
+	assert.Error(t, err)
+	assert.Equal(t, http.ErrNotSupported, w.Push("/app.css", nil))
+	assert.Equal(t, recorder, w.Unwrap())
+}
+
+func TestHTTPServer_flushResponse(t *testing.T) {
+	logs := &bytes.Buffer{}
+	s := NewHTTPServer("test", "")
+	s.log = log.New(logs, "", 0)
+	s.Get("/direct", func(ctx *Context) {
+		// 直接写 ResponseWriter 之后，ResponseData 不会再被追加到响应里面
+		ctx.ResponseWriter.WriteHeader(http.StatusAccepted)
+		_, _ = ctx.ResponseWriter.Write([]byte("direct"))
+		ctx.ResponseData = []byte("buffered")
+	})
+	s.Get("/buffered", func(ctx *Context) {
+		ctx.ResponseWriter.Header().Set("X-Test", "1")
+		_ = ctx.StatusOK("buffered")
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/direct", nil))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "direct", recorder.Body.String())
+	assert.Contains(t, logs.String(), "丢弃 8 字节")
+
+	recorder = httptest.NewRecorder()
+	ctx := &Context{
+		Request:        httptest.NewRequest(http.MethodGet, "/buffered", nil),
+		ResponseWriter: recorder,
+	}
+	s.serve(ctx)
+	assert.Equal(t, "8", recorder.Header().Get("Content-Length"))
+	assert.Equal(t, "1", recorder.Header().Get("X-Test"))
+	assert.Equal(t, "buffered", recorder.Body.String())
+	assert.Equal(t, int64(8), ctx.response().Size())
+
+	// 重复调用不会重复写
+	logs.Reset()
+	s.flushResponse(ctx)
+	assert.Equal(t, "buffered", recorder.Body.String())
+	assert.Empty(t, logs.String())
+}
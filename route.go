@@ -7,6 +7,8 @@ import (
 
 type router struct {
 	trees map[string]*node
+	// hasMdls 没有注册过路由中间件的时候查找路由可以跳过查找中间件
+	hasMdls bool
 }
 
 func newRouter() router {
@@ -15,7 +17,7 @@ func newRouter() router {
 	}
 }
 
-func (r *router) addRoute(method string, path string, handler HandleFunc, ms ...Middleware) {
+func (r *router) addRoute(method string, path string, handler HandleFunc, ms ...Middleware) *node {
 	if path == "" {
 		panic("web: 路由是空字符串")
 	}
@@ -37,8 +39,10 @@ func (r *router) addRoute(method string, path string, handler HandleFunc, ms ...
 			panic("web: 路由冲突[/]")
 		}
 		root.handler = handler
+		root.route = path
 		root.mdls = ms
-		return
+		r.hasMdls = r.hasMdls || len(ms) > 0
+		return root
 	}
 
 	segs := strings.Split(path[1:], "/")
@@ -55,34 +59,51 @@ func (r *router) addRoute(method string, path string, handler HandleFunc, ms ...
 	root.handler = handler
 	root.route = path
 	root.mdls = ms
+	r.hasMdls = r.hasMdls || len(ms) > 0
+	return root
 }
 
 func (r *router) findRoute(method string, path string) (*matchInfo, bool) {
+	mi := &matchInfo{}
+	ok := r.find(method, path, mi)
+	return mi, ok
+}
+
+// find 查找路由，结果放在 mi 里面。mi.pathParams 的底层数组会被复用，
+// 所以 ServeHTTP 可以把上一个请求的 PathParams 传进来，避免每次都分配内存
+func (r *router) find(method string, path string, mi *matchInfo) bool {
+	mi.pathParams = mi.pathParams[:0]
 	root, ok := r.trees[method]
 	if !ok {
-		return &matchInfo{}, false
+		return false
 	}
 
 	if path == "/" {
-		return &matchInfo{n: root, mdls: root.mdls}, true
+		mi.n = root
+		mi.mdls = root.mdls
+		return true
 	}
 
-	segs := strings.Split(strings.Trim(path, "/"), "/")
-	mi := &matchInfo{}
+	trimmed := strings.Trim(path, "/")
 	cur := root
-	for _, s := range segs {
+	for rest, more := trimmed, true; more; {
+		var seg string
+		seg, rest, more = strings.Cut(rest, "/")
 		var matchParam bool
-		cur, matchParam, ok = cur.childOf(s)
+		cur, matchParam, ok = cur.childOf(seg)
 		if !ok {
-			return &matchInfo{}, false
+			mi.pathParams = mi.pathParams[:0]
+			return false
 		}
 		if matchParam {
-			mi.addValue(cur.path[1:], s)
+			mi.addValue(cur.path[1:], seg)
 		}
 	}
 	mi.n = cur
-	mi.mdls = r.findMdls(root, segs)
-	return mi, true
+	if r.hasMdls {
+		mi.mdls = r.findMdls(root, strings.Split(trimmed, "/"))
+	}
+	return true
 }
 
 func (r *router) findMdls(root *node, segs []string) []Middleware {
@@ -115,6 +136,8 @@ type node struct {
 	mdls     []Middleware
 
 	route string
+	// authz 路由声明的权限要求，由 Authorize 中间件检查
+	authz *routeAuthz
 
 	starChild *node
 
@@ -194,13 +217,30 @@ func (n *node) childOrCreate(path string) *node {
 
 type matchInfo struct {
 	n          *node
-	pathParams map[string]string
+	pathParams Params
 	mdls       []Middleware
 }
 
 func (m *matchInfo) addValue(key string, value string) {
-	if m.pathParams == nil {
-		m.pathParams = map[string]string{key: value}
+	m.pathParams = append(m.pathParams, Param{Key: key, Value: value})
+}
+
+// Param 一个路径参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params 路径参数，按照在路由里面出现的顺序排列。
+// 路径参数一般只有一两个，用切片比 map 快，而且可以在请求之间复用
+type Params []Param
+
+// Get 找不到的时候返回 false
+func (ps Params) Get(key string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value, true
+		}
 	}
-	m.pathParams[key] = value
+	return "", false
 }
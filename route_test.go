@@ -395,7 +395,7 @@ func Test_router_findRoute(t *testing.T) {
 					path:    ":id",
 					handler: mockHandler,
 				},
-				pathParams: map[string]string{"id": "123"},
+				pathParams: Params{{Key: "id", Value: "123"}},
 			},
 		},
 		{
@@ -409,7 +409,7 @@ func Test_router_findRoute(t *testing.T) {
 					path:    "*",
 					handler: mockHandler,
 				},
-				pathParams: map[string]string{"id": "123"},
+				pathParams: Params{{Key: "id", Value: "123"}},
 			},
 		},
 
@@ -424,7 +424,7 @@ func Test_router_findRoute(t *testing.T) {
 					path:    "detail",
 					handler: mockHandler,
 				},
-				pathParams: map[string]string{"id": "123"},
+				pathParams: Params{{Key: "id", Value: "123"}},
 			},
 		},
 	}
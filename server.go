@@ -6,7 +6,9 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -14,7 +16,7 @@ type HttpServer interface {
 	http.Handler
 	Start(address string) error
 	Shutdown(ctx context.Context) error
-	addRoute(method, path string, handler HandleFunc, ms ...Middleware)
+	addRoute(method, path string, handler HandleFunc, ms ...Middleware) *node
 }
 
 type HTTPServer struct {
@@ -23,6 +25,28 @@ type HTTPServer struct {
 	reject bool
 	router
 	log *log.Logger
+
+	codecs *codecRegistry
+	// conns SSE、WebSocket 之类的长连接，退出的时候需要通知它们关闭
+	conns *connTracker
+
+	uploadLimits uploadLimits
+
+	templateEngine TemplateEngine
+	redirectHosts  map[string]struct{}
+	cookieKeys     *cookieKeyring
+	trustedProxies []netip.Prefix
+	// forwardedHeader 信任的代理使用的请求头
+	forwardedHeader ForwardedHeader
+	maxBodySize     int64
+
+	// mdls 服务器级别的中间件，所有请求都会经过，包括找不到路由的请求
+	mdls     []Middleware
+	recovery Middleware
+
+	errorHandler ErrorHandler
+
+	pool sync.Pool
 }
 
 type ServerOption func(server *HTTPServer)
@@ -33,8 +57,17 @@ func NewHTTPServer(name, addr string, opts ...ServerOption) *HTTPServer {
 		name:   name,
 		addr:   addr,
 		log:    log.Default(),
+		codecs: defaultCodecRegistry(),
+		conns:  newConnTracker(),
+		uploadLimits: uploadLimits{
+			maxMemory: defaultMultipartMemory,
+		},
 	}
 
+	s.recovery = Recovery(WithRecoveryLogger(s.log))
+	s.pool.New = func() any {
+		return &Context{}
+	}
 	for _, opt := range opts {
 		opt(s)
 	}
@@ -49,52 +82,91 @@ func (h *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := &Context{
-		Request:        r,
-		ResponseWriter: w,
-	}
+	ctx := h.pool.Get().(*Context)
+	ctx.Request = r
+	ctx.rw.ResponseWriter = w
+	ctx.resp = &ctx.rw
+	ctx.ResponseWriter = ctx.resp
+	ctx.codecs = h.codecs
+	ctx.conns = h.conns
+	ctx.uploadLimits = h.uploadLimits
+	ctx.templateEngine = h.templateEngine
+	ctx.redirectHosts = h.redirectHosts
+	ctx.cookieKeys = h.cookieKeys
+	ctx.trustedProxies = h.trustedProxies
+	ctx.forwardedHeader = h.forwardedHeader
+	ctx.errorHandler = h.errorHandler
+	ctx.limitBody(h.maxBodySize)
 
 	h.serve(ctx)
+
+	ctx.reset()
+	h.pool.Put(ctx)
 }
 
 func (h *HTTPServer) serve(ctx *Context) {
-	target, ok := h.findRoute(ctx.Request.Method, ctx.Request.URL.Path)
+	target := matchInfo{pathParams: ctx.PathParams}
+	ok := h.find(ctx.Request.Method, ctx.Request.URL.Path, &target)
+	ctx.PathParams = target.pathParams
 	if target.n != nil {
-		ctx.PathParams = target.pathParams
 		ctx.MatchedRoute = target.n.route
+		ctx.authz = target.n.authz
 	}
 
-	var root HandleFunc = func(ctx *Context) {
-		if !ok || target.n == nil || target.n.handler == nil {
-			ctx.StatusCode = 404
-			ctx.ResponseData = []byte("404 NOT FOUND")
-			return
-		}
-		target.n.handler(ctx)
+	root := notFound
+	if ok && target.n != nil && target.n.handler != nil {
+		root = target.n.handler
 	}
-
 	for i := len(target.mdls) - 1; i >= 0; i-- {
 		root = target.mdls[i](root)
 	}
-
-	var m Middleware = func(next HandleFunc) HandleFunc {
-		return func(ctx *Context) {
-			next(ctx)
-			h.flushResponse(ctx)
-		}
+	if h.recovery != nil {
+		root = h.recovery(root)
 	}
-	root = m(root)
+	for i := len(h.mdls) - 1; i >= 0; i-- {
+		root = h.mdls[i](root)
+	}
+	// 最外层再包一次，Use 注册的中间件自己 panic 的时候同样返回 500
+	if h.recovery != nil && len(h.mdls) > 0 {
+		root = h.recovery(root)
+	}
+	// 继续往外抛 http.ErrAbortHandler 的时候响应交给 net/http 处理，
+	// 但是临时文件、长连接记录之类的清理仍然要执行
+	defer ctx.runCleanups()
 	root(ctx)
+	h.flushResponse(ctx)
+}
+
+func notFound(ctx *Context) {
+	ctx.StatusCode = http.StatusNotFound
+	ctx.ResponseData = []byte("404 NOT FOUND")
 }
 
 func (h *HTTPServer) flushResponse(ctx *Context) {
-	if ctx.StatusCode > 0 {
-		ctx.ResponseWriter.WriteHeader(ctx.StatusCode)
+	// 已经提交的响应不能重复写，所以 flushResponse 是幂等的
+	if ctx.response().Committed() {
+		// handler 直接写了 ResponseWriter 或者使用了流式响应
+		if !ctx.flushed && len(ctx.ResponseData) > 0 {
+			h.log.Printf("响应已经提交，丢弃 %d 字节的 ResponseData", len(ctx.ResponseData))
+		}
+		return
+	}
+	ctx.flushed = true
+	// 响应头必须在 WriteHeader 之前设置，之后设置的都会被忽略
+	status := ctx.StatusCode
+	if status <= 0 {
+		status = http.StatusOK
+	}
+	if !bodyAllowedForStatus(status) {
+		ctx.ResponseWriter.WriteHeader(status)
+		return
 	}
 	ctx.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(ctx.ResponseData)))
+	ctx.ResponseWriter.WriteHeader(status)
 	_, err := ctx.ResponseWriter.Write(ctx.ResponseData)
 	if err != nil {
-		h.log.Fatalln("回写响应失败", err)
+		// 一般是客户端断开了连接，不能因为一个请求让整个进程退出
+		h.log.Println("回写响应失败", err)
 	}
 }
 
@@ -123,20 +195,32 @@ func (h *HTTPServer) rejectReq() {
 	h.reject = true
 }
 
-func (h *HTTPServer) Get(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodGet, path, handleFunc)
+// closeLongLivedConns 通知 SSE、WebSocket 之类的长连接关闭
+func (h *HTTPServer) closeLongLivedConns() {
+	log.Printf("服务器 %s 关闭 %d 个长连接", h.name, h.conns.len())
+	h.conns.closeAll()
+}
+
+// Use 注册服务器级别的中间件，在路由中间件之前执行，找不到路由的请求也会经过。
+// 它们能够看到 Recovery 转换之后的 500，自己发生的 panic 由最外层的 Recovery 处理
+func (h *HTTPServer) Use(ms ...Middleware) {
+	h.mdls = append(h.mdls, ms...)
+}
+
+func (h *HTTPServer) Get(path string, handleFunc HandleFunc, ms ...Middleware) *Route {
+	return &Route{n: h.addRoute(http.MethodGet, path, handleFunc, ms...)}
 }
 
-func (h *HTTPServer) Post(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodPost, path, handleFunc)
+func (h *HTTPServer) Post(path string, handleFunc HandleFunc, ms ...Middleware) *Route {
+	return &Route{n: h.addRoute(http.MethodPost, path, handleFunc, ms...)}
 }
-func (h *HTTPServer) Delete(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodDelete, path, handleFunc)
+func (h *HTTPServer) Delete(path string, handleFunc HandleFunc, ms ...Middleware) *Route {
+	return &Route{n: h.addRoute(http.MethodDelete, path, handleFunc, ms...)}
 }
 
-func (h *HTTPServer) PUT(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodPut, path, handleFunc)
+func (h *HTTPServer) PUT(path string, handleFunc HandleFunc, ms ...Middleware) *Route {
+	return &Route{n: h.addRoute(http.MethodPut, path, handleFunc, ms...)}
 }
-func (h *HTTPServer) Options(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodOptions, path, handleFunc)
+func (h *HTTPServer) Options(path string, handleFunc HandleFunc, ms ...Middleware) *Route {
+	return &Route{n: h.addRoute(http.MethodOptions, path, handleFunc, ms...)}
 }
@@ -3,7 +3,13 @@ package main
 import (
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 type V struct {
@@ -53,3 +59,98 @@ func TestHTTPServer(t *testing.T) {
 		log.Fatal(err)
 	}
 }
+
+// TestHTTPServer_ContextPool 并发请求复用 Context，不能串数据，需要配合 -race 运行
+func TestHTTPServer_ContextPool(t *testing.T) {
+	s := NewHTTPServer("test", "")
+	s.Get("/user/:id/order/:oid", func(ctx *Context) {
+		assert.Nil(t, ctx.ResponseData)
+		assert.Zero(t, ctx.StatusCode)
+		assert.Nil(t, ctx.cacheQueryValues)
+		assert.Len(t, ctx.PathParams, 2)
+		id := ctx.PathValue("id").OrDefault("")
+		oid := ctx.PathValue("oid").OrDefault("")
+		q := ctx.QueryValue("q").OrDefault("")
+		_ = ctx.StatusOK(id + "-" + oid + "-" + q)
+	})
+	s.Get("/static", func(ctx *Context) {
+		assert.Empty(t, ctx.PathParams)
+		_ = ctx.StatusOK("static")
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				n := strconv.Itoa(i*100 + j)
+				recorder := httptest.NewRecorder()
+				s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/"+n+"/order/o"+n+"?q=q"+n, nil))
+				assert.Equal(t, n+"-o"+n+"-q"+n, recorder.Body.String())
+
+				recorder = httptest.NewRecorder()
+				s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/static", nil))
+				assert.Equal(t, "static", recorder.Body.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// discardResponseWriter 基准测试用，避免 httptest.ResponseRecorder 的内存分配干扰结果
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d *discardResponseWriter) Header() http.Header {
+	return d.header
+}
+
+func (d *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (d *discardResponseWriter) WriteHeader(int) {}
+
+var benchResponse = []byte("ok")
+
+func BenchmarkHTTPServer_ServeHTTP(b *testing.B) {
+	s := NewHTTPServer("bench", "")
+	handler := func(ctx *Context) {
+		ctx.StatusCode = http.StatusOK
+		ctx.ResponseData = benchResponse
+	}
+	s.Get("/user/home", handler)
+	s.Get("/user/:id/order/:oid", handler)
+
+	benchmarks := []struct {
+		name string
+		path string
+	}{
+		{name: "static", path: "/user/home"},
+		{name: "params", path: "/user/123/order/456"},
+		{name: "not found", path: "/not/found"},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			req := httptest.NewRequest(http.MethodGet, bm.path, nil)
+			w := &discardResponseWriter{header: http.Header{}}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.ServeHTTP(w, req)
+			}
+		})
+	}
+}
+
+func Benchmark_router_find(b *testing.B) {
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/user/:id/order/:oid", func(ctx *Context) {})
+	b.ReportAllocs()
+	mi := &matchInfo{}
+	for i := 0; i < b.N; i++ {
+		r.find(http.MethodGet, "/user/123/order/456", mi)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log"
+
+	"github.com/gofaquan/go-http/middleware/session"
+)
+
+// Sessions 会话中间件，之后可以通过 ctx.Session 读写会话。
+// 同一个会话的并发请求会被串行化，所以 SSE、WebSocket 之类的长连接路由不要使用。
+// 新会话和更换了 ID 的会话需要写 cookie，handler 不要在这之前直接写响应
+func Sessions(m *session.Manager) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			sess, release := m.Start(ctx.Request)
+			defer release()
+			ctx.sess = sess
+			next(ctx)
+			// 响应已经提交的时候 cookie 写不回去了，但是 Store 里面的数据仍然要保存
+			if err := m.Save(ctx.Request.Context(), ctx.ResponseWriter, sess); err != nil {
+				log.Printf("web: 保存会话失败 %v", err)
+			}
+		}
+	}
+}
+
+// Session 当前请求的会话，没有使用 Sessions 中间件的时候 panic
+func (c *Context) Session() *session.Session {
+	if c.sess == nil {
+		panic("web: 没有使用 Sessions 中间件")
+	}
+	return c.sess
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofaquan/go-http/middleware/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *testing.T) {
+	m := session.NewManager(session.NewMemoryStore(0))
+	s := NewHTTPServer("test", "")
+	s.Post("/login", func(ctx *Context) {
+		sess := ctx.Session()
+		sess.Regenerate()
+		sess.Set("user", "tom")
+		_ = ctx.Redirect(http.StatusSeeOther, "/me")
+	}, Sessions(m))
+	s.Get("/me", func(ctx *Context) {
+		_ = ctx.StatusOK(ctx.Session().GetString("user"))
+	}, Sessions(m))
+	s.Get("/no-session", func(ctx *Context) {
+		assert.Panics(t, func() {
+			ctx.Session()
+		})
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/login", nil))
+	assert.Equal(t, http.StatusSeeOther, recorder.Code)
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(cookies[0])
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, "tom", recorder.Body.String())
+
+	// 没有 cookie 的时候是新会话
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/me", nil))
+	assert.Equal(t, "", recorder.Body.String())
+	assert.Empty(t, recorder.Result().Cookies())
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/no-session", nil))
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrStreamingUnsupported = errors.New("web: ResponseWriter 不支持 http.Flusher")
+	ErrSSEClosed            = errors.New("web: SSE 连接已关闭")
+)
+
+// SSEWriter Server-Sent Events 写入器
+// 规范见 https://html.spec.whatwg.org/multipage/server-sent-events.html
+type SSEWriter struct {
+	w           *StreamWriter
+	lastEventID string
+
+	// 保证并发写入（例如心跳和业务事件）不会交错
+	mu sync.Mutex
+
+	closeOnce sync.Once
+	closing   chan struct{}
+	done      chan struct{}
+}
+
+// SSE 把响应切换成 text/event-stream 并立刻发送响应头
+// 客户端断开或者服务器退出的时候 Done 会被关闭，handler 应该监听它并返回
+func (c *Context) SSE() (*SSEWriter, error) {
+	if !c.response().canFlush() {
+		return nil, ErrStreamingUnsupported
+	}
+	if c.Committed() {
+		return nil, errors.New("web: 响应已经提交，无法切换到 SSE")
+	}
+
+	sse := &SSEWriter{
+		lastEventID: c.Request.Header.Get("Last-Event-ID"),
+		closing:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if c.conns != nil && !c.conns.add(sse) {
+		return nil, ErrSSEClosed
+	}
+
+	header := c.ResponseWriter.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// 避免 nginx 之类的反向代理缓冲
+	header.Set("X-Accel-Buffering", "no")
+	c.StatusCode = http.StatusOK
+	sse.w = c.Writer()
+	sse.w.Flush()
+
+	// Context 会被复用，goroutine 里面不能引用 c
+	reqDone := c.Request.Context().Done()
+	go func() {
+		select {
+		case <-reqDone:
+		case <-sse.closing:
+		}
+		close(sse.done)
+	}()
+	c.addCleanup(func() {
+		sse.Close()
+		// 等待正在进行的写入（例如心跳）结束，handler 返回之后不能再写响应
+		sse.mu.Lock()
+		sse.mu.Unlock()
+		if c.conns != nil {
+			c.conns.remove(sse)
+		}
+	})
+	return sse, nil
+}
+
+// LastEventID 客户端重连时带上来的 Last-Event-ID，用于从断点继续推送
+func (s *SSEWriter) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done 客户端断开、服务器退出或者调用了 Close 的时候会被关闭
+func (s *SSEWriter) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send 发送一个事件，event 和 id 为空的时候不发送对应字段，data 里面的换行会被拆成多个 data 字段
+func (s *SSEWriter) Send(event, id, data string) error {
+	var sb strings.Builder
+	if id != "" {
+		sb.WriteString("id: ")
+		sb.WriteString(sanitizeSSEField(id))
+		sb.WriteByte('\n')
+	}
+	if event != "" {
+		sb.WriteString("event: ")
+		sb.WriteString(sanitizeSSEField(event))
+		sb.WriteByte('\n')
+	}
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		sb.WriteString("data: ")
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	sb.WriteByte('\n')
+	return s.write(sb.String())
+}
+
+// Retry 告诉客户端断线之后多久重连
+func (s *SSEWriter) Retry(d time.Duration) error {
+	return s.write("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n")
+}
+
+// Comment 发送注释行，客户端会忽略
+func (s *SSEWriter) Comment(text string) error {
+	return s.write(": " + sanitizeSSEField(text) + "\n\n")
+}
+
+// Heartbeat 发送心跳注释，防止中间代理因为空闲断开连接
+func (s *SSEWriter) Heartbeat() error {
+	return s.Comment("heartbeat")
+}
+
+// KeepAlive 每隔 interval 发送一次心跳，直到连接关闭
+func (s *SSEWriter) KeepAlive(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				if err := s.Heartbeat(); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Close 关闭事件流，handler 返回的时候也会自动关闭
+func (s *SSEWriter) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+	})
+}
+
+func (s *SSEWriter) shutdown() {
+	s.Close()
+}
+
+func (s *SSEWriter) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.closing:
+		return ErrSSEClosed
+	case <-s.done:
+		return ErrSSEClosed
+	default:
+	}
+	if _, err := s.w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return nil
+}
+
+// sanitizeSSEField 去掉换行，避免注入额外的字段
+func sanitizeSSEField(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
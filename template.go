@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoTemplateEngine = errors.New("web: 没有设置模板引擎")
+
+// TemplateEngine 模板引擎，name 是模板的名字，由具体的实现决定
+type TemplateEngine interface {
+	Render(ctx context.Context, name string, data any) ([]byte, error)
+}
+
+// WithTemplateEngine 设置模板引擎，之后可以使用 ctx.HTML 渲染页面
+func WithTemplateEngine(engine TemplateEngine) ServerOption {
+	return func(server *HTTPServer) {
+		server.templateEngine = engine
+	}
+}
+
+// HTML 使用模板引擎渲染页面
+func (c *Context) HTML(code int, name string, data any) error {
+	if c.templateEngine == nil {
+		return ErrNoTemplateEngine
+	}
+	reqCtx := context.Background()
+	if c.Request != nil {
+		reqCtx = c.Request.Context()
+	}
+	page, err := c.templateEngine.Render(reqCtx, name, data)
+	if err != nil {
+		return err
+	}
+	c.ResponseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.StatusCode = code
+	c.ResponseData = page
+	return nil
+}
+
+// GoTemplateEngine 基于 html/template 的模板引擎
+//
+// 每个页面单独解析成一个模板集合，集合里面包含所有的公共模板（布局、局部模板），
+// 所以不同页面可以定义同名的 block 而不冲突。页面通过文件名引用布局：
+//
+//	{{define "content"}}...{{end}}{{template "base.html" .}}
+//
+// 渲染时 name 是页面在 fs.FS 里面的路径，例如 pages/index.html
+type GoTemplateEngine struct {
+	fsys         fs.FS
+	pagePattern  string
+	sharedGlobs  []string
+	funcs        template.FuncMap
+	dev          bool
+	pages        map[string]*template.Template
+	filesVersion map[string]time.Time
+	mu           sync.RWMutex
+}
+
+type TemplateOption func(engine *GoTemplateEngine)
+
+// WithTemplateShared 布局、局部模板之类的公共模板，会被解析进每一个页面
+func WithTemplateShared(patterns ...string) TemplateOption {
+	return func(engine *GoTemplateEngine) {
+		engine.sharedGlobs = append(engine.sharedGlobs, patterns...)
+	}
+}
+
+// WithTemplateFuncs 自定义函数，同名的时候覆盖默认的函数
+func WithTemplateFuncs(funcs template.FuncMap) TemplateOption {
+	return func(engine *GoTemplateEngine) {
+		for name, fn := range funcs {
+			engine.funcs[name] = fn
+		}
+	}
+}
+
+// WithTemplateDevMode 开发模式，每次渲染之前检查文件有没有变化，有变化就重新解析
+func WithTemplateDevMode(dev bool) TemplateOption {
+	return func(engine *GoTemplateEngine) {
+		engine.dev = dev
+	}
+}
+
+// NewGoTemplateEngine 从 fsys 里面加载 pagePattern 匹配的页面，pagePattern 使用 fs.Glob 的语法
+func NewGoTemplateEngine(fsys fs.FS, pagePattern string, opts ...TemplateOption) (*GoTemplateEngine, error) {
+	engine := &GoTemplateEngine{
+		fsys:        fsys,
+		pagePattern: pagePattern,
+		funcs: template.FuncMap{
+			"URLFor": URLFor,
+		},
+	}
+	for _, opt := range opts {
+		opt(engine)
+	}
+	if err := engine.load(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+func (g *GoTemplateEngine) Render(ctx context.Context, name string, data any) ([]byte, error) {
+	if g.dev {
+		if err := g.reloadIfChanged(); err != nil {
+			return nil, err
+		}
+	}
+	g.mu.RLock()
+	tpl, ok := g.pages[name]
+	g.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("web: 找不到模板 %s", name)
+	}
+	buf := &bytes.Buffer{}
+	if err := tpl.ExecuteTemplate(buf, path.Base(name), data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// load 重新解析所有的模板，解析失败的时候保留原来的模板
+func (g *GoTemplateEngine) load() error {
+	pageFiles, sharedFiles, err := g.files()
+	if err != nil {
+		return err
+	}
+	if len(pageFiles) == 0 {
+		return fmt.Errorf("web: %s 没有匹配任何模板", g.pagePattern)
+	}
+
+	pages := make(map[string]*template.Template, len(pageFiles))
+	for _, page := range pageFiles {
+		tpl := template.New(path.Base(page)).Funcs(g.funcs)
+		if len(sharedFiles) > 0 {
+			if tpl, err = tpl.ParseFS(g.fsys, sharedFiles...); err != nil {
+				return err
+			}
+		}
+		// 页面最后解析，这样页面里面的 define 可以覆盖布局里面 block 的默认内容
+		if tpl, err = tpl.ParseFS(g.fsys, page); err != nil {
+			return err
+		}
+		pages[page] = tpl
+	}
+
+	version, err := g.version(append(pageFiles, sharedFiles...))
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.pages = pages
+	g.filesVersion = version
+	g.mu.Unlock()
+	return nil
+}
+
+func (g *GoTemplateEngine) reloadIfChanged() error {
+	pageFiles, sharedFiles, err := g.files()
+	if err != nil {
+		return err
+	}
+	version, err := g.version(append(pageFiles, sharedFiles...))
+	if err != nil {
+		return err
+	}
+	g.mu.RLock()
+	changed := !sameVersion(version, g.filesVersion)
+	g.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+	return g.load()
+}
+
+// files 页面和公共模板的路径，同一个文件既是页面又是公共模板的时候只当作页面
+func (g *GoTemplateEngine) files() ([]string, []string, error) {
+	pageFiles, err := fs.Glob(g.fsys, g.pagePattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	isPage := make(map[string]bool, len(pageFiles))
+	for _, p := range pageFiles {
+		isPage[p] = true
+	}
+	var sharedFiles []string
+	for _, pattern := range g.sharedGlobs {
+		matches, err := fs.Glob(g.fsys, pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, m := range matches {
+			if !isPage[m] {
+				sharedFiles = append(sharedFiles, m)
+			}
+		}
+	}
+	sort.Strings(sharedFiles)
+	return pageFiles, sharedFiles, nil
+}
+
+func (g *GoTemplateEngine) version(files []string) (map[string]time.Time, error) {
+	res := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		info, err := fs.Stat(g.fsys, f)
+		if err != nil {
+			return nil, err
+		}
+		res[f] = info.ModTime()
+	}
+	return res, nil
+}
+
+func sameVersion(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for f, t := range a {
+		if old, ok := b[f]; !ok || !old.Equal(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// URLFor 根据路由生成 URL，kv 是成对的参数名和参数值，
+// 路由里面没有的参数会被放到查询参数里面
+//
+//	URLFor("/user/:id", "id", 12, "tab", "posts") => /user/12?tab=posts
+func URLFor(route string, kv ...any) (string, error) {
+	if len(kv)%2 != 0 {
+		return "", fmt.Errorf("web: URLFor 的参数必须成对出现 %s", route)
+	}
+	params := make(map[string]string, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			return "", fmt.Errorf("web: URLFor 的参数名必须是字符串 %v", kv[i])
+		}
+		params[key] = fmt.Sprint(kv[i+1])
+	}
+
+	segs := strings.Split(route, "/")
+	for i, seg := range segs {
+		var key string
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			key = seg[1:]
+		case seg == "*":
+			key = "*"
+		default:
+			continue
+		}
+		val, ok := params[key]
+		if !ok {
+			return "", fmt.Errorf("web: URLFor 缺少路径参数 %s, 路由 %s", key, route)
+		}
+		segs[i] = url.PathEscape(val)
+		delete(params, key)
+	}
+
+	res := strings.Join(segs, "/")
+	if len(params) == 0 {
+		return res, nil
+	}
+	query := make(url.Values, len(params))
+	for key, val := range params {
+		query.Set(key, val)
+	}
+	return res + "?" + query.Encode(), nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoTemplateEngine(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html":  {Data: []byte(`<title>{{block "title" .}}默认{{end}}</title><main>{{template "content" .}}</main>`)},
+		"partials/user.html": {Data: []byte(`{{define "user"}}<a href="{{URLFor "/user/:id" "id" .ID}}">{{upper .Name}}</a>{{end}}`)},
+		"pages/index.html":   {Data: []byte(`{{define "content"}}{{template "user" .}}{{end}}{{template "base.html" .}}`)},
+		"pages/about.html":   {Data: []byte(`{{define "title"}}关于{{end}}{{define "content"}}{{.Name}}{{end}}{{template "base.html" .}}`)},
+	}
+	engine, err := NewGoTemplateEngine(fsys, "pages/*.html",
+		WithTemplateShared("layouts/*.html", "partials/*.html"),
+		WithTemplateFuncs(template.FuncMap{"upper": strings.ToUpper}))
+	require.NoError(t, err)
+
+	data := struct {
+		ID   int
+		Name string
+	}{ID: 12, Name: "<tom>"}
+	page, err := engine.Render(context.Background(), "pages/index.html", data)
+	require.NoError(t, err)
+	assert.Equal(t, `<title>默认</title><main><a href="/user/12">&lt;TOM&gt;</a></main>`, string(page))
+
+	// 不同页面的 block 互不影响
+	page, err = engine.Render(context.Background(), "pages/about.html", data)
+	require.NoError(t, err)
+	assert.Equal(t, `<title>关于</title><main>&lt;tom&gt;</main>`, string(page))
+
+	_, err = engine.Render(context.Background(), "pages/missing.html", data)
+	assert.Error(t, err)
+
+	_, err = NewGoTemplateEngine(fsys, "views/*.html")
+	assert.Error(t, err)
+}
+
+func TestGoTemplateEngine_DevMode(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hello.html")
+	require.NoError(t, os.WriteFile(path, []byte(`hello {{.}}`), 0o644))
+
+	engine, err := NewGoTemplateEngine(os.DirFS(dir), "*.html", WithTemplateDevMode(true))
+	require.NoError(t, err)
+	page, err := engine.Render(context.Background(), "hello.html", "tom")
+	require.NoError(t, err)
+	assert.Equal(t, "hello tom", string(page))
+
+	require.NoError(t, os.WriteFile(path, []byte(`hi {{.}}`), 0o644))
+	// 有些文件系统的修改时间精度不够，手动改一下
+	modtime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, modtime, modtime))
+	page, err = engine.Render(context.Background(), "hello.html", "tom")
+	require.NoError(t, err)
+	assert.Equal(t, "hi tom", string(page))
+}
+
+func TestContext_HTML(t *testing.T) {
+	engine, err := NewGoTemplateEngine(fstest.MapFS{
+		"index.html": {Data: []byte(`<p>{{.}}</p>`)},
+	}, "*.html")
+	require.NoError(t, err)
+
+	s := NewHTTPServer("test", "", WithTemplateEngine(engine))
+	s.Get("/", func(ctx *Context) {
+		require.NoError(t, ctx.HTML(http.StatusOK, "index.html", "hello"))
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "<p>hello</p>", recorder.Body.String())
+	assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+
+	ctx := &Context{ResponseWriter: httptest.NewRecorder()}
+	assert.Equal(t, ErrNoTemplateEngine, ctx.HTML(http.StatusOK, "index.html", nil))
+}
+
+func TestURLFor(t *testing.T) {
+	testCases := []struct {
+		name    string
+		route   string
+		kv      []any
+		want    string
+		wantErr bool
+	}{
+		{name: "static", route: "/user/home", want: "/user/home"},
+		{name: "param", route: "/user/:id/posts/:pid", kv: []any{"id", 12, "pid", "a b"}, want: "/user/12/posts/a%20b"},
+		{name: "query", route: "/user/:id", kv: []any{"id", 12, "tab", "posts"}, want: "/user/12?tab=posts"},
+		{name: "wildcard", route: "/static/*", kv: []any{"*", "app.js"}, want: "/static/app.js"},
+		{name: "missing param", route: "/user/:id", wantErr: true},
+		{name: "odd kv", route: "/user/:id", kv: []any{"id"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := URLFor(tc.route, tc.kv...)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res)
+		})
+	}
+}
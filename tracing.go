@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gofaquan/go-http/middleware/tracing"
+)
+
+type tracingConfig struct {
+	propagate bool
+}
+
+type TracingOption func(cfg *tracingConfig)
+
+// WithTracingPropagation 是否接受上游的 traceparent，默认接受。
+// 直接面对公网的服务可以关掉，避免客户端决定采样
+func WithTracingPropagation(propagate bool) TracingOption {
+	return func(cfg *tracingConfig) {
+		cfg.propagate = propagate
+	}
+}
+
+// Tracing 为每个请求创建一个 server span，名字是请求方法加上 ctx.MatchedRoute，找不到路由的时候只有请求方法。
+// span 会放进请求的 context.Context，调用下游服务的时候使用 tracing.Transport 或者 tracing.Inject 传递下去。
+// 一般通过 HTTPServer.Use 注册在最外层，这样能够统计到其它中间件的耗时
+func Tracing(tracer tracing.Tracer, opts ...TracingOption) Middleware {
+	cfg := &tracingConfig{propagate: true}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			r := ctx.Request
+			reqCtx := r.Context()
+			if cfg.propagate {
+				reqCtx = tracing.Extract(reqCtx, r.Header)
+			}
+			name := r.Method
+			if ctx.MatchedRoute != "" {
+				name += " " + ctx.MatchedRoute
+			}
+			reqCtx, span := tracer.Start(reqCtx, name,
+				tracing.WithSpanKind(tracing.SpanKindServer),
+				tracing.WithAttributes(
+					tracing.Attr("http.request.method", r.Method),
+					tracing.Attr("url.path", r.URL.Path),
+					tracing.Attr("http.route", ctx.MatchedRoute),
+				))
+			defer span.End()
+			ctx.Request = r.WithContext(reqCtx)
+			ctx.tracer = tracer
+			ctx.span = span
+
+			next(ctx)
+
+			if !span.IsRecording() {
+				return
+			}
+			status := ctx.responseStatus()
+			span.SetAttributes(
+				tracing.Attr("http.response.status_code", status),
+				tracing.Attr("client.address", ctx.ClientIP()),
+				tracing.Attr("user_agent.original", r.UserAgent()),
+			)
+			if ctx.requestID != "" {
+				span.SetAttributes(tracing.Attr("http.request.id", ctx.requestID))
+			}
+			// server span 只有 5xx 算失败，4xx 是客户端的问题
+			if status >= 500 {
+				span.SetStatus(tracing.StatusError, http.StatusText(status))
+			}
+		}
+	}
+}
+
+// TraceLayer 让中间件 m 运行在一个单独的子 span 里面，span 覆盖 m 以及它里面的所有处理。
+// 没有使用 Tracing 中间件的时候直接执行 m
+//
+//	s.Use(Tracing(tracer), TraceLayer("auth", Auth(...)))
+func TraceLayer(name string, m Middleware) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		h := m(next)
+		return func(ctx *Context) {
+			if ctx.tracer == nil {
+				h(ctx)
+				return
+			}
+			reqCtx, span := ctx.tracer.Start(ctx.Request.Context(), name)
+			parent, parentReq := ctx.span, ctx.Request
+			ctx.Request = ctx.Request.WithContext(reqCtx)
+			ctx.span = span
+			defer func() {
+				// 外层的中间件看到的仍然是它们自己的 span
+				ctx.span, ctx.Request = parent, parentReq
+				span.End()
+			}()
+			h(ctx)
+		}
+	}
+}
+
+// Span 当前请求的 span，没有使用 Tracing 中间件的时候返回一个什么也不做的 span
+func (c *Context) Span() tracing.Span {
+	if c.span != nil {
+		return c.span
+	}
+	if c.Request != nil {
+		return tracing.SpanFromContext(c.Request.Context())
+	}
+	return tracing.SpanFromContext(context.Background())
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gofaquan/go-http/middleware/tracing"
+)
+
+type memorySpanExporter struct {
+	mu    sync.Mutex
+	spans []*tracing.SpanData
+}
+
+func (m *memorySpanExporter) ExportSpans(ctx context.Context, spans []*tracing.SpanData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = append(m.spans, spans...)
+	return nil
+}
+
+func (m *memorySpanExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func spanAttr(span *tracing.SpanData, key string) any {
+	for _, a := range span.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	exporter := &memorySpanExporter{}
+	tracer := tracing.NewTracer("test", exporter)
+	s := NewHTTPServer("test", "")
+	var afterLayer, afterLayerReq tracing.SpanContext
+	s.Use(Tracing(tracer), RequestID(), func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			if ctx.MatchedRoute != "/user/:id" {
+				return
+			}
+			afterLayer = ctx.Span().SpanContext()
+			afterLayerReq = tracing.SpanFromContext(ctx.Request.Context()).SpanContext()
+		}
+	}, TraceLayer("auth", func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.Span().AddEvent("checked")
+			next(ctx)
+		}
+	}))
+
+	var handlerSpan tracing.SpanContext
+	s.Get("/user/:id", func(ctx *Context) {
+		handlerSpan = ctx.Span().SpanContext()
+		// 下游收到的父 span 是 handler 所在的 span
+		header := http.Header{}
+		tracing.Inject(ctx.Request.Context(), header)
+		_ = ctx.StatusOK(header.Get(tracing.HeaderTraceparent))
+	})
+	s.Get("/panic", func(ctx *Context) {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/user/12", nil)
+	req.Header.Set(tracing.HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, tracing.Traceparent(handlerSpan), recorder.Body.String())
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	require.Len(t, exporter.spans, 6)
+	layer, server := exporter.spans[0], exporter.spans[1]
+	assert.Equal(t, "auth", layer.Name)
+	assert.Equal(t, handlerSpan.SpanID, layer.SpanContext.SpanID)
+	assert.Equal(t, server.SpanContext.SpanID, layer.ParentSpanID)
+	require.Len(t, layer.Events, 1)
+	// TraceLayer 返回之后恢复外层的 span 和请求
+	assert.Equal(t, server.SpanContext.SpanID, afterLayer.SpanID)
+	assert.Equal(t, server.SpanContext.SpanID, afterLayerReq.SpanID)
+
+	assert.Equal(t, "GET /user/:id", server.Name)
+	assert.Equal(t, tracing.SpanKindServer, server.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", server.ParentSpanID.String())
+	assert.Equal(t, "/user/:id", spanAttr(server, "http.route"))
+	assert.Equal(t, http.StatusOK, spanAttr(server, "http.response.status_code"))
+	assert.NotEmpty(t, spanAttr(server, "http.request.id"))
+	assert.Equal(t, tracing.StatusUnset, server.Status.Code)
+
+	panicSpan := exporter.spans[3]
+	assert.Equal(t, "GET /panic", panicSpan.Name)
+	assert.Equal(t, http.StatusInternalServerError, spanAttr(panicSpan, "http.response.status_code"))
+	assert.Equal(t, tracing.StatusError, panicSpan.Status.Code)
+	assert.Equal(t, "GET", exporter.spans[5].Name)
+}
+
+func TestContext_Span_NoTracing(t *testing.T) {
+	ctx := &Context{}
+	span := ctx.Span()
+	assert.False(t, span.IsRecording())
+	span.End()
+
+	s := NewHTTPServer("test", "")
+	s.Use(TraceLayer("noop", func(next HandleFunc) HandleFunc {
+		return next
+	}))
+	s.Get("/", func(ctx *Context) {
+		_ = ctx.StatusOK("ok")
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "ok", recorder.Body.String())
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+)
+
+const (
+	// defaultMultipartMemory 和 net/http 保持一致，超过的部分会写到临时文件
+	defaultMultipartMemory int64 = 32 << 20
+	// sniffLen http.DetectContentType 最多只看前 512 字节
+	sniffLen = 512
+	// partHeaderAllowance 统计每一部分大小的时候给 Content-Disposition 之类的头部留出的余量
+	partHeaderAllowance = 10 << 10
+)
+
+var ErrFileTooLarge = errors.New("web: 上传文件超过大小限制")
+
+// uploadLimits 上传限制，maxFileSize <= 0 表示不限制单个文件大小
+type uploadLimits struct {
+	maxMemory   int64
+	maxFileSize int64
+}
+
+// WithUploadLimits 服务器级别的上传限制，路由上可以用 UploadLimits 覆盖
+func WithUploadLimits(maxMemory, maxFileSize int64) ServerOption {
+	return func(server *HTTPServer) {
+		server.uploadLimits = uploadLimits{maxMemory: maxMemory, maxFileSize: maxFileSize}
+	}
+}
+
+// UploadLimits 路由级别的上传限制
+// maxMemory 是解析 multipart 表单时放在内存里面的上限，maxFileSize 是单个文件的上限
+func UploadLimits(maxMemory, maxFileSize int64) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.uploadLimits = uploadLimits{maxMemory: maxMemory, maxFileSize: maxFileSize}
+			next(ctx)
+		}
+	}
+}
+
+// parseForm 只解析一次表单，multipart 产生的临时文件在请求结束之后删除
+func (c *Context) parseForm() error {
+	if c.formParsed {
+		return c.formErr
+	}
+	c.formParsed = true
+	c.formErr = c.doParseForm()
+	return c.formErr
+}
+
+func (c *Context) doParseForm() error {
+	maxMemory := c.uploadLimits.maxMemory
+	if maxMemory <= 0 {
+		maxMemory = defaultMultipartMemory
+	}
+	// ParseMultipartForm 会吞掉 ParseForm 的错误，所以先单独调用一次
+	if err := c.checkBodyErr(c.Request.ParseForm()); err != nil {
+		return err
+	}
+	if maxFileSize := c.uploadLimits.maxFileSize; maxFileSize > 0 {
+		c.limitMultipartParts(maxFileSize)
+	}
+	err := c.checkBodyErr(c.Request.ParseMultipartForm(maxMemory))
+	if errors.Is(err, ErrFileTooLarge) {
+		_ = c.ResponseWithString(http.StatusRequestEntityTooLarge, "413 REQUEST ENTITY TOO LARGE")
+		err = ErrFileTooLarge
+	}
+	if c.Request.MultipartForm != nil {
+		form := c.Request.MultipartForm
+		c.addCleanup(func() {
+			_ = form.RemoveAll()
+		})
+	}
+	if err == http.ErrNotMultipart {
+		// 普通表单，前面已经解析过了
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// 读取的时候只能按照每一部分的原始字节数粗略地限制，这里再按照文件的实际大小检查一次
+	if maxFileSize := c.uploadLimits.maxFileSize; maxFileSize > 0 {
+		for _, fhs := range c.Request.MultipartForm.File {
+			for _, fh := range fhs {
+				if fh.Size > maxFileSize {
+					_ = c.ResponseWithString(http.StatusRequestEntityTooLarge, "413 REQUEST ENTITY TOO LARGE")
+					return ErrFileTooLarge
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// limitMultipartParts ParseMultipartForm 会先把整个文件写到内存或者临时文件里面，
+// 所以在请求体上统计每一部分的字节数，超过限制的时候立刻返回 ErrFileTooLarge，不再继续读取
+func (c *Context) limitMultipartParts(maxFileSize int64) {
+	mediaType, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" || c.Request.Body == nil {
+		return
+	}
+	c.Request.Body = &partLimitReader{
+		ReadCloser: c.Request.Body,
+		delim:      []byte("\r\n--" + params["boundary"]),
+		max:        maxFileSize + partHeaderAllowance,
+	}
+}
+
+// partLimitReader 在 multipart 的原始数据上查找分隔符，限制两个分隔符之间的字节数
+type partLimitReader struct {
+	io.ReadCloser
+	delim []byte
+	max   int64
+	// read 上一个分隔符之后读到的字节数
+	read int64
+	// buf 上次读取的最后 len(delim)-1 个字节加上这次读到的数据，分隔符可能被拆在两次读取里面
+	buf []byte
+}
+
+func (l *partLimitReader) Read(p []byte) (int, error) {
+	n, err := l.ReadCloser.Read(p)
+	if n == 0 {
+		return n, err
+	}
+	tail := len(l.buf)
+	l.buf = append(l.buf, p[:n]...)
+	if idx := bytes.LastIndex(l.buf, l.delim); idx >= 0 {
+		l.read = int64(len(l.buf) - idx - len(l.delim))
+		l.buf = l.buf[idx+len(l.delim):]
+	} else {
+		l.read += int64(len(l.buf) - tail)
+	}
+	if l.read > l.max {
+		return n, ErrFileTooLarge
+	}
+	if keep := len(l.delim) - 1; len(l.buf) > keep {
+		l.buf = append(l.buf[:0], l.buf[len(l.buf)-keep:]...)
+	}
+	return n, err
+}
+
+// UploadedFile 解析 multipart 表单之后得到的文件
+type UploadedFile struct {
+	*multipart.FileHeader
+	// ContentType 根据文件内容嗅探出来的类型，客户端声明的类型在 Header 里面
+	ContentType string
+}
+
+// FormFile 获取上传的文件，超过文件大小限制的时候返回 ErrFileTooLarge 并设置 413 响应
+func (c *Context) FormFile(name string) (*UploadedFile, error) {
+	if err := c.parseForm(); err != nil {
+		return nil, err
+	}
+	if c.Request.MultipartForm == nil || len(c.Request.MultipartForm.File[name]) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	fh := c.Request.MultipartForm.File[name][0]
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return &UploadedFile{FileHeader: fh, ContentType: http.DetectContentType(buf[:n])}, nil
+}
+
+// SaveTo 把文件保存到 dst
+func (f *UploadedFile) SaveTo(dst string) (int64, error) {
+	src, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	return saveTo(dst, src)
+}
+
+// MultipartReader 流式读取 multipart 请求，适合大文件上传，数据不会被缓冲在内存或者临时文件里面
+// 和 FormValue、FormFile 互斥，二者只能使用其中之一
+func (c *Context) MultipartReader() (*MultipartReader, error) {
+	r, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	return &MultipartReader{r: r, ctx: c}, nil
+}
+
+// MultipartReader 包装了 multipart.Reader，每个文件都受到大小限制
+type MultipartReader struct {
+	r   *multipart.Reader
+	ctx *Context
+}
+
+// NextPart 读取下一个部分，没有了返回 io.EOF
+func (m *MultipartReader) NextPart() (*FilePart, error) {
+	p, err := m.r.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	part := &FilePart{Part: p, ctx: m.ctx}
+	br := bufio.NewReaderSize(p, sniffLen)
+	if p.FileName() != "" {
+		head, _ := br.Peek(sniffLen)
+		part.ContentType = http.DetectContentType(head)
+	}
+	part.r = &sizeLimitReader{r: br, max: m.ctx.uploadLimits.maxFileSize}
+	return part, nil
+}
+
+// FilePart multipart 里面的一部分，读取超过文件大小限制的时候返回 ErrFileTooLarge
+type FilePart struct {
+	*multipart.Part
+	// ContentType 文件部分根据内容嗅探出来的类型，普通字段为空
+	ContentType string
+
+	r   io.Reader
+	ctx *Context
+}
+
+func (p *FilePart) Read(b []byte) (int, error) {
+	return p.r.Read(b)
+}
+
+// IsFile 是否是文件，普通的表单字段返回 false
+func (p *FilePart) IsFile() bool {
+	return p.FileName() != ""
+}
+
+// SaveTo 把这部分数据保存到 dst，超过大小限制的时候会删除已经写入的文件
+func (p *FilePart) SaveTo(dst string) (int64, error) {
+	n, err := saveTo(dst, p)
+	if err != nil {
+		_ = os.Remove(dst)
+	}
+	return n, err
+}
+
+// SaveTemp 保存到临时文件，返回文件路径，handler 返回之后临时文件会被自动删除
+func (p *FilePart) SaveTemp(dir, pattern string) (string, int64, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", 0, err
+	}
+	name := f.Name()
+	p.ctx.addCleanup(func() {
+		_ = os.Remove(name)
+	})
+	n, err := io.Copy(f, p)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return name, n, err
+}
+
+func saveTo(dst string, src io.Reader) (int64, error) {
+	f, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, src)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+// sizeLimitReader 读取超过 max 字节的时候返回 ErrFileTooLarge，max <= 0 表示不限制
+type sizeLimitReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if l.max <= 0 {
+		return l.r.Read(p)
+	}
+	if l.read >= l.max {
+		// 已经读满了，再探测一个字节看看是不是还有数据
+		var b [1]byte
+		n, err := l.r.Read(b[:])
+		if n > 0 {
+			return 0, ErrFileTooLarge
+		}
+		return 0, err
+	}
+	if remain := l.max - l.read; int64(len(p)) > remain {
+		p = p[:remain]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	return n, err
+}
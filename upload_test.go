@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+func newMultipartRequest(t *testing.T, fields map[string]string, files map[string][]byte) *http.Request {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for k, v := range fields {
+		require.NoError(t, w.WriteField(k, v))
+	}
+	for name, content := range files {
+		fw, err := w.CreateFormFile(name, name+".bin")
+		require.NoError(t, err)
+		_, err = fw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestContext_FormFile(t *testing.T) {
+	dir := t.TempDir()
+	s := NewHTTPServer("test", "")
+	s.Post("/upload", func(ctx *Context) {
+		f, err := ctx.FormFile("avatar")
+		if err != nil {
+			// 多次调用不会重复解析，错误也是一样的
+			_, err2 := ctx.FormValue("title").String()
+			assert.Equal(t, err, err2)
+			return
+		}
+		title, err := ctx.FormValue("title").String()
+		require.NoError(t, err)
+		assert.Equal(t, "avatar.bin", f.Filename)
+		assert.Equal(t, "image/png", f.ContentType)
+		n, err := f.SaveTo(filepath.Join(dir, "avatar.png"))
+		require.NoError(t, err)
+		_ = ctx.StatusOK(title + ":" + strconv.FormatInt(n, 10))
+	}, UploadLimits(4, 16))
+
+	content := append(append([]byte{}, pngHeader...), 1)
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, newMultipartRequest(t, map[string]string{"title": "me"}, map[string][]byte{"avatar": content}))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "me:9", recorder.Body.String())
+	saved, err := os.ReadFile(filepath.Join(dir, "avatar.png"))
+	require.NoError(t, err)
+	assert.Equal(t, content, saved)
+
+	// 超过单个文件大小限制
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, newMultipartRequest(t, nil, map[string][]byte{"avatar": make([]byte, 17)}))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	// 很大的文件读到超过限制就停下来，不会整个写到临时文件里面
+	req := newMultipartRequest(t, nil, map[string][]byte{"avatar": make([]byte, 8<<20)})
+	body := &countingReader{r: req.Body}
+	req.Body = io.NopCloser(body)
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	assert.Less(t, body.n, int64(1<<20))
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func Test_partLimitReader(t *testing.T) {
+	// 分隔符被拆在两次读取里面的时候也能识别出来，可能是分隔符的字节先算在当前部分里面
+	data := "aaaa\r\n--xyz" + "bbbbbb" + "\r\n--xyz" + strings.Repeat("c", 13)
+	r := &partLimitReader{ReadCloser: io.NopCloser(iotest.OneByteReader(strings.NewReader(data))),
+		delim: []byte("\r\n--xyz"), max: 12}
+	n, err := io.Copy(io.Discard, r)
+	assert.Equal(t, ErrFileTooLarge, err)
+	assert.Equal(t, int64(len(data)), n)
+
+	r = &partLimitReader{ReadCloser: io.NopCloser(iotest.HalfReader(strings.NewReader(data[:len(data)-1]))),
+		delim: []byte("\r\n--xyz"), max: 12}
+	_, err = io.Copy(io.Discard, r)
+	assert.NoError(t, err)
+}
+
+func TestContext_FormValue_URLEncoded(t *testing.T) {
+	s := NewHTTPServer("test", "")
+	s.Post("/form", func(ctx *Context) {
+		val, err := ctx.FormValue("val").ToInt64()
+		require.NoError(t, err)
+		_, err = ctx.FormFile("file")
+		assert.Equal(t, http.ErrMissingFile, err)
+		_ = ctx.StatusOK(ctx.FormValue("val").val)
+		assert.Equal(t, int64(12), val)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader("val=12"))
+	req.Header.Set("Content-Type", MediaTypeForm)
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, "12", recorder.Body.String())
+}
+
+func TestContext_MultipartReader(t *testing.T) {
+	var tmpPath string
+	s := NewHTTPServer("test", "", WithUploadLimits(defaultMultipartMemory, 32))
+	s.Post("/upload", func(ctx *Context) {
+		mr, err := ctx.MultipartReader()
+		require.NoError(t, err)
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			if !part.IsFile() {
+				continue
+			}
+			path, n, err := part.SaveTemp("", "upload-*")
+			tmpPath = path
+			if errors.Is(err, ErrFileTooLarge) {
+				_ = ctx.ResponseWithString(http.StatusRequestEntityTooLarge, part.FormName())
+				return
+			}
+			require.NoError(t, err)
+			_, statErr := os.Stat(path)
+			assert.NoError(t, statErr)
+			_ = ctx.StatusOK(part.ContentType + ":" + strconv.FormatInt(n, 10))
+		}
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, newMultipartRequest(t, map[string]string{"a": "b"}, map[string][]byte{"doc": []byte("%PDF-")}))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/pdf:5", recorder.Body.String())
+	// handler 返回之后临时文件被删除
+	_, err := os.Stat(tmpPath)
+	assert.True(t, os.IsNotExist(err))
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, newMultipartRequest(t, nil, map[string][]byte{"big": make([]byte, 33)}))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	assert.Equal(t, "big", recorder.Body.String())
+	_, err = os.Stat(tmpPath)
+	assert.True(t, os.IsNotExist(err))
+}
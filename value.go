@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrKeyNotFound = errors.New("找不到对应 key")
+
+// StringVal 从请求里面取出来的单个值，转换出错或者找不到 key 的时候带着错误
+type StringVal struct {
+	key string
+	val string
+	err error
+}
+
+// Key 取值时使用的 key
+func (s StringVal) Key() string {
+	return s.key
+}
+
+func (s StringVal) Err() error {
+	return s.err
+}
+
+func (s StringVal) String() (string, error) {
+	return s.val, s.err
+}
+func (s StringVal) ToInt64() (int64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return strconv.ParseInt(s.val, 10, 64)
+}
+func (s StringVal) ToUInt64() (uint64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return strconv.ParseUint(s.val, 10, 64)
+}
+func (s StringVal) ToInt() (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return strconv.Atoi(s.val)
+}
+func (s StringVal) ToBool() (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+	return strconv.ParseBool(s.val)
+}
+func (s StringVal) ToFloat64() (float64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return strconv.ParseFloat(s.val, 64)
+}
+
+// ToDuration 使用 time.ParseDuration 的格式，例如 1h30m
+func (s StringVal) ToDuration() (time.Duration, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return time.ParseDuration(s.val)
+}
+
+// ToTime 按照 layout 解析时间，例如 time.RFC3339
+func (s StringVal) ToTime(layout string) (time.Time, error) {
+	if s.err != nil {
+		return time.Time{}, s.err
+	}
+	return time.Parse(layout, s.val)
+}
+
+// OrDefault 出错或者值为空的时候返回 def
+func (s StringVal) OrDefault(def string) string {
+	if s.err != nil || s.val == "" {
+		return def
+	}
+	return s.val
+}
+
+// Must 出错的时候 panic，只应该用在前面的中间件已经校验过的场景
+func (s StringVal) Must() string {
+	if s.err != nil {
+		panic(&ValueError{Key: s.key, Err: s.err})
+	}
+	return s.val
+}
+
+// StringsVal 同一个 key 的多个值
+type StringsVal struct {
+	key  string
+	vals []string
+	err  error
+}
+
+func (s StringsVal) Key() string {
+	return s.key
+}
+
+func (s StringsVal) Strings() ([]string, error) {
+	return s.vals, s.err
+}
+
+func (s StringsVal) ToInts() ([]int, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	res := make([]int, 0, len(s.vals))
+	for _, v := range s.vals {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+func (s StringsVal) ToInt64s() ([]int64, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	res := make([]int64, 0, len(s.vals))
+	for _, v := range s.vals {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+// ValueError 某个 key 取值或者转换失败
+type ValueError struct {
+	Key string
+	Err error
+}
+
+func (e *ValueError) Error() string {
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e *ValueError) Unwrap() error {
+	return e.Err
+}
+
+// ValueErrors 多个 key 的错误
+type ValueErrors []*ValueError
+
+func (es ValueErrors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Fields 出错的 key
+func (es ValueErrors) Fields() []string {
+	res := make([]string, 0, len(es))
+	for _, e := range es {
+		res = append(res, e.Key)
+	}
+	return res
+}
+
+// ValueCollector 依次取出多个值，最后统一检查错误，出错的值返回零值
+//
+//	vc := ctx.Collector()
+//	id := vc.Int64(ctx.PathValue("id"))
+//	page := vc.Int(ctx.QueryValue("page"))
+//	if err := vc.Err(); err != nil { ... }
+type ValueCollector struct {
+	errs ValueErrors
+}
+
+// Collector 创建一个 ValueCollector
+func (c *Context) Collector() *ValueCollector {
+	return &ValueCollector{}
+}
+
+// Err 没有错误的时候返回 nil，否则返回 ValueErrors
+func (vc *ValueCollector) Err() error {
+	if len(vc.errs) == 0 {
+		return nil
+	}
+	return vc.errs
+}
+
+func (vc *ValueCollector) add(key string, err error) {
+	if err != nil {
+		vc.errs = append(vc.errs, &ValueError{Key: key, Err: err})
+	}
+}
+
+func (vc *ValueCollector) String(v StringVal) string {
+	res, err := v.String()
+	vc.add(v.key, err)
+	return res
+}
+
+func (vc *ValueCollector) Int(v StringVal) int {
+	res, err := v.ToInt()
+	vc.add(v.key, err)
+	return res
+}
+
+func (vc *ValueCollector) Int64(v StringVal) int64 {
+	res, err := v.ToInt64()
+	vc.add(v.key, err)
+	return res
+}
+
+func (vc *ValueCollector) UInt64(v StringVal) uint64 {
+	res, err := v.ToUInt64()
+	vc.add(v.key, err)
+	return res
+}
+
+func (vc *ValueCollector) Bool(v StringVal) bool {
+	res, err := v.ToBool()
+	vc.add(v.key, err)
+	return res
+}
+
+func (vc *ValueCollector) Float64(v StringVal) float64 {
+	res, err := v.ToFloat64()
+	vc.add(v.key, err)
+	return res
+}
+
+func (vc *ValueCollector) Duration(v StringVal) time.Duration {
+	res, err := v.ToDuration()
+	vc.add(v.key, err)
+	return res
+}
+
+func (vc *ValueCollector) Time(v StringVal, layout string) time.Time {
+	res, err := v.ToTime(layout)
+	vc.add(v.key, err)
+	return res
+}
+
+func (vc *ValueCollector) Strings(v StringsVal) []string {
+	res, err := v.Strings()
+	vc.add(v.key, err)
+	return res
+}
+
+func (vc *ValueCollector) Ints(v StringsVal) []int {
+	res, err := v.ToInts()
+	vc.add(v.key, err)
+	return res
+}
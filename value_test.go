@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStringVal_Conversions(t *testing.T) {
+	i, err := StringVal{val: "-12"}.ToInt()
+	require.NoError(t, err)
+	assert.Equal(t, -12, i)
+
+	b, err := StringVal{val: "true"}.ToBool()
+	require.NoError(t, err)
+	assert.True(t, b)
+
+	f, err := StringVal{val: "1.5"}.ToFloat64()
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, f)
+
+	d, err := StringVal{val: "1m30s"}.ToDuration()
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, d)
+
+	tm, err := StringVal{val: "2023-02-05"}.ToTime("2006-01-02")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 2, 5, 0, 0, 0, 0, time.UTC), tm)
+
+	_, err = StringVal{val: "abc"}.ToInt()
+	assert.Error(t, err)
+	_, err = StringVal{err: ErrKeyNotFound}.ToBool()
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Equal(t, "def", StringVal{err: ErrKeyNotFound}.OrDefault("def"))
+	assert.Equal(t, "def", StringVal{}.OrDefault("def"))
+	assert.Equal(t, "val", StringVal{val: "val"}.OrDefault("def"))
+
+	assert.Equal(t, "val", StringVal{val: "val"}.Must())
+	assert.PanicsWithError(t, "page: 找不到对应 key", func() {
+		StringVal{key: "page", err: ErrKeyNotFound}.Must()
+	})
+}
+
+func TestContext_QueryValues(t *testing.T) {
+	ctx := &Context{Request: httptest.NewRequest(http.MethodGet, "/?id=1&id=2&name=a&bad=x", nil)}
+
+	ids, err := ctx.QueryInts("id")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, ids)
+
+	names, err := ctx.QueryValues("name").Strings()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, names)
+
+	_, err = ctx.QueryInts("bad")
+	assert.Error(t, err)
+	_, err = ctx.QueryValues("missing").ToInt64s()
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestValueCollector(t *testing.T) {
+	ctx := &Context{
+		Request:    httptest.NewRequest(http.MethodGet, "/?page=2&size=abc&debug=true&ids=1&ids=2", nil),
+		PathParams: Params{{Key: "id", Value: "123"}},
+	}
+
+	vc := ctx.Collector()
+	id := vc.Int64(ctx.PathValue("id"))
+	page := vc.Int(ctx.QueryValue("page"))
+	debug := vc.Bool(ctx.QueryValue("debug"))
+	ids := vc.Ints(ctx.QueryValues("ids"))
+	require.NoError(t, vc.Err())
+	assert.Equal(t, int64(123), id)
+	assert.Equal(t, 2, page)
+	assert.True(t, debug)
+	assert.Equal(t, []int{1, 2}, ids)
+
+	size := vc.Int(ctx.QueryValue("size"))
+	_ = vc.String(ctx.QueryValue("sort"))
+	assert.Equal(t, 0, size)
+
+	err := vc.Err()
+	var errs ValueErrors
+	require.True(t, errors.As(err, &errs))
+	assert.Equal(t, []string{"size", "sort"}, errs.Fields())
+	assert.True(t, errors.Is(errs[1], ErrKeyNotFound))
+	assert.Equal(t, `size: strconv.Atoi: parsing "abc": invalid syntax; sort: 找不到对应 key`, err.Error())
+}
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket 的实现参考 RFC 6455 https://www.rfc-editor.org/rfc/rfc6455
+
+// WSMessageType 消息类型，和帧的 opcode 一致
+type WSMessageType byte
+
+const (
+	wsContinuation WSMessageType = 0x0
+
+	WSTextMessage   WSMessageType = 0x1
+	WSBinaryMessage WSMessageType = 0x2
+	WSCloseMessage  WSMessageType = 0x8
+	WSPingMessage   WSMessageType = 0x9
+	WSPongMessage   WSMessageType = 0xa
+)
+
+// 关闭状态码，见 RFC 6455 7.4.1
+const (
+	WSCloseNormalClosure      = 1000
+	WSCloseGoingAway          = 1001
+	WSCloseProtocolError      = 1002
+	WSCloseUnsupportedData    = 1003
+	WSCloseNoStatusReceived   = 1005
+	WSCloseAbnormalClosure    = 1006
+	WSCloseInvalidPayloadData = 1007
+	WSClosePolicyViolation    = 1008
+	WSCloseMessageTooBig      = 1009
+	WSCloseMandatoryExtension = 1010
+	WSCloseInternalServerErr  = 1011
+)
+
+const (
+	wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	finBit  = 0x80
+	rsvBits = 0x70
+	maskBit = 0x80
+
+	// 控制帧的负载不能超过 125 字节
+	maxControlPayload = 125
+
+	defaultWSMaxMessageSize = 1 << 20
+	defaultWSWriteTimeout   = 10 * time.Second
+	// 发出关闭帧之后等待对端回复的时间
+	wsCloseTimeout = 5 * time.Second
+)
+
+var ErrWSClosed = errors.New("web: WebSocket 连接已关闭")
+
+// WSCloseError 对端发送了关闭帧，或者因为协议错误而关闭了连接
+type WSCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *WSCloseError) Error() string {
+	return fmt.Sprintf("web: WebSocket 关闭 %d %s", e.Code, e.Reason)
+}
+
+type WSOption func(cfg *wsConfig)
+
+type wsConfig struct {
+	maxMessageSize int64
+	writeTimeout   time.Duration
+	checkOrigin    func(r *http.Request) bool
+	subprotocols   []string
+}
+
+// WithWSMaxMessageSize 单条消息（分片合并之后）的最大字节数，超过之后以 1009 关闭连接，默认 1 MiB。
+// 帧的长度由对端决定，必须有上限，所以 size 小于等于 0 的时候 panic
+func WithWSMaxMessageSize(size int64) WSOption {
+	if size <= 0 {
+		panic("web: WebSocket 消息大小上限必须大于 0")
+	}
+	return func(cfg *wsConfig) {
+		cfg.maxMessageSize = size
+	}
+}
+
+// WithWSWriteTimeout 每次写入的超时时间
+func WithWSWriteTimeout(d time.Duration) WSOption {
+	return func(cfg *wsConfig) {
+		cfg.writeTimeout = d
+	}
+}
+
+// WithWSCheckOrigin 校验 Origin，默认只允许没有 Origin 或者和 Host 相同的请求
+func WithWSCheckOrigin(fn func(r *http.Request) bool) WSOption {
+	return func(cfg *wsConfig) {
+		cfg.checkOrigin = fn
+	}
+}
+
+// WithWSSubprotocols 服务端支持的子协议，按照优先级排列
+func WithWSSubprotocols(protocols ...string) WSOption {
+	return func(cfg *wsConfig) {
+		cfg.subprotocols = protocols
+	}
+}
+
+// WebSocket 注册一个 WebSocket 路由，handler 返回之后连接会被关闭
+func (h *HTTPServer) WebSocket(path string, handler func(conn *WSConn), opts ...WSOption) {
+	cfg := &wsConfig{
+		maxMessageSize: defaultWSMaxMessageSize,
+		writeTimeout:   defaultWSWriteTimeout,
+		checkOrigin:    sameOrigin,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	h.Get(path, func(ctx *Context) {
+		conn, err := ctx.upgradeWebSocket(cfg)
+		if err != nil {
+			h.log.Printf("WebSocket 握手失败 %s: %v", ctx.Request.URL.Path, err)
+			return
+		}
+		defer conn.release()
+		handler(conn)
+	})
+}
+
+// sameOrigin 没有 Origin 的请求（非浏览器）放行，否则要求 Origin 的 host 和请求的 Host 一致
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// upgradeWebSocket 完成握手，失败的时候已经设置好了响应
+func (c *Context) upgradeWebSocket(cfg *wsConfig) (*WSConn, error) {
+	r := c.Request
+	if !headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") {
+		_ = c.ResponseWithString(http.StatusBadRequest, "400 BAD REQUEST")
+		return nil, errors.New("不是 WebSocket 升级请求")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		c.ResponseWriter.Header().Set("Sec-WebSocket-Version", "13")
+		_ = c.ResponseWithString(http.StatusUpgradeRequired, "426 UPGRADE REQUIRED")
+		return nil, errors.New("不支持的 Sec-WebSocket-Version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		_ = c.ResponseWithString(http.StatusBadRequest, "400 BAD REQUEST")
+		return nil, errors.New("非法的 Sec-WebSocket-Key")
+	}
+	if !cfg.checkOrigin(r) {
+		_ = c.ResponseWithString(http.StatusForbidden, "403 FORBIDDEN")
+		return nil, errors.New("Origin 校验失败")
+	}
+	if !c.response().canHijack() {
+		_ = c.StatusInternalServerError("500 INTERNAL SERVER ERROR")
+		return nil, errors.New("ResponseWriter 不支持 http.Hijacker")
+	}
+
+	ws := &WSConn{
+		request:        r,
+		maxMessageSize: cfg.maxMessageSize,
+		writeTimeout:   cfg.writeTimeout,
+		subprotocol:    selectSubprotocol(r, cfg.subprotocols),
+		conns:          c.conns,
+	}
+	if c.conns != nil && !c.conns.add(ws) {
+		_ = c.ResponseWithString(http.StatusServiceUnavailable, "服务已关闭")
+		return nil, errors.New("服务器正在关闭")
+	}
+
+	netConn, brw, err := c.response().Hijack()
+	if err != nil {
+		if c.conns != nil {
+			c.conns.remove(ws)
+		}
+		_ = c.StatusInternalServerError("500 INTERNAL SERVER ERROR")
+		return nil, err
+	}
+	ws.conn = netConn
+	ws.br = brw.Reader
+	ws.bw = brw.Writer
+
+	var sb strings.Builder
+	sb.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	sb.WriteString(wsAcceptKey(key))
+	sb.WriteString("\r\n")
+	if ws.subprotocol != "" {
+		sb.WriteString("Sec-WebSocket-Protocol: ")
+		sb.WriteString(ws.subprotocol)
+		sb.WriteString("\r\n")
+	}
+	sb.WriteString("\r\n")
+	_ = netConn.SetWriteDeadline(time.Now().Add(cfg.writeTimeout))
+	if _, err = ws.bw.WriteString(sb.String()); err == nil {
+		err = ws.bw.Flush()
+	}
+	if err != nil {
+		_ = netConn.Close()
+		if c.conns != nil {
+			c.conns.remove(ws)
+		}
+		return nil, err
+	}
+	return ws, nil
+}
+
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func selectSubprotocol(r *http.Request, supported []string) string {
+	requested := headerTokens(r.Header, "Sec-WebSocket-Protocol")
+	for _, s := range supported {
+		for _, req := range requested {
+			if s == req {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func headerTokens(header http.Header, name string) []string {
+	var res []string
+	for _, v := range header.Values(name) {
+		for _, token := range strings.Split(v, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				res = append(res, token)
+			}
+		}
+	}
+	return res
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, t := range headerTokens(header, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// WSConn 一个 WebSocket 连接
+// ReadMessage 只能在一个 goroutine 里面调用，写入的方法可以并发调用
+type WSConn struct {
+	conn    net.Conn
+	br      *bufio.Reader
+	bw      *bufio.Writer
+	request *http.Request
+
+	maxMessageSize int64
+	writeTimeout   time.Duration
+	subprotocol    string
+	pongHandler    func(data []byte)
+
+	// writeMu 保证帧不会交错，也保护 closeSent
+	writeMu   sync.Mutex
+	closeSent bool
+
+	conns       *connTracker
+	releaseOnce sync.Once
+}
+
+// Request 握手时的 HTTP 请求
+func (c *WSConn) Request() *http.Request {
+	return c.request
+}
+
+// Subprotocol 协商出来的子协议，没有的时候为空字符串
+func (c *WSConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+func (c *WSConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadDeadline 设置读取的超时时间，零值表示不超时
+func (c *WSConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetPongHandler 收到 pong 帧的时候调用，需要在 ReadMessage 之前设置
+func (c *WSConn) SetPongHandler(fn func(data []byte)) {
+	c.pongHandler = fn
+}
+
+// ReadMessage 读取一条完整的消息，分片会被合并，ping 会自动回复 pong
+// 对端关闭或者出现协议错误的时候返回 *WSCloseError
+func (c *WSConn) ReadMessage() (WSMessageType, []byte, error) {
+	var (
+		msgType WSMessageType
+		msg     []byte
+		// 是否正在接收分片消息
+		fragmented bool
+	)
+	for {
+		fin, op, payload, err := c.readFrame(int64(len(msg)))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case WSPingMessage:
+			if err = c.writeControl(WSPongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case WSPongMessage:
+			if c.pongHandler != nil {
+				c.pongHandler(payload)
+			}
+			continue
+		case WSCloseMessage:
+			return 0, nil, c.handleClose(payload)
+		case WSTextMessage, WSBinaryMessage:
+			if fragmented {
+				return 0, nil, c.fail(WSCloseProtocolError, "上一条分片消息还没有结束")
+			}
+			msgType = op
+		case wsContinuation:
+			if !fragmented {
+				return 0, nil, c.fail(WSCloseProtocolError, "没有需要继续的分片消息")
+			}
+		}
+
+		msg = append(msg, payload...)
+		if !fin {
+			fragmented = true
+			continue
+		}
+		if msgType == WSTextMessage && !utf8.Valid(msg) {
+			return 0, nil, c.fail(WSCloseInvalidPayloadData, "文本消息不是合法的 UTF-8")
+		}
+		return msgType, msg, nil
+	}
+}
+
+// readFrame 读取一帧并去掉掩码，received 是当前消息已经收到的字节数，用于检查消息大小
+func (c *WSConn) readFrame(received int64) (bool, WSMessageType, []byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(c.br, header[:2]); err != nil {
+		return false, 0, nil, c.abort(err)
+	}
+	fin := header[0]&finBit != 0
+	op := WSMessageType(header[0] & 0x0f)
+	if header[0]&rsvBits != 0 {
+		return false, 0, nil, c.fail(WSCloseProtocolError, "没有协商扩展，RSV 必须为 0")
+	}
+	switch op {
+	case wsContinuation, WSTextMessage, WSBinaryMessage, WSCloseMessage, WSPingMessage, WSPongMessage:
+	default:
+		return false, 0, nil, c.fail(WSCloseProtocolError, "未知的 opcode")
+	}
+	// 客户端发送的帧必须带掩码
+	if header[1]&maskBit == 0 {
+		return false, 0, nil, c.fail(WSCloseProtocolError, "客户端的帧没有掩码")
+	}
+
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(c.br, header[:2]); err != nil {
+			return false, 0, nil, c.abort(err)
+		}
+		length = int64(binary.BigEndian.Uint16(header[:2]))
+	case 127:
+		if _, err := io.ReadFull(c.br, header[:8]); err != nil {
+			return false, 0, nil, c.abort(err)
+		}
+		u := binary.BigEndian.Uint64(header[:8])
+		if u>>63 != 0 {
+			return false, 0, nil, c.fail(WSCloseProtocolError, "非法的负载长度")
+		}
+		length = int64(u)
+	}
+
+	if op >= WSCloseMessage {
+		if !fin || length > maxControlPayload {
+			return false, 0, nil, c.fail(WSCloseProtocolError, "控制帧不能分片，且负载不能超过 125 字节")
+		}
+	} else if received+length > c.maxMessageSize {
+		return false, 0, nil, c.fail(WSCloseMessageTooBig, "消息太大")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, c.abort(err)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, c.abort(err)
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// handleClose 收到关闭帧，回复同样的状态码
+func (c *WSConn) handleClose(payload []byte) error {
+	code := WSCloseNoStatusReceived
+	var reason string
+	switch {
+	case len(payload) == 1:
+		return c.fail(WSCloseProtocolError, "非法的关闭帧")
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		reason = string(payload[2:])
+		if !validCloseCode(code) {
+			return c.fail(WSCloseProtocolError, "非法的关闭状态码")
+		}
+		if !utf8.ValidString(reason) {
+			return c.fail(WSCloseInvalidPayloadData, "关闭原因不是合法的 UTF-8")
+		}
+	}
+
+	reply := code
+	if code == WSCloseNoStatusReceived {
+		reply = WSCloseNormalClosure
+	}
+	_ = c.writeClose(reply, "")
+	_ = c.conn.Close()
+	return &WSCloseError{Code: code, Reason: reason}
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code >= 1000 && code <= 1014:
+		// 1004、1005、1006 不能出现在关闭帧里面，1012-1014 是 IANA 后来注册的
+		return code != 1004 && code != WSCloseNoStatusReceived && code != WSCloseAbnormalClosure
+	}
+	return false
+}
+
+// fail 因为对端的错误关闭连接
+func (c *WSConn) fail(code int, reason string) error {
+	_ = c.writeClose(code, reason)
+	_ = c.conn.Close()
+	return &WSCloseError{Code: code, Reason: reason}
+}
+
+// abort 读取出错，例如对端直接断开了 TCP 连接
+func (c *WSConn) abort(err error) error {
+	c.writeMu.Lock()
+	sent := c.closeSent
+	c.writeMu.Unlock()
+	_ = c.conn.Close()
+	if sent || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &WSCloseError{Code: WSCloseAbnormalClosure, Reason: err.Error()}
+	}
+	return err
+}
+
+// WriteMessage 发送一条文本或者二进制消息
+func (c *WSConn) WriteMessage(typ WSMessageType, data []byte) error {
+	if typ != WSTextMessage && typ != WSBinaryMessage {
+		return errors.New("web: WriteMessage 只能发送文本或者二进制消息")
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrWSClosed
+	}
+	return c.writeFrame(typ, data)
+}
+
+// WriteText 发送一条文本消息
+func (c *WSConn) WriteText(text string) error {
+	return c.WriteMessage(WSTextMessage, []byte(text))
+}
+
+// Ping 发送 ping，对端的 pong 会交给 SetPongHandler 设置的回调
+func (c *WSConn) Ping(data []byte) error {
+	return c.writeControl(WSPingMessage, data)
+}
+
+// Close 发送关闭帧并等待对端回复，然后关闭底层连接
+// 不能和 ReadMessage 并发调用
+func (c *WSConn) Close(code int, reason string) error {
+	if err := c.writeClose(code, reason); err != nil {
+		_ = c.conn.Close()
+		return err
+	}
+	_ = c.conn.SetReadDeadline(time.Now().Add(wsCloseTimeout))
+	for {
+		_, op, _, err := c.readFrame(0)
+		if err != nil || op == WSCloseMessage {
+			break
+		}
+	}
+	return c.conn.Close()
+}
+
+func (c *WSConn) writeControl(op WSMessageType, data []byte) error {
+	if len(data) > maxControlPayload {
+		return errors.New("web: 控制帧负载不能超过 125 字节")
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrWSClosed
+	}
+	return c.writeFrame(op, data)
+}
+
+// writeClose 发送关闭帧，只会发送一次
+func (c *WSConn) writeClose(code int, reason string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return nil
+	}
+	c.closeSent = true
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+		// 截断的位置可能落在多字节字符中间，回退到字符边界
+		for len(payload) > 2 && !utf8.Valid(payload[2:]) {
+			payload = payload[:len(payload)-1]
+		}
+	}
+	return c.writeFrame(WSCloseMessage, payload)
+}
+
+// writeFrame 服务端发送的帧不带掩码，调用方需要持有 writeMu
+func (c *WSConn) writeFrame(op WSMessageType, payload []byte) error {
+	var header [10]byte
+	header[0] = finBit | byte(op)
+	n := 2
+	switch l := len(payload); {
+	case l <= 125:
+		header[1] = byte(l)
+	case l <= 0xffff:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(l))
+		n = 4
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(l))
+		n = 10
+	}
+	if c.writeTimeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	if _, err := c.bw.Write(header[:n]); err != nil {
+		return err
+	}
+	if _, err := c.bw.Write(payload); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+// shutdown 服务器退出，发送 1001 并限制对端回复的时间，handler 的 ReadMessage 会因此返回
+func (c *WSConn) shutdown() {
+	_ = c.writeClose(WSCloseGoingAway, "server shutting down")
+	_ = c.conn.SetReadDeadline(time.Now().Add(wsCloseTimeout))
+}
+
+// release handler 返回之后释放连接
+func (c *WSConn) release() {
+	c.releaseOnce.Do(func() {
+		_ = c.writeClose(WSCloseNormalClosure, "")
+		_ = c.conn.Close()
+		if c.conns != nil {
+			c.conns.remove(c)
+		}
+	})
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wsTestClient 测试用的最简客户端，发送的帧都带掩码
+type wsTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialWS(t *testing.T, server *httptest.Server, path string, header http.Header) (*wsTestClient, *http.Response) {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	_ = conn.SetDeadline(time.Now().Add(3 * time.Second))
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	require.NoError(t, req.Write(conn))
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	require.NoError(t, err)
+	return &wsTestClient{t: t, conn: conn, br: br}, resp
+}
+
+func (c *wsTestClient) writeFrame(fin bool, op WSMessageType, payload []byte, masked bool) {
+	b0 := byte(op)
+	if fin {
+		b0 |= finBit
+	}
+	frame := []byte{b0}
+	var maskFlag byte
+	if masked {
+		maskFlag = maskBit
+	}
+	switch l := len(payload); {
+	case l <= 125:
+		frame = append(frame, maskFlag|byte(l))
+	case l <= 0xffff:
+		frame = append(frame, maskFlag|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(l))
+	default:
+		frame = append(frame, maskFlag|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(l))
+	}
+	data := append([]byte(nil), payload...)
+	if masked {
+		mask := []byte{0x12, 0x34, 0x56, 0x78}
+		frame = append(frame, mask...)
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+	}
+	_, err := c.conn.Write(append(frame, data...))
+	require.NoError(c.t, err)
+}
+
+func (c *wsTestClient) readFrame() (WSMessageType, []byte) {
+	var header [2]byte
+	_, err := io.ReadFull(c.br, header[:])
+	require.NoError(c.t, err)
+	assert.NotZero(c.t, header[0]&finBit)
+	assert.Zero(c.t, header[1]&maskBit, "服务端的帧不能带掩码")
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		require.NoError(c.t, err)
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.br, payload)
+	require.NoError(c.t, err)
+	return WSMessageType(header[0] & 0x0f), payload
+}
+
+func (c *wsTestClient) expectClose(code int) {
+	op, payload := c.readFrame()
+	require.Equal(c.t, WSCloseMessage, op)
+	require.GreaterOrEqual(c.t, len(payload), 2)
+	assert.Equal(c.t, code, int(binary.BigEndian.Uint16(payload)))
+}
+
+func closePayload(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+func newEchoServer(t *testing.T, opts ...WSOption) (*HTTPServer, *httptest.Server, chan error) {
+	s := NewHTTPServer("test", "")
+	errs := make(chan error, 1)
+	s.WebSocket("/ws", func(conn *WSConn) {
+		for {
+			typ, msg, err := conn.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err = conn.WriteMessage(typ, msg); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}, opts...)
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server, errs
+}
+
+func Test_wsAcceptKey(t *testing.T) {
+	// RFC 6455 1.3 里面的例子
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", wsAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestWebSocket_Handshake(t *testing.T) {
+	_, server, _ := newEchoServer(t, WithWSSubprotocols("chat", "superchat"))
+
+	client, resp := dialWS(t, server, "/ws", http.Header{"Sec-Websocket-Protocol": {"superchat, chat"}})
+	defer client.conn.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	assert.Equal(t, "chat", resp.Header.Get("Sec-WebSocket-Protocol"))
+
+	testCases := []struct {
+		name     string
+		header   http.Header
+		wantCode int
+	}{
+		{name: "wrong version", header: http.Header{"Sec-Websocket-Version": {"8"}}, wantCode: http.StatusUpgradeRequired},
+		{name: "bad key", header: http.Header{"Sec-Websocket-Key": {"abc"}}, wantCode: http.StatusBadRequest},
+		{name: "no upgrade", header: http.Header{"Upgrade": {"h2c"}}, wantCode: http.StatusBadRequest},
+		{name: "cross origin", header: http.Header{"Origin": {"http://evil.example.com"}}, wantCode: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, resp := dialWS(t, server, "/ws", tc.header)
+			defer client.conn.Close()
+			assert.Equal(t, tc.wantCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestWebSocket_Messages(t *testing.T) {
+	_, server, errs := newEchoServer(t)
+	client, _ := dialWS(t, server, "/ws", nil)
+	defer client.conn.Close()
+
+	// 普通文本消息
+	client.writeFrame(true, WSTextMessage, []byte("hello"), true)
+	op, payload := client.readFrame()
+	assert.Equal(t, WSTextMessage, op)
+	assert.Equal(t, "hello", string(payload))
+
+	// 分片消息中间插入 ping
+	client.writeFrame(false, WSBinaryMessage, []byte{1, 2}, true)
+	client.writeFrame(true, WSPingMessage, []byte("p"), true)
+	client.writeFrame(false, wsContinuation, []byte{3}, true)
+	client.writeFrame(true, wsContinuation, []byte{4}, true)
+	op, payload = client.readFrame()
+	assert.Equal(t, WSPongMessage, op)
+	assert.Equal(t, "p", string(payload))
+	op, payload = client.readFrame()
+	assert.Equal(t, WSBinaryMessage, op)
+	assert.Equal(t, []byte{1, 2, 3, 4}, payload)
+
+	// 16 位长度
+	long := strings.Repeat("a", 300)
+	client.writeFrame(true, WSTextMessage, []byte(long), true)
+	_, payload = client.readFrame()
+	assert.Equal(t, long, string(payload))
+
+	// 客户端关闭，服务端回复同样的状态码
+	client.writeFrame(true, WSCloseMessage, closePayload(WSCloseNormalClosure, "bye"), true)
+	client.expectClose(WSCloseNormalClosure)
+	err := <-errs
+	var closeErr *WSCloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, WSCloseNormalClosure, closeErr.Code)
+	assert.Equal(t, "bye", closeErr.Reason)
+}
+
+func TestWebSocket_ProtocolErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		send     func(c *wsTestClient)
+		wantCode int
+	}{
+		{
+			name: "unmasked",
+			send: func(c *wsTestClient) {
+				c.writeFrame(true, WSTextMessage, []byte("hi"), false)
+			},
+			wantCode: WSCloseProtocolError,
+		},
+		{
+			name: "invalid utf8",
+			send: func(c *wsTestClient) {
+				c.writeFrame(true, WSTextMessage, []byte{0xff, 0xfe}, true)
+			},
+			wantCode: WSCloseInvalidPayloadData,
+		},
+		{
+			name: "too big",
+			send: func(c *wsTestClient) {
+				c.writeFrame(false, WSBinaryMessage, make([]byte, 10), true)
+				c.writeFrame(true, wsContinuation, make([]byte, 10), true)
+			},
+			wantCode: WSCloseMessageTooBig,
+		},
+		{
+			name: "unexpected continuation",
+			send: func(c *wsTestClient) {
+				c.writeFrame(true, wsContinuation, []byte("x"), true)
+			},
+			wantCode: WSCloseProtocolError,
+		},
+		{
+			name: "fragmented control",
+			send: func(c *wsTestClient) {
+				c.writeFrame(false, WSPingMessage, []byte("x"), true)
+			},
+			wantCode: WSCloseProtocolError,
+		},
+		{
+			name: "invalid close code",
+			send: func(c *wsTestClient) {
+				c.writeFrame(true, WSCloseMessage, closePayload(1005, ""), true)
+			},
+			wantCode: WSCloseProtocolError,
+		},
+		{
+			name: "unassigned close code",
+			send: func(c *wsTestClient) {
+				c.writeFrame(true, WSCloseMessage, closePayload(1015, ""), true)
+			},
+			wantCode: WSCloseProtocolError,
+		},
+		{
+			// 1012 服务重启，是合法的状态码，原样回复
+			name: "service restart",
+			send: func(c *wsTestClient) {
+				c.writeFrame(true, WSCloseMessage, closePayload(1012, ""), true)
+			},
+			wantCode: 1012,
+		},
+		{
+			// 帧头声明的长度超过上限的时候不会分配内存
+			name: "huge frame header",
+			send: func(c *wsTestClient) {
+				header := []byte{0x82, 0x80 | 127, 0, 0, 0, 1, 0, 0, 0, 0}
+				_, err := c.conn.Write(header)
+				require.NoError(t, err)
+			},
+			wantCode: WSCloseMessageTooBig,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, server, errs := newEchoServer(t, WithWSMaxMessageSize(16))
+			client, _ := dialWS(t, server, "/ws", nil)
+			defer client.conn.Close()
+			tc.send(client)
+			client.expectClose(tc.wantCode)
+			var closeErr *WSCloseError
+			require.ErrorAs(t, <-errs, &closeErr)
+			assert.Equal(t, tc.wantCode, closeErr.Code)
+		})
+	}
+}
+
+func TestWithWSMaxMessageSize(t *testing.T) {
+	assert.Panics(t, func() { WithWSMaxMessageSize(0) })
+	assert.Panics(t, func() { WithWSMaxMessageSize(-1) })
+}
+
+func TestWebSocket_CloseReasonTruncated(t *testing.T) {
+	s := NewHTTPServer("test", "")
+	s.WebSocket("/ws", func(conn *WSConn) {
+		_ = conn.Close(WSCloseNormalClosure, strings.Repeat("é", 100))
+	})
+	server := httptest.NewServer(s)
+	defer server.Close()
+	client, _ := dialWS(t, server, "/ws", nil)
+	defer client.conn.Close()
+
+	op, payload := client.readFrame()
+	require.Equal(t, WSCloseMessage, op)
+	assert.LessOrEqual(t, len(payload), maxControlPayload)
+	assert.True(t, utf8.Valid(payload[2:]))
+	assert.Equal(t, strings.Repeat("é", 61), string(payload[2:]))
+	client.writeFrame(true, WSCloseMessage, closePayload(WSCloseNormalClosure, ""), true)
+}
+
+func TestWebSocket_Shutdown(t *testing.T) {
+	s, server, errs := newEchoServer(t)
+	client, _ := dialWS(t, server, "/ws", nil)
+	defer client.conn.Close()
+
+	client.writeFrame(true, WSTextMessage, []byte("hi"), true)
+	_, _ = client.readFrame()
+	assert.Equal(t, 1, s.conns.len())
+
+	// 模拟 App 优雅退出：服务端先发送 1001，客户端回复之后 handler 返回
+	s.closeLongLivedConns()
+	client.expectClose(WSCloseGoingAway)
+	client.writeFrame(true, WSCloseMessage, closePayload(WSCloseGoingAway, ""), true)
+
+	var closeErr *WSCloseError
+	require.ErrorAs(t, <-errs, &closeErr)
+	assert.Equal(t, WSCloseGoingAway, closeErr.Code)
+	assert.Eventually(t, func() bool {
+		return s.conns.len() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// 退出之后拒绝新的连接
+	client2, resp := dialWS(t, server, "/ws", nil)
+	defer client2.conn.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}